@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/blaxel-ai/kube-janitor-go/internal/archive"
 	"github.com/blaxel-ai/kube-janitor-go/internal/janitor"
 	"github.com/blaxel-ai/kube-janitor-go/internal/metrics"
+	"github.com/blaxel-ai/kube-janitor-go/internal/rules"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -43,10 +46,42 @@ func init() {
 	rootCmd.PersistentFlags().StringSlice("include-namespaces", []string{}, "Namespaces to include (default: all)")
 	rootCmd.PersistentFlags().StringSlice("exclude-namespaces", []string{"kube-system", "kube-public", "kube-node-lease"}, "Namespaces to exclude")
 	rootCmd.PersistentFlags().String("rules-file", "", "Path to YAML file containing cleanup rules")
+	rootCmd.PersistentFlags().Bool("rule-crds", false, "Also load cleanup rules from JanitorRule and ClusterJanitorRule resources (requires the CRDs)")
+	rootCmd.PersistentFlags().Uint64("rule-cost-limit", rules.DefaultCostLimit, "Maximum CEL cost of a rule evaluation; rules whose estimated worst case is 100 times higher are rejected (0 disables)")
+	rootCmd.PersistentFlags().Duration("rule-eval-timeout", rules.DefaultEvalTimeout, "Maximum time a rule evaluation may take (0 disables)")
+	rootCmd.PersistentFlags().Bool("rule-schemas", false, "Reject rules using fields that are not in the OpenAPI schemas of their resources")
+	rootCmd.PersistentFlags().StringSlice("builtin-policies", []string{}, "Built-in cleanup policies to enable, as <name> or <name>=<ttl>: "+strings.Join(rules.BuiltinPolicies(), ", "))
+	rootCmd.PersistentFlags().Duration("empty-namespace-ttl", 0, "Delete namespaces that held only ignored objects for this long (0 disables)")
+	rootCmd.PersistentFlags().StringSlice("empty-namespace-ignore", janitor.DefaultEmptyNamespaceIgnore, "Objects that do not keep a namespace from being empty, as <Kind> or <Kind>/<name>, where the name may contain wildcards")
 	rootCmd.PersistentFlags().Int("metrics-port", 8080, "Port for Prometheus metrics")
 	rootCmd.PersistentFlags().String("log-level", "info", "Log level: debug, info, warn, error")
 	rootCmd.PersistentFlags().Int("max-workers", 10, "Maximum number of concurrent workers")
 	rootCmd.PersistentFlags().String("kubeconfig", "", "Path to kubeconfig file (optional)")
+	rootCmd.PersistentFlags().Duration("confirmation-period", 0, "Only label resources with janitor/marked-at when they expire, and delete them once they stayed expired for this long (0 disables)")
+	rootCmd.PersistentFlags().Duration("notify-before", 0, "Annotate resources and emit a warning event this long before they are deleted (0 disables)")
+	rootCmd.PersistentFlags().String("default-timezone", "UTC", "IANA timezone for janitor/expires and janitor/extend-until times without a zone, e.g. Europe/Paris")
+	rootCmd.PersistentFlags().String("invalid-annotation-policy", janitor.InvalidAnnotationProtect, "What to do with resources whose janitor/ttl or janitor/expires annotation cannot be parsed: protect, ignore, expire")
+	rootCmd.PersistentFlags().Duration("max-extension", janitor.DefaultMaxExtension, "Maximum time janitor/snooze and janitor/extend-until may delay a deletion (0 means no limit)")
+	rootCmd.PersistentFlags().String("deletion-window", "", "Cron expressions (separated by ';', optionally prefixed with CRON_TZ=<zone>) for when deletions are allowed (default: any time)")
+	rootCmd.PersistentFlags().String("notify-webhook-url", "", "URL to post a summary of each run's deletions to (optional)")
+	rootCmd.PersistentFlags().String("notify-webhook-format", "generic", "Webhook payload format: generic, slack")
+	rootCmd.PersistentFlags().StringSlice("notify-owner-labels", []string{}, "Label keys identifying resource owners to include in notifications")
+	rootCmd.PersistentFlags().String("archive-dir", "", "Directory to archive manifests to before deleting resources (optional)")
+	rootCmd.PersistentFlags().String("archive-format", "dir", "Archive format: dir (one file per resource), tar (one tar.gz per run)")
+	rootCmd.PersistentFlags().Duration("archive-retention", 0, "Remove archives older than this (0 keeps them forever)")
+	rootCmd.PersistentFlags().String("archive-s3-bucket", "", "S3 bucket to upload manifests to before deleting resources (optional)")
+	rootCmd.PersistentFlags().String("archive-s3-endpoint", "", "S3-compatible endpoint URL, e.g. http://minio:9000 (default: AWS S3 in --archive-s3-region)")
+	rootCmd.PersistentFlags().String("archive-s3-region", "us-east-1", "Region of the S3 bucket")
+	rootCmd.PersistentFlags().Bool("archive-s3-path-style", false, "Address the bucket in the URL path, as MinIO requires")
+	rootCmd.PersistentFlags().String("archive-s3-key-template", archive.DefaultKeyTemplate, "Key of uploaded manifests; placeholders: {{cluster}}, {{date}}, {{run}}, {{namespace}}, {{group}}, {{resource}}, {{kind}}, {{name}}, {{uid}}")
+	rootCmd.PersistentFlags().String("archive-s3-sse", "", "Server-side encryption for uploads: AES256, aws:kms (default: bucket default)")
+	rootCmd.PersistentFlags().String("archive-s3-sse-kms-key-id", "", "KMS key ID for aws:kms server-side encryption")
+	rootCmd.PersistentFlags().Int("archive-s3-queue-size", 100, "Maximum number of uploads waiting for an uploader")
+	rootCmd.PersistentFlags().Duration("archive-s3-queue-timeout", 10*time.Second, "How long to wait for room in the upload queue before skipping a deletion")
+	rootCmd.PersistentFlags().String("cluster-name", "", "Name of the cluster, used in archive keys")
+	rootCmd.PersistentFlags().String("audit-log", "", "File to append a JSON line to whenever the decision about a resource changes (optional)")
+	rootCmd.PersistentFlags().Int("audit-log-max-size", 100, "Size in megabytes at which the audit log is rotated (0 disables rotation)")
+	rootCmd.PersistentFlags().Int("audit-log-max-backups", 5, "Number of rotated audit log files to keep")
 
 	// Bind flags to viper
 	if err := viper.BindPFlags(rootCmd.PersistentFlags()); err != nil {
@@ -104,33 +139,71 @@ func run(_ *cobra.Command, _ []string) error {
 		return fmt.Errorf("failed to create kubernetes client: %w", err)
 	}
 
+	// Create janitor
+	j, err := janitor.New(clientset, config, janitorConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create janitor: %w", err)
+	}
+
 	// Start metrics server
 	metricsServer := metrics.NewServer(viper.GetInt("metrics-port"))
+	metricsServer.Handle("/rules", j.RulesHandler())
 	go func() {
 		if err := metricsServer.Start(); err != nil {
 			logrus.WithError(err).Error("Failed to start metrics server")
 		}
 	}()
 
-	// Create and run janitor
-	janitorConfig := janitor.Config{
-		DryRun:            viper.GetBool("dry-run"),
-		Interval:          viper.GetDuration("interval"),
-		Once:              viper.GetBool("once"),
-		IncludeResources:  viper.GetStringSlice("include-resources"),
-		ExcludeResources:  viper.GetStringSlice("exclude-resources"),
-		IncludeNamespaces: viper.GetStringSlice("include-namespaces"),
-		ExcludeNamespaces: viper.GetStringSlice("exclude-namespaces"),
-		RulesFile:         viper.GetString("rules-file"),
-		MaxWorkers:        viper.GetInt("max-workers"),
-	}
+	return j.Run(ctx)
+}
 
-	j, err := janitor.New(clientset, config, janitorConfig)
-	if err != nil {
-		return fmt.Errorf("failed to create janitor: %w", err)
+// janitorConfig builds the janitor configuration from flags and environment variables
+func janitorConfig() janitor.Config {
+	return janitor.Config{
+		DryRun:                  viper.GetBool("dry-run"),
+		Interval:                viper.GetDuration("interval"),
+		Once:                    viper.GetBool("once"),
+		IncludeResources:        viper.GetStringSlice("include-resources"),
+		ExcludeResources:        viper.GetStringSlice("exclude-resources"),
+		IncludeNamespaces:       viper.GetStringSlice("include-namespaces"),
+		ExcludeNamespaces:       viper.GetStringSlice("exclude-namespaces"),
+		RulesFile:               viper.GetString("rules-file"),
+		RuleCRDs:                viper.GetBool("rule-crds"),
+		RuleCostLimit:           viper.GetUint64("rule-cost-limit"),
+		RuleEvalTimeout:         viper.GetDuration("rule-eval-timeout"),
+		RuleSchemas:             viper.GetBool("rule-schemas"),
+		BuiltinPolicies:         viper.GetStringSlice("builtin-policies"),
+		EmptyNamespaceTTL:       viper.GetDuration("empty-namespace-ttl"),
+		EmptyNamespaceIgnore:    viper.GetStringSlice("empty-namespace-ignore"),
+		MaxWorkers:              viper.GetInt("max-workers"),
+		NotifyBefore:            viper.GetDuration("notify-before"),
+		ConfirmationPeriod:      viper.GetDuration("confirmation-period"),
+		WebhookURL:              viper.GetString("notify-webhook-url"),
+		WebhookFormat:           viper.GetString("notify-webhook-format"),
+		NotifyOwnerLabels:       viper.GetStringSlice("notify-owner-labels"),
+		MaxExtension:            viper.GetDuration("max-extension"),
+		InvalidAnnotationPolicy: viper.GetString("invalid-annotation-policy"),
+		DefaultTimezone:         viper.GetString("default-timezone"),
+		DeletionWindow:          viper.GetString("deletion-window"),
+		ArchiveDir:              viper.GetString("archive-dir"),
+		ArchiveFormat:           viper.GetString("archive-format"),
+		ArchiveRetention:        viper.GetDuration("archive-retention"),
+		ArchiveS3: archive.S3Config{
+			Endpoint:     viper.GetString("archive-s3-endpoint"),
+			Region:       viper.GetString("archive-s3-region"),
+			Bucket:       viper.GetString("archive-s3-bucket"),
+			PathStyle:    viper.GetBool("archive-s3-path-style"),
+			KeyTemplate:  viper.GetString("archive-s3-key-template"),
+			Cluster:      viper.GetString("cluster-name"),
+			SSE:          viper.GetString("archive-s3-sse"),
+			SSEKMSKeyID:  viper.GetString("archive-s3-sse-kms-key-id"),
+			QueueSize:    viper.GetInt("archive-s3-queue-size"),
+			QueueTimeout: viper.GetDuration("archive-s3-queue-timeout"),
+		},
+		AuditLog:           viper.GetString("audit-log"),
+		AuditLogMaxSize:    int64(viper.GetInt("audit-log-max-size")) * 1024 * 1024,
+		AuditLogMaxBackups: viper.GetInt("audit-log-max-backups"),
 	}
-
-	return j.Run(ctx)
 }
 
 func getKubeConfig() (*rest.Config, error) {
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/archive"
+	"github.com/blaxel-ai/kube-janitor-go/internal/restore"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Re-create resources from the deletion archive",
+	Long: `Re-create resources archived by a cleanup run (see --archive-dir).
+
+Resources are created in dependency order, owner references to owners that no
+longer exist are removed, and restored resources are protected from deletion
+for the --grace period.`,
+	Example: "  kube-janitor-go restore --archive-dir=/var/lib/kube-janitor/archive --run 20240301T120000Z --namespace foo --name bar",
+	RunE:    runRestore,
+}
+
+func init() {
+	restoreCmd.Flags().String("run", "", "ID of the cleanup run to restore resources from (required)")
+	restoreCmd.Flags().String("namespace", "", "Only restore resources from this namespace")
+	restoreCmd.Flags().String("name", "", "Only restore resources with this name")
+	restoreCmd.Flags().Duration("grace", 24*time.Hour, "Protect restored resources from deletion for this long")
+	if err := restoreCmd.MarkFlagRequired("run"); err != nil {
+		panic(err)
+	}
+
+	rootCmd.AddCommand(restoreCmd)
+}
+
+func runRestore(cmd *cobra.Command, _ []string) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	archiveDir := viper.GetString("archive-dir")
+	if archiveDir == "" {
+		return fmt.Errorf("--archive-dir is required")
+	}
+
+	flags := cmd.Flags()
+	runID, _ := flags.GetString("run")
+	namespace, _ := flags.GetString("namespace")
+	name, _ := flags.GetString("name")
+	grace, _ := flags.GetDuration("grace")
+
+	records, err := archive.ReadRun(viper.GetString("archive-format"), archiveDir, runID)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	filter := restore.Filter{Namespace: namespace, Name: name}
+	var selected []archive.Record
+	for _, record := range records {
+		if filter.Matches(record.Entry) {
+			selected = append(selected, record)
+		}
+	}
+	if len(selected) == 0 {
+		return fmt.Errorf("no archived resources in run %s match the given namespace and name", runID)
+	}
+
+	config, err := getKubeConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get kubernetes config: %w", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create discovery client: %w", err)
+	}
+
+	restorer := &restore.Restorer{
+		Client: dynamicClient,
+		Mapper: restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient)),
+		Grace:  grace,
+		DryRun: viper.GetBool("dry-run"),
+	}
+	results := restorer.Restore(ctx, selected)
+
+	var failed int
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tRESOURCE\tNAMESPACE\tNAME")
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Status, result.Entry.Resource, result.Entry.Namespace, result.Entry.Name)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to restore %d of %d resources", failed, len(results))
+	}
+	return nil
+}
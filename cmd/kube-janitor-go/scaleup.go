@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/restore"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+var scaleUpCmd = &cobra.Command{
+	Use:   "scale-up <resource>/<name> | <resource> <name>",
+	Short: "Restore the replicas of a resource scaled down by the janitor",
+	Long: `Scale a resource back to the replica count it had when the janitor scaled it
+down (see the scale-down action), as recorded in its janitor/previous-replicas
+annotation. The resource is protected from being scaled down or deleted again
+for the --grace period.`,
+	Example: "  kube-janitor-go scale-up deployments/my-app -n team-a\n" +
+		"  kube-janitor-go scale-up statefulsets.apps my-db -n team-a --grace 72h",
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runScaleUp,
+}
+
+func init() {
+	scaleUpCmd.Flags().StringP("namespace", "n", "default", "Namespace of the resource, ignored for cluster-scoped resources")
+	scaleUpCmd.Flags().Duration("grace", 24*time.Hour, "Protect the resource from the janitor for this long")
+
+	rootCmd.AddCommand(scaleUpCmd)
+}
+
+func runScaleUp(cmd *cobra.Command, args []string) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	resourceArg, name, err := parseResourceArgs(args)
+	if err != nil {
+		return err
+	}
+	flags := cmd.Flags()
+	namespace, _ := flags.GetString("namespace")
+	grace, _ := flags.GetDuration("grace")
+
+	config, err := getKubeConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get kubernetes config: %w", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create discovery client: %w", err)
+	}
+
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+	gvr, namespaced, err := resolveResource(mapper, resourceArg)
+	if err != nil {
+		return err
+	}
+	if !namespaced {
+		namespace = ""
+	}
+
+	restorer := &restore.Restorer{
+		Client: dynamicClient,
+		Mapper: mapper,
+		Grace:  grace,
+		DryRun: viper.GetBool("dry-run"),
+	}
+	replicas, err := restorer.ScaleUp(ctx, gvr, namespace, name)
+	if err != nil {
+		return err
+	}
+
+	logger := logrus.WithFields(logrus.Fields{
+		"resource":  gvr.Resource,
+		"namespace": namespace,
+		"name":      name,
+		"replicas":  replicas,
+	})
+	if restorer.DryRun {
+		logger.Info("DRY RUN: Would scale up resource")
+	} else {
+		logger.Info("Resource scaled up")
+	}
+	return nil
+}
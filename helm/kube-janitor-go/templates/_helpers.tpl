@@ -95,9 +95,97 @@ Build the command-line arguments for kube-janitor-go
 {{- end }}
 {{- $args = append $args (printf "--exclude-namespaces=%s" (join "," $namespaces)) }}
 {{- end }}
+{{- if .Values.janitor.notifyBefore }}
+{{- $args = append $args (printf "--notify-before=%s" .Values.janitor.notifyBefore) }}
+{{- end }}
+{{- if .Values.janitor.confirmationPeriod }}
+{{- $args = append $args (printf "--confirmation-period=%s" .Values.janitor.confirmationPeriod) }}
+{{- end }}
+{{- if .Values.janitor.maxExtension }}
+{{- $args = append $args (printf "--max-extension=%s" .Values.janitor.maxExtension) }}
+{{- end }}
+{{- if .Values.janitor.defaultTimezone }}
+{{- $args = append $args (printf "--default-timezone=%s" .Values.janitor.defaultTimezone) }}
+{{- end }}
+{{- if .Values.janitor.invalidAnnotationPolicy }}
+{{- $args = append $args (printf "--invalid-annotation-policy=%s" .Values.janitor.invalidAnnotationPolicy) }}
+{{- end }}
+{{- if .Values.janitor.deletionWindow }}
+{{- $args = append $args (printf "--deletion-window=%s" .Values.janitor.deletionWindow) }}
+{{- end }}
+{{- with .Values.janitor.webhook }}
+{{- if .url }}
+{{- $args = append $args (printf "--notify-webhook-url=%s" .url) }}
+{{- $args = append $args (printf "--notify-webhook-format=%s" .format) }}
+{{- end }}
+{{- if .ownerLabels }}
+{{- $args = append $args (printf "--notify-owner-labels=%s" (join "," .ownerLabels)) }}
+{{- end }}
+{{- end }}
+{{- with .Values.janitor.archive }}
+{{- if .dir }}
+{{- $args = append $args (printf "--archive-dir=%s" .dir) }}
+{{- $args = append $args (printf "--archive-format=%s" .format) }}
+{{- if .retention }}
+{{- $args = append $args (printf "--archive-retention=%s" .retention) }}
+{{- end }}
+{{- end }}
+{{- with .s3 }}
+{{- if .bucket }}
+{{- $args = append $args (printf "--archive-s3-bucket=%s" .bucket) }}
+{{- $args = append $args (printf "--archive-s3-region=%s" .region) }}
+{{- $args = append $args (printf "--archive-s3-queue-size=%v" .queueSize) }}
+{{- $args = append $args (printf "--archive-s3-queue-timeout=%s" .queueTimeout) }}
+{{- if .endpoint }}
+{{- $args = append $args (printf "--archive-s3-endpoint=%s" .endpoint) }}
+{{- end }}
+{{- if .pathStyle }}
+{{- $args = append $args "--archive-s3-path-style" }}
+{{- end }}
+{{- if .keyTemplate }}
+{{- $args = append $args (printf "--archive-s3-key-template=%s" .keyTemplate) }}
+{{- end }}
+{{- if .sse }}
+{{- $args = append $args (printf "--archive-s3-sse=%s" .sse) }}
+{{- end }}
+{{- if .sseKmsKeyId }}
+{{- $args = append $args (printf "--archive-s3-sse-kms-key-id=%s" .sseKmsKeyId) }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- with .Values.janitor.auditLog }}
+{{- if .path }}
+{{- $args = append $args (printf "--audit-log=%s" .path) }}
+{{- $args = append $args (printf "--audit-log-max-size=%v" .maxSize) }}
+{{- $args = append $args (printf "--audit-log-max-backups=%v" .maxBackups) }}
+{{- end }}
+{{- end }}
+{{- if .Values.janitor.clusterName }}
+{{- $args = append $args (printf "--cluster-name=%s" .Values.janitor.clusterName) }}
+{{- end }}
 {{- if .Values.janitor.rulesFile.enabled }}
 {{- $args = append $args (printf "--rules-file=%s" .Values.janitor.rulesFile.path) }}
 {{- end }}
+{{- if .Values.janitor.ruleCRDs.enabled }}
+{{- $args = append $args "--rule-crds" }}
+{{- end }}
+{{- with .Values.janitor.ruleLimits }}
+{{- $args = append $args (printf "--rule-cost-limit=%d" (int64 .costLimit)) }}
+{{- $args = append $args (printf "--rule-eval-timeout=%s" .evalTimeout) }}
+{{- end }}
+{{- if .Values.janitor.ruleSchemas }}
+{{- $args = append $args "--rule-schemas" }}
+{{- end }}
+{{- if .Values.janitor.builtinPolicies }}
+{{- $args = append $args (printf "--builtin-policies=%s" (join "," .Values.janitor.builtinPolicies)) }}
+{{- end }}
+{{- with .Values.janitor.emptyNamespaces }}
+{{- if .ttl }}
+{{- $args = append $args (printf "--empty-namespace-ttl=%s" .ttl) }}
+{{- $args = append $args (printf "--empty-namespace-ignore=%s" (join "," .ignore)) }}
+{{- end }}
+{{- end }}
 {{ toYaml $args }}
 {{- end }}
 
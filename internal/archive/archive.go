@@ -0,0 +1,138 @@
+package archive
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/pkg/manifest"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// FormatDir stores one manifest file per object in a directory tree
+	FormatDir = "dir"
+	// FormatTar stores the manifests of each run in a single tar.gz file
+	FormatTar = "tar"
+
+	// IndexFile is the name of the JSON lines index listing archived objects
+	IndexFile = "index.jsonl"
+
+	clusterScopedDir = "_cluster"
+)
+
+// Entry describes an archived object
+type Entry struct {
+	RunID     string    `json:"runId"`
+	Time      time.Time `json:"time"`
+	Group     string    `json:"group"`
+	Version   string    `json:"version"`
+	Resource  string    `json:"resource"`
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name"`
+	UID       string    `json:"uid"`
+	Reason    string    `json:"reason"`
+	RuleID    string    `json:"ruleId,omitempty"`
+	// Path is the location of the manifest, relative to the archive root
+	Path string `json:"path"`
+}
+
+// GroupVersionResource returns the resource the archived object belongs to
+func (e Entry) GroupVersionResource() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: e.Group, Version: e.Version, Resource: e.Resource}
+}
+
+// Sink stores the manifests of objects before they are deleted
+type Sink interface {
+	// Store archives an object. Deletion must not proceed if it fails.
+	Store(ctx context.Context, entry Entry, obj *unstructured.Unstructured) error
+	// Flush completes the given run and applies the retention policy
+	Flush(runID string) error
+	// Close completes the runs that were not flushed, e.g. because the
+	// janitor is shutting down, and releases the sink's resources
+	Close() error
+}
+
+// New creates a sink for the given format, storing archives under root.
+// Archives older than retention are removed; zero keeps them forever.
+func New(format, root string, retention time.Duration) (Sink, error) {
+	switch format {
+	case "", FormatDir:
+		return NewDirSink(root, retention), nil
+	case FormatTar:
+		return NewTarSink(root, retention), nil
+	default:
+		return nil, fmt.Errorf("unknown archive format '%s': must be one of %s, %s", format, FormatDir, FormatTar)
+	}
+}
+
+// Multi stores objects in several sinks; an object is only considered
+// archived once every sink has stored it
+type Multi []Sink
+
+// Store archives the object in every sink
+func (m Multi) Store(ctx context.Context, entry Entry, obj *unstructured.Unstructured) error {
+	for _, sink := range m {
+		if err := sink.Store(ctx, entry, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush flushes every sink, even if some of them fail
+func (m Multi) Flush(runID string) error {
+	var errs []error
+	for _, sink := range m {
+		if err := sink.Flush(runID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every sink, even if some of them fail
+func (m Multi) Close() error {
+	var errs []error
+	for _, sink := range m {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NewRunID returns a sortable identifier for a cleanup run starting at t. A
+// random suffix keeps runs starting within the same second apart.
+func NewRunID(t time.Time) string {
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	return t.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// Manifest serializes an object as YAML with server-managed fields removed,
+// so it can be re-applied with kubectl
+func Manifest(obj *unstructured.Unstructured) ([]byte, error) {
+	return yaml.Marshal(manifest.Strip(obj).Object)
+}
+
+// manifestPath returns the location of an entry's manifest within a run,
+// organized by namespace and kind
+func manifestPath(entry Entry) string {
+	namespace := entry.Namespace
+	if namespace == "" {
+		namespace = clusterScopedDir
+	}
+	kind := entry.Kind
+	if kind == "" {
+		kind = entry.Resource
+	}
+	return path.Join(namespace, kind, fmt.Sprintf("%s.%s.yaml", entry.Name, entry.RunID))
+}
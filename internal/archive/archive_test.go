@@ -0,0 +1,264 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func newTestObject() *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]interface{}{
+				"name":              "settings",
+				"namespace":         "default",
+				"uid":               "1234",
+				"resourceVersion":   "42",
+				"creationTimestamp": "2024-01-01T00:00:00Z",
+				"labels":            map[string]interface{}{"app": "demo"},
+				"managedFields":     []interface{}{map[string]interface{}{"manager": "kubectl"}},
+			},
+			"data":   map[string]interface{}{"key": "value"},
+			"status": map[string]interface{}{"phase": "Active"},
+		},
+	}
+}
+
+func newTestEntry(runID string, t time.Time) Entry {
+	return Entry{
+		RunID:     runID,
+		Time:      t,
+		Version:   "v1",
+		Resource:  "configmaps",
+		Kind:      "ConfigMap",
+		Namespace: "default",
+		Name:      "settings",
+		UID:       "1234",
+		Reason:    "TTL expired",
+		RuleID:    "temp-configmaps",
+	}
+}
+
+func TestNew(t *testing.T) {
+	sink, err := New("", t.TempDir(), 0)
+	require.NoError(t, err)
+	assert.IsType(t, &DirSink{}, sink)
+
+	sink, err = New(FormatTar, t.TempDir(), 0)
+	require.NoError(t, err)
+	assert.IsType(t, &TarSink{}, sink)
+
+	_, err = New("zip", t.TempDir(), 0)
+	assert.Error(t, err)
+}
+
+func TestManifestPath(t *testing.T) {
+	entry := newTestEntry("20240301T120000Z", time.Now())
+	assert.Equal(t, "default/ConfigMap/settings.20240301T120000Z.yaml", manifestPath(entry))
+
+	entry.Namespace = ""
+	entry.Kind = "Namespace"
+	assert.Equal(t, "_cluster/Namespace/settings.20240301T120000Z.yaml", manifestPath(entry))
+}
+
+func TestDirSink(t *testing.T) {
+	root := t.TempDir()
+	sink := NewDirSink(root, 0)
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	runID := "20240301T120000Z"
+	require.NoError(t, sink.Store(context.Background(), newTestEntry(runID, now), newTestObject()))
+	require.NoError(t, sink.Flush(runID))
+
+	data, err := os.ReadFile(filepath.Join(root, "2024-03-01", "default", "ConfigMap", "settings.20240301T120000Z.yaml"))
+	require.NoError(t, err)
+
+	var manifest map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(data, &manifest))
+	assert.Equal(t, "ConfigMap", manifest["kind"])
+	assert.NotContains(t, manifest, "status")
+
+	entries := readIndex(t, filepath.Join(root, "2024-03-01", IndexFile))
+	require.Len(t, entries, 1)
+	assert.Equal(t, "temp-configmaps", entries[0].RuleID)
+	assert.Equal(t, "TTL expired", entries[0].Reason)
+	assert.Equal(t, "2024-03-01/default/ConfigMap/settings.20240301T120000Z.yaml", entries[0].Path)
+}
+
+func TestDirSinkRetention(t *testing.T) {
+	root := t.TempDir()
+	sink := NewDirSink(root, 48*time.Hour)
+
+	old := time.Now().UTC().AddDate(0, 0, -5)
+	recent := time.Now().UTC()
+	ctx := context.Background()
+	require.NoError(t, sink.Store(ctx, newTestEntry(NewRunID(old), old), newTestObject()))
+	recentRun := NewRunID(recent)
+	require.NoError(t, sink.Store(ctx, newTestEntry(recentRun, recent), newTestObject()))
+	require.NoError(t, sink.Flush(recentRun))
+
+	assert.NoDirExists(t, filepath.Join(root, old.Format(dateLayout)))
+	assert.DirExists(t, filepath.Join(root, recent.Format(dateLayout)))
+}
+
+func TestTarSink(t *testing.T) {
+	root := t.TempDir()
+	sink := NewTarSink(root, 0)
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	runID := "20240301T120000Z"
+	require.NoError(t, sink.Store(context.Background(), newTestEntry(runID, now), newTestObject()))
+	require.NoError(t, sink.Flush(runID))
+
+	// Flushing a run without archived objects does not create a tarball
+	require.NoError(t, sink.Flush("empty"))
+	assert.NoFileExists(t, TarPath(root, "empty"))
+
+	files := readTar(t, TarPath(root, runID))
+	require.Contains(t, files, "default/ConfigMap/settings.20240301T120000Z.yaml")
+	require.Contains(t, files, IndexFile)
+
+	var entry Entry
+	require.NoError(t, json.Unmarshal(files[IndexFile], &entry))
+	assert.Equal(t, "temp-configmaps", entry.RuleID)
+	assert.Equal(t, "default/ConfigMap/settings.20240301T120000Z.yaml", entry.Path)
+}
+
+func TestTarSinkClose(t *testing.T) {
+	root := t.TempDir()
+	sink := NewTarSink(root, 0)
+
+	now := time.Now()
+	runID := NewRunID(now)
+	require.NoError(t, sink.Store(context.Background(), newTestEntry(runID, now), newTestObject()))
+	require.NoError(t, sink.Close())
+
+	// The run was never flushed, closing completes it
+	files := readTar(t, TarPath(root, runID))
+	require.Contains(t, files, IndexFile)
+	assert.Len(t, readIndexData(t, files[IndexFile]), 1)
+}
+
+func TestNewRunID(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	first, second := NewRunID(now), NewRunID(now)
+	assert.NotEqual(t, first, second, "runs starting within the same second")
+	assert.Regexp(t, `^20240301T120000Z-[0-9a-f]{6}$`, first)
+	assert.Less(t, first, NewRunID(now.Add(time.Second)), "run IDs sort by time")
+}
+
+func TestTarSinkRetention(t *testing.T) {
+	root := t.TempDir()
+	sink := NewTarSink(root, time.Hour)
+
+	stale := TarPath(root, "stale")
+	require.NoError(t, os.WriteFile(stale, nil, 0o600))
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(stale, old, old))
+
+	now := time.Now()
+	runID := NewRunID(now)
+	require.NoError(t, sink.Store(context.Background(), newTestEntry(runID, now), newTestObject()))
+	require.NoError(t, sink.Flush(runID))
+
+	assert.NoFileExists(t, stale)
+	assert.FileExists(t, TarPath(root, runID))
+}
+
+func readIndex(t *testing.T, path string) []Entry {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry Entry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+	return entries
+}
+
+func readIndexData(t *testing.T, data []byte) []Entry {
+	t.Helper()
+	var entries []Entry
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		var entry Entry
+		require.NoError(t, json.Unmarshal(line, &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func readTar(t *testing.T, path string) map[string][]byte {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[header.Name] = data
+	}
+	return files
+}
+
+func TestReadRun(t *testing.T) {
+	for _, format := range []string{FormatDir, FormatTar} {
+		t.Run(format, func(t *testing.T) {
+			root := t.TempDir()
+			sink, err := New(format, root, 0)
+			require.NoError(t, err)
+
+			now := time.Now().UTC()
+			runID := NewRunID(now)
+			ctx := context.Background()
+			require.NoError(t, sink.Store(ctx, newTestEntry(runID, now), newTestObject()))
+			other := newTestEntry("other", now)
+			require.NoError(t, sink.Store(ctx, other, newTestObject()))
+			require.NoError(t, sink.Flush(runID))
+			require.NoError(t, sink.Flush("other"))
+
+			records, err := ReadRun(format, root, runID)
+			require.NoError(t, err)
+			require.Len(t, records, 1)
+			assert.Equal(t, "1234", records[0].Entry.UID)
+			assert.Equal(t, "settings", records[0].Object.GetName())
+			data, _, err := unstructured.NestedStringMap(records[0].Object.Object, "data")
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"key": "value"}, data)
+
+			_, err = ReadRun(format, root, "missing")
+			assert.Error(t, err)
+		})
+	}
+}
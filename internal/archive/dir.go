@@ -0,0 +1,107 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const dateLayout = "2006-01-02"
+
+// DirSink stores manifests as files under <root>/<date>/<namespace>/<kind>/,
+// with an index.jsonl per date directory
+type DirSink struct {
+	root      string
+	retention time.Duration
+	mu        sync.Mutex
+}
+
+// NewDirSink creates a new DirSink
+func NewDirSink(root string, retention time.Duration) *DirSink {
+	return &DirSink{
+		root:      root,
+		retention: retention,
+	}
+}
+
+// Store writes the object's manifest and appends it to the index
+func (s *DirSink) Store(_ context.Context, entry Entry, obj *unstructured.Unstructured) error {
+	manifest, err := Manifest(obj)
+	if err != nil {
+		return fmt.Errorf("failed to serialize manifest: %w", err)
+	}
+
+	date := entry.Time.UTC().Format(dateLayout)
+	entry.Path = path.Join(date, manifestPath(entry))
+
+	file := filepath.Join(s.root, filepath.FromSlash(entry.Path))
+	if err := os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	if err := os.WriteFile(file, manifest, 0o600); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode index entry: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := os.OpenFile(filepath.Join(s.root, date, IndexFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open archive index: %w", err)
+	}
+	defer index.Close()
+
+	if _, err := index.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write archive index: %w", err)
+	}
+	return index.Sync()
+}
+
+// Close does nothing, every manifest is written as it is stored
+func (s *DirSink) Close() error {
+	return nil
+}
+
+// Flush removes date directories older than the retention period
+func (s *DirSink) Flush(_ string) error {
+	if s.retention <= 0 {
+		return nil
+	}
+
+	dirs, err := os.ReadDir(s.root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read archive directory: %w", err)
+	}
+
+	cutoff := time.Now().UTC().Add(-s.retention)
+	for _, dir := range dirs {
+		date, err := time.Parse(dateLayout, dir.Name())
+		if !dir.IsDir() || err != nil {
+			continue
+		}
+		// A date directory holds objects up to the end of that day
+		if date.AddDate(0, 0, 1).Before(cutoff) {
+			logrus.WithField("date", dir.Name()).Info("Removing expired archive")
+			if err := os.RemoveAll(filepath.Join(s.root, dir.Name())); err != nil {
+				return fmt.Errorf("failed to remove expired archive: %w", err)
+			}
+		}
+	}
+	return nil
+}
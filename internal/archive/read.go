@@ -0,0 +1,170 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// Record is an archived object along with its index entry
+type Record struct {
+	Entry  Entry
+	Object *unstructured.Unstructured
+}
+
+// ReadRun loads the objects archived by the given run
+func ReadRun(format, root, runID string) ([]Record, error) {
+	switch format {
+	case "", FormatDir:
+		return readDirRun(root, runID)
+	case FormatTar:
+		return readTarRun(root, runID)
+	default:
+		return nil, fmt.Errorf("unknown archive format '%s': must be one of %s, %s", format, FormatDir, FormatTar)
+	}
+}
+
+func readDirRun(root, runID string) ([]Record, error) {
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive directory: %w", err)
+	}
+
+	// A run may span several date directories if it crossed midnight
+	var records []Record
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(root, dir.Name(), IndexFile))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read archive index: %w", err)
+		}
+
+		entries, err := parseIndex(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive index in %s: %w", dir.Name(), err)
+		}
+		for _, entry := range entries {
+			if entry.RunID != runID {
+				continue
+			}
+			manifest, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(entry.Path)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read manifest: %w", err)
+			}
+			record, err := newRecord(entry, manifest)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+		}
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no archived objects found for run %s", runID)
+	}
+	return records, nil
+}
+
+func readTarRun(root, runID string) ([]Record, error) {
+	f, err := os.Open(TarPath(root, runID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from archive: %w", header.Name, err)
+		}
+		files[header.Name] = data
+	}
+
+	index, ok := files[IndexFile]
+	if !ok {
+		return nil, fmt.Errorf("archive for run %s has no index, the run did not complete", runID)
+	}
+	entries, err := parseIndex(index)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive index: %w", err)
+	}
+
+	records := make([]Record, 0, len(entries))
+	for _, entry := range entries {
+		manifest, ok := files[entry.Path]
+		if !ok {
+			return nil, fmt.Errorf("manifest %s is missing from the archive", entry.Path)
+		}
+		record, err := newRecord(entry, manifest)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func parseIndex(data []byte) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, k int) bool {
+		return entries[i].Time.Before(entries[k].Time)
+	})
+	return entries, nil
+}
+
+func newRecord(entry Entry, manifest []byte) (Record, error) {
+	data, err := yaml.YAMLToJSON(manifest)
+	if err != nil {
+		return Record{}, fmt.Errorf("invalid manifest %s: %w", entry.Path, err)
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(data); err != nil {
+		return Record{}, fmt.Errorf("invalid manifest %s: %w", entry.Path, err)
+	}
+	return Record{Entry: entry, Object: obj}, nil
+}
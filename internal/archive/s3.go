@@ -0,0 +1,381 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// DefaultKeyTemplate is the object key used for manifests uploaded to S3
+	DefaultKeyTemplate = "{{cluster}}/{{date}}/{{namespace}}/{{kind}}/{{name}}.{{run}}.yaml"
+
+	// SSEAES256 encrypts uploads with S3-managed keys
+	SSEAES256 = "AES256"
+	// SSEKMS encrypts uploads with a KMS key
+	SSEKMS = "aws:kms"
+)
+
+// Credentials are the AWS-style access keys used to sign requests
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+var keyPlaceholder = regexp.MustCompile(`{{\s*(\w+)\s*}}`)
+
+// keyPlaceholders are the values available to key templates
+var keyPlaceholders = map[string]func(cluster string, entry Entry) string{
+	"cluster": func(cluster string, _ Entry) string { return cluster },
+	"date":    func(_ string, entry Entry) string { return entry.Time.UTC().Format(dateLayout) },
+	"run":     func(_ string, entry Entry) string { return entry.RunID },
+	"namespace": func(_ string, entry Entry) string {
+		if entry.Namespace == "" {
+			return clusterScopedDir
+		}
+		return entry.Namespace
+	},
+	"group":    func(_ string, entry Entry) string { return entry.Group },
+	"resource": func(_ string, entry Entry) string { return entry.Resource },
+	"kind": func(_ string, entry Entry) string {
+		if entry.Kind == "" {
+			return entry.Resource
+		}
+		return entry.Kind
+	},
+	"name": func(_ string, entry Entry) string { return entry.Name },
+	"uid":  func(_ string, entry Entry) string { return entry.UID },
+}
+
+// S3Config configures uploads to an S3-compatible bucket
+type S3Config struct {
+	// Endpoint is the storage URL, e.g. http://minio:9000. Defaults to AWS S3 in Region.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// PathStyle addresses the bucket in the URL path rather than the host name, as MinIO requires
+	PathStyle   bool
+	KeyTemplate string
+	// Cluster is the value of the {{cluster}} placeholder
+	Cluster string
+	// SSE is the server-side encryption to request: AES256 or aws:kms
+	SSE         string
+	SSEKMSKeyID string
+	// Credentials default to the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+	// AWS_SESSION_TOKEN environment variables
+	Credentials Credentials
+	// QueueSize bounds the number of uploads waiting for an uploader
+	QueueSize int
+	// QueueTimeout is how long Store waits for room in the queue before giving up
+	QueueTimeout time.Duration
+	// UploadTimeout bounds each upload request
+	UploadTimeout time.Duration
+	Uploaders     int
+}
+
+// S3Sink uploads manifests to an S3-compatible bucket through a bounded
+// queue, so slow storage delays deletions by at most the queue and upload
+// timeouts instead of blocking the workers indefinitely
+type S3Sink struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+	signer   *v4.Signer
+
+	// queueMu guards sends on queue against Close closing it
+	queueMu   sync.RWMutex
+	queue     chan *upload
+	closed    bool
+	uploaders sync.WaitGroup
+
+	mu      sync.Mutex
+	entries map[string][]Entry
+}
+
+type upload struct {
+	ctx  context.Context
+	key  string
+	body []byte
+	done chan error
+}
+
+// NewS3Sink validates the configuration and starts the uploaders
+func NewS3Sink(config S3Config) (*S3Sink, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("bucket is required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	if config.KeyTemplate == "" {
+		config.KeyTemplate = DefaultKeyTemplate
+	}
+	if err := validateKeyTemplate(config.KeyTemplate); err != nil {
+		return nil, err
+	}
+	switch config.SSE {
+	case "", SSEAES256:
+		if config.SSEKMSKeyID != "" {
+			return nil, fmt.Errorf("a KMS key ID requires server-side encryption %s", SSEKMS)
+		}
+	case SSEKMS:
+	default:
+		return nil, fmt.Errorf("unknown server-side encryption '%s': must be one of %s, %s", config.SSE, SSEAES256, SSEKMS)
+	}
+	if config.Credentials.AccessKeyID == "" {
+		config.Credentials = Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+	if config.Credentials.AccessKeyID == "" || config.Credentials.SecretAccessKey == "" {
+		return nil, fmt.Errorf("credentials are required: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+	if config.QueueTimeout <= 0 {
+		config.QueueTimeout = 10 * time.Second
+	}
+	if config.UploadTimeout <= 0 {
+		config.UploadTimeout = 30 * time.Second
+	}
+	if config.Uploaders <= 0 {
+		config.Uploaders = 4
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint '%s'", config.Endpoint)
+	}
+
+	s := &S3Sink{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: config.UploadTimeout},
+		// S3 signs the path as sent instead of escaping it a second time
+		signer:  v4.NewSigner(func(o *v4.SignerOptions) { o.DisableURIPathEscaping = true }),
+		queue:   make(chan *upload, config.QueueSize),
+		entries: make(map[string][]Entry),
+	}
+	s.uploaders.Add(config.Uploaders)
+	for i := 0; i < config.Uploaders; i++ {
+		go s.uploader()
+	}
+	return s, nil
+}
+
+// Store uploads the object's manifest and waits for the upload to complete
+func (s *S3Sink) Store(ctx context.Context, entry Entry, obj *unstructured.Unstructured) error {
+	manifest, err := Manifest(obj)
+	if err != nil {
+		return fmt.Errorf("failed to serialize manifest: %w", err)
+	}
+	entry.Path = s.key(entry)
+
+	if err := s.enqueue(ctx, entry.Path, manifest); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.entries[entry.RunID] = append(s.entries[entry.RunID], entry)
+	s.mu.Unlock()
+	return nil
+}
+
+// Flush uploads the run's index to {{cluster}}/index/<run ID>.jsonl. Retention
+// is left to the bucket's lifecycle rules.
+func (s *S3Sink) Flush(runID string) error {
+	s.mu.Lock()
+	entries := s.entries[runID]
+	delete(s.entries, runID)
+	s.mu.Unlock()
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var index []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode index entry: %w", err)
+		}
+		index = append(index, line...)
+		index = append(index, '\n')
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.QueueTimeout+s.config.UploadTimeout)
+	defer cancel()
+	key := strings.TrimPrefix(path.Join(s.config.Cluster, "index", runID+".jsonl"), "/")
+	return s.enqueue(ctx, key, index)
+}
+
+// Close uploads the index of every run that was not flushed, then stops
+// accepting uploads and waits for the uploaders to drain the queue
+func (s *S3Sink) Close() error {
+	s.mu.Lock()
+	runIDs := make([]string, 0, len(s.entries))
+	for runID := range s.entries {
+		runIDs = append(runIDs, runID)
+	}
+	s.mu.Unlock()
+
+	var errs []error
+	for _, runID := range runIDs {
+		if err := s.Flush(runID); err != nil {
+			errs = append(errs, fmt.Errorf("run %s: %w", runID, err))
+		}
+	}
+
+	s.queueMu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.queueMu.Unlock()
+	s.uploaders.Wait()
+	return errors.Join(errs...)
+}
+
+func (s *S3Sink) enqueue(ctx context.Context, key string, body []byte) error {
+	u := &upload{ctx: ctx, key: key, body: body, done: make(chan error, 1)}
+	if err := s.send(ctx, u); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-u.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// send queues an upload, waiting at most the queue timeout for room
+func (s *S3Sink) send(ctx context.Context, u *upload) error {
+	s.queueMu.RLock()
+	defer s.queueMu.RUnlock()
+	if s.closed {
+		return fmt.Errorf("archive sink is closed")
+	}
+
+	timer := time.NewTimer(s.config.QueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case s.queue <- u:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("upload queue is full, gave up after %s", s.config.QueueTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *S3Sink) uploader() {
+	defer s.uploaders.Done()
+	for u := range s.queue {
+		u.done <- s.put(u.ctx, u.key, u.body)
+	}
+}
+
+func (s *S3Sink) put(ctx context.Context, key string, body []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/yaml")
+	if s.config.SSE != "" {
+		req.Header.Set("X-Amz-Server-Side-Encryption", s.config.SSE)
+	}
+	if s.config.SSEKMSKeyID != "" {
+		req.Header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", s.config.SSEKMSKeyID)
+	}
+	if err := s.sign(ctx, req, body, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign upload request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to upload %s: status %d: %s", key, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// sign signs a request with AWS Signature Version 4, along with the payload
+// hash S3 requires in the X-Amz-Content-Sha256 header
+func (s *S3Sink) sign(ctx context.Context, req *http.Request, body []byte, now time.Time) error {
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	credentials := aws.Credentials{
+		AccessKeyID:     s.config.Credentials.AccessKeyID,
+		SecretAccessKey: s.config.Credentials.SecretAccessKey,
+		SessionToken:    s.config.Credentials.SessionToken,
+	}
+	return s.signer.SignHTTP(ctx, credentials, req, payloadHash, "s3", s.config.Region, now)
+}
+
+func (s *S3Sink) objectURL(key string) string {
+	u := *s.endpoint
+	if s.config.PathStyle {
+		u.Path = path.Join("/", u.Path, s.config.Bucket, key)
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+		u.Path = path.Join("/", u.Path, key)
+	}
+	return u.String()
+}
+
+// key renders the key template for an entry
+func (s *S3Sink) key(entry Entry) string {
+	key := keyPlaceholder.ReplaceAllStringFunc(s.config.KeyTemplate, func(match string) string {
+		name := keyPlaceholder.FindStringSubmatch(match)[1]
+		return keyPlaceholders[name](s.config.Cluster, entry)
+	})
+	// Empty placeholders such as an unset cluster name must not leave empty segments
+	return strings.TrimPrefix(path.Clean("/"+key), "/")
+}
+
+func validateKeyTemplate(template string) error {
+	for _, match := range keyPlaceholder.FindAllStringSubmatch(template, -1) {
+		if _, ok := keyPlaceholders[match[1]]; !ok {
+			return fmt.Errorf("unknown placeholder '%s' in key template", match[0])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const tarSuffix = ".tar.gz"
+
+// TarSink stores the manifests of each run in <root>/<run ID>.tar.gz, with
+// the run's index.jsonl written at the end of the tarball
+type TarSink struct {
+	root      string
+	retention time.Duration
+
+	mu      sync.Mutex
+	runs    map[string]*tarRun
+	entries map[string][]Entry
+}
+
+type tarRun struct {
+	file *os.File
+	gz   *gzip.Writer
+	tw   *tar.Writer
+}
+
+// NewTarSink creates a new TarSink
+func NewTarSink(root string, retention time.Duration) *TarSink {
+	return &TarSink{
+		root:      root,
+		retention: retention,
+		runs:      make(map[string]*tarRun),
+		entries:   make(map[string][]Entry),
+	}
+}
+
+// TarPath returns the tarball holding the given run
+func TarPath(root, runID string) string {
+	return filepath.Join(root, runID+tarSuffix)
+}
+
+// Store appends the object's manifest to the run's tarball
+func (s *TarSink) Store(_ context.Context, entry Entry, obj *unstructured.Unstructured) error {
+	manifest, err := Manifest(obj)
+	if err != nil {
+		return fmt.Errorf("failed to serialize manifest: %w", err)
+	}
+	entry.Path = manifestPath(entry)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run, err := s.open(entry.RunID)
+	if err != nil {
+		return err
+	}
+	if err := run.write(entry.Path, manifest, entry.Time); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	s.entries[entry.RunID] = append(s.entries[entry.RunID], entry)
+	return nil
+}
+
+// Flush writes the run's index, closes its tarball and removes tarballs
+// older than the retention period
+func (s *TarSink) Flush(runID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.complete(runID); err != nil {
+		return err
+	}
+	return s.prune()
+}
+
+// Close completes every open run, so that no tarball is left truncated and
+// without an index
+func (s *TarSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for runID := range s.runs {
+		if err := s.complete(runID); err != nil {
+			errs = append(errs, fmt.Errorf("run %s: %w", runID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// complete writes the index of an open run and closes its tarball
+func (s *TarSink) complete(runID string) error {
+	run, ok := s.runs[runID]
+	if !ok {
+		return nil
+	}
+
+	var index []byte
+	for _, entry := range s.entries[runID] {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode index entry: %w", err)
+		}
+		index = append(index, line...)
+		index = append(index, '\n')
+	}
+
+	delete(s.runs, runID)
+	delete(s.entries, runID)
+	if err := run.write(IndexFile, index, time.Now()); err != nil {
+		_ = run.close()
+		return fmt.Errorf("failed to write archive index: %w", err)
+	}
+	if err := run.close(); err != nil {
+		return fmt.Errorf("failed to close archive: %w", err)
+	}
+	return nil
+}
+
+func (s *TarSink) open(runID string) (*tarRun, error) {
+	if run, ok := s.runs[runID]; ok {
+		return run, nil
+	}
+
+	if err := os.MkdirAll(s.root, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	file, err := os.OpenFile(TarPath(s.root, runID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive: %w", err)
+	}
+
+	gz := gzip.NewWriter(file)
+	run := &tarRun{file: file, gz: gz, tw: tar.NewWriter(gz)}
+	s.runs[runID] = run
+	return run, nil
+}
+
+func (s *TarSink) prune() error {
+	if s.retention <= 0 {
+		return nil
+	}
+
+	files, err := os.ReadDir(s.root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read archive directory: %w", err)
+	}
+
+	cutoff := time.Now().Add(-s.retention)
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), tarSuffix) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		logrus.WithField("archive", file.Name()).Info("Removing expired archive")
+		if err := os.Remove(filepath.Join(s.root, file.Name())); err != nil {
+			return fmt.Errorf("failed to remove expired archive: %w", err)
+		}
+	}
+	return nil
+}
+
+// write adds a file to the tarball and flushes it, so manifests already
+// stored survive even if the run never completes
+func (r *tarRun) write(name string, data []byte, modTime time.Time) error {
+	if err := r.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}); err != nil {
+		return err
+	}
+	if _, err := r.tw.Write(data); err != nil {
+		return err
+	}
+	if err := r.tw.Flush(); err != nil {
+		return err
+	}
+	return r.gz.Flush()
+}
+
+func (r *tarRun) close() error {
+	if err := r.tw.Close(); err != nil {
+		_ = r.file.Close()
+		return err
+	}
+	if err := r.gz.Close(); err != nil {
+		_ = r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,154 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Decision is the outcome of evaluating a resource
+type Decision string
+
+// Evaluation outcomes
+const (
+	Deleted       Decision = "deleted"
+	DryRun        Decision = "dry-run"
+	Deferred      Decision = "deferred"
+	Marked        Decision = "marked"
+	ArchiveFailed Decision = "archive-failed"
+	DeleteFailed  Decision = "delete-failed"
+	ActionTaken   Decision = "action-taken"
+	ActionFailed  Decision = "action-failed"
+	NotExpired    Decision = "not-expired"
+	Snoozed       Decision = "snoozed"
+	Protected     Decision = "protected"
+	NoTTL         Decision = "no-ttl"
+	InvalidTTL    Decision = "invalid-ttl"
+	RuleError     Decision = "rule-error"
+)
+
+// Record is a single audit log entry, keyed by the resource's UID
+type Record struct {
+	UID       string    `json:"uid"`
+	Time      time.Time `json:"time"`
+	Group     string    `json:"group,omitempty"`
+	Version   string    `json:"version"`
+	Resource  string    `json:"resource"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name"`
+	Decision  Decision  `json:"decision"`
+	Reason    string    `json:"reason,omitempty"`
+	RuleID    string    `json:"ruleId,omitempty"`
+	// Action is set for resources whose action is not delete
+	Action string `json:"action,omitempty"`
+	// DeleteAt and Remaining are set for resources scheduled for deletion
+	DeleteAt  *time.Time `json:"deleteAt,omitempty"`
+	Remaining string     `json:"remaining,omitempty"`
+}
+
+// Logger appends records as JSON lines to a file, rotating it once it
+// reaches a maximum size
+type Logger struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// New opens the audit log at path. The file is rotated to path.1, path.2, ...
+// once it exceeds maxSize bytes, keeping at most maxBackups rotated files.
+// A maxSize of zero disables rotation.
+func New(path string, maxSize int64, maxBackups int) (*Logger, error) {
+	l := &Logger{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Log appends a record to the audit log
+func (l *Logger) Log(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return nil
+}
+
+// Close closes the audit log
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+func (l *Logger) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// rotate shifts the backups by one, dropping the oldest, and starts a new file
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %w", err)
+	}
+
+	if l.maxBackups > 0 {
+		for i := l.maxBackups - 1; i >= 1; i-- {
+			if err := os.Rename(l.backup(i), l.backup(i+1)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to rotate audit log: %w", err)
+			}
+		}
+		if err := os.Rename(l.path, l.backup(1)); err != nil {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	} else if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+
+	return l.open()
+}
+
+func (l *Logger) backup(i int) string {
+	return fmt.Sprintf("%s.%d", l.path, i)
+}
@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readRecords(t *testing.T, path string) []Record {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	logger, err := New(path, 0, 0)
+	require.NoError(t, err)
+
+	deleteAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, logger.Log(Record{UID: "1", Name: "kept", Decision: NoTTL}))
+	require.NoError(t, logger.Log(Record{UID: "2", Name: "pending", Decision: NotExpired, DeleteAt: &deleteAt, Remaining: "1h0m0s"}))
+	require.NoError(t, logger.Close())
+
+	// Reopening appends to the existing log
+	logger, err = New(path, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, logger.Log(Record{UID: "3", Name: "gone", Decision: Deleted}))
+	require.NoError(t, logger.Close())
+
+	records := readRecords(t, path)
+	require.Len(t, records, 3)
+	assert.Equal(t, NoTTL, records[0].Decision)
+	assert.Nil(t, records[0].DeleteAt)
+	assert.Equal(t, deleteAt, *records[1].DeleteAt)
+	assert.Equal(t, "1h0m0s", records[1].Remaining)
+	assert.Equal(t, "3", records[2].UID)
+}
+
+func TestLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	record := Record{UID: "1234", Name: "test", Decision: NoTTL}
+	line, err := json.Marshal(record)
+	require.NoError(t, err)
+
+	// Room for two records per file
+	logger, err := New(path, int64(2*(len(line)+1)), 2)
+	require.NoError(t, err)
+	for i := 0; i < 7; i++ {
+		require.NoError(t, logger.Log(record))
+	}
+	require.NoError(t, logger.Close())
+
+	assert.Len(t, readRecords(t, path), 1)
+	assert.Len(t, readRecords(t, path+".1"), 2)
+	assert.Len(t, readRecords(t, path+".2"), 2)
+	assert.NoFileExists(t, path+".3")
+}
+
+func TestLogRotationWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	logger, err := New(path, 1, 0)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, logger.Log(Record{UID: "1234", Decision: NoTTL}))
+	}
+	require.NoError(t, logger.Close())
+
+	assert.Len(t, readRecords(t, path), 1)
+	assert.NoFileExists(t, path+".1")
+}
@@ -0,0 +1,345 @@
+package crd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/fieldmanager"
+	"github.com/blaxel-ai/kube-janitor-go/internal/metrics"
+	"github.com/blaxel-ai/kube-janitor-go/internal/rules"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+)
+
+// resyncPeriod is how often the informers replay every rule resource, which
+// retries status updates that failed
+const resyncPeriod = 10 * time.Minute
+
+// Controller compiles the rules file and the rule resources into a single
+// engine, which it rebuilds whenever a rule resource changes.
+//
+// Rules are evaluated in order: the rules file first, then ClusterJanitorRules
+// and finally JanitorRules, each sorted by name, so that cluster administrators'
+// rules take precedence over those of the teams.
+type Controller struct {
+	client    dynamic.Interface
+	fileRules []rules.Rule
+	options   []rules.Option
+	apply     func(*rules.Engine)
+
+	mu sync.Mutex
+	// resources maps the IDs of the rules in use to the resource they come
+	// from. A resource enabling a built-in policy may define several rules.
+	resources map[string]ruleResource
+}
+
+// ruleResource identifies a rule resource
+type ruleResource struct {
+	gvr       schema.GroupVersionResource
+	namespace string
+	name      string
+}
+
+// NewController creates a controller that passes every engine it builds to apply
+func NewController(client dynamic.Interface, fileRules []rules.Rule, apply func(*rules.Engine), opts ...rules.Option) *Controller {
+	return &Controller{
+		client:    client,
+		fileRules: fileRules,
+		options:   opts,
+		apply:     apply,
+		resources: make(map[string]ruleResource),
+	}
+}
+
+// Load lists the rule resources once and builds the engine, without watching
+// them or updating their status
+func (c *Controller) Load(ctx context.Context) error {
+	var objects []*unstructured.Unstructured
+	for _, gvr := range []schema.GroupVersionResource{ClusterJanitorRules, JanitorRules} {
+		list, err := c.client.Resource(gvr).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", gvr.Resource, err)
+		}
+		for i := range list.Items {
+			objects = append(objects, &list.Items[i])
+		}
+	}
+
+	return c.rebuild(ctx, objects, false)
+}
+
+// Run loads the rule resources, then watches them until the context is done.
+// It returns once the watches are in sync.
+func (c *Controller) Run(ctx context.Context) error {
+	if err := c.Load(ctx); err != nil {
+		return err
+	}
+
+	// Events only request a rebuild, so that a burst of them, such as a resync,
+	// results in a single one
+	changed := make(chan struct{}, 1)
+	requestSync := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(c.client, resyncPeriod)
+	informers := make(map[schema.GroupVersionResource]cache.SharedIndexInformer)
+	for _, gvr := range []schema.GroupVersionResource{ClusterJanitorRules, JanitorRules} {
+		informer := factory.ForResource(gvr).Informer()
+		_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(interface{}) { requestSync() },
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				// Skip status updates, including ours, but not resyncs
+				oldRule, _ := oldObj.(*unstructured.Unstructured)
+				newRule, _ := newObj.(*unstructured.Unstructured)
+				if oldRule != nil && newRule != nil &&
+					oldRule.GetGeneration() == newRule.GetGeneration() &&
+					oldRule.GetResourceVersion() != newRule.GetResourceVersion() {
+					return
+				}
+				requestSync()
+			},
+			DeleteFunc: func(interface{}) { requestSync() },
+		})
+		if err != nil {
+			return fmt.Errorf("failed to watch %s: %w", gvr.Resource, err)
+		}
+		informers[gvr] = informer
+	}
+
+	factory.Start(ctx.Done())
+	for gvr, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("failed to sync %s", gvr.Resource)
+		}
+	}
+
+	c.sync(ctx, informers)
+	go func() {
+		for {
+			select {
+			case <-changed:
+				c.sync(ctx, informers)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// sync rebuilds the engine from the informer caches and updates the status
+// of the rule resources
+func (c *Controller) sync(ctx context.Context, informers map[schema.GroupVersionResource]cache.SharedIndexInformer) {
+	var objects []*unstructured.Unstructured
+	for _, gvr := range []schema.GroupVersionResource{ClusterJanitorRules, JanitorRules} {
+		for _, item := range informers[gvr].GetStore().List() {
+			if obj, ok := item.(*unstructured.Unstructured); ok {
+				objects = append(objects, obj)
+			}
+		}
+	}
+
+	if err := c.rebuild(ctx, objects, true); err != nil {
+		logrus.WithError(err).Error("Failed to rebuild rules")
+		metrics.Errors.WithLabelValues("rules").Inc()
+	}
+}
+
+// rebuild compiles the rules file and the rule resources into a new engine.
+// Resources whose rule does not compile are left out, and their Ready
+// condition reports the error when updateStatus is set.
+func (c *Controller) rebuild(ctx context.Context, objects []*unstructured.Unstructured, updateStatus bool) error {
+	sort.Slice(objects, func(i, k int) bool {
+		a, b := objects[i], objects[k]
+		if (a.GetNamespace() == "") != (b.GetNamespace() == "") {
+			return a.GetNamespace() == ""
+		}
+		return RuleID(a) < RuleID(b)
+	})
+
+	ruleSet := append([]rules.Rule(nil), c.fileRules...)
+	// Where each rule ID comes from, so that a resource reusing it is rejected
+	owners := make(map[string]string, len(ruleSet))
+	for _, rule := range ruleSet {
+		owners[rule.ID] = "the rules file"
+	}
+
+	resources := make(map[string]ruleResource)
+	compileErrors := make([]error, len(objects))
+	for i, obj := range objects {
+		var expanded []rules.Rule
+		rule, err := ruleFromObject(obj)
+		if err == nil {
+			expanded, err = rules.ExpandBuiltins([]rules.Rule{rule})
+		}
+		for _, rule := range expanded {
+			if owner, ok := owners[rule.ID]; err == nil && ok {
+				err = fmt.Errorf("rule ID '%s' is already used by %s", rule.ID, owner)
+			}
+		}
+		if err == nil {
+			_, err = rules.New(expanded, c.options...)
+		}
+		compileErrors[i] = err
+		if err != nil {
+			logrus.WithError(err).WithField("rule", RuleID(obj)).Warn("Ignoring invalid rule resource")
+			continue
+		}
+
+		ruleSet = append(ruleSet, expanded...)
+		for _, rule := range expanded {
+			owners[rule.ID] = fmt.Sprintf("rule resource '%s'", RuleID(obj))
+			resources[rule.ID] = ruleResource{gvr: resourceOf(obj), namespace: obj.GetNamespace(), name: obj.GetName()}
+		}
+	}
+
+	engine, err := rules.New(ruleSet, c.options...)
+	if err != nil {
+		return err
+	}
+	c.apply(engine)
+	engine.PruneStats()
+
+	c.mu.Lock()
+	c.resources = resources
+	c.mu.Unlock()
+	logrus.WithField("rules", len(ruleSet)).Debug("Rules rebuilt")
+
+	if updateStatus {
+		for i, obj := range objects {
+			c.updateReady(ctx, obj, compileErrors[i])
+		}
+	}
+	return nil
+}
+
+// updateReady sets the Ready condition of a rule resource, unless it is
+// already up to date for the resource's generation
+func (c *Controller) updateReady(ctx context.Context, obj *unstructured.Unstructured, compileErr error) {
+	condition := metav1.Condition{
+		Type:               ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonCompiled,
+		Message:            "Rule compiled and in use",
+		ObservedGeneration: obj.GetGeneration(),
+	}
+	if compileErr != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonCompileError
+		condition.Message = compileErr.Error()
+	}
+
+	status, err := getStatus(obj)
+	if err == nil && status.ObservedGeneration == obj.GetGeneration() {
+		current := meta.FindStatusCondition(status.Conditions, ConditionReady)
+		if current != nil && current.Status == condition.Status && current.Message == condition.Message {
+			return
+		}
+	}
+
+	err = c.updateStatus(ctx, resourceOf(obj), obj.GetNamespace(), obj.GetName(), func(status *Status, generation int64) {
+		status.ObservedGeneration = generation
+		condition.ObservedGeneration = generation
+		meta.SetStatusCondition(&status.Conditions, condition)
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("rule", RuleID(obj)).Warn("Failed to update rule status")
+		metrics.Errors.WithLabelValues("rule_status").Inc()
+	}
+}
+
+// RuleStats counts the outcomes of a rule during a cleanup run
+type RuleStats struct {
+	// Matched counts the objects the rule matched for the first time
+	Matched int64
+	Deleted int64
+}
+
+// Report adds the counts of a cleanup run to the status of the rule
+// resources, with a single write per resource whose counts changed. Rules
+// from the rules file are ignored.
+func (c *Controller) Report(ctx context.Context, stats map[string]RuleStats) {
+	c.mu.Lock()
+	resources := c.resources
+	c.mu.Unlock()
+
+	// The rules of a built-in policy all count for its resource
+	totals := make(map[ruleResource]RuleStats)
+	for id, s := range stats {
+		resource, ok := resources[id]
+		if !ok {
+			continue
+		}
+		total := totals[resource]
+		total.Matched += s.Matched
+		total.Deleted += s.Deleted
+		totals[resource] = total
+	}
+
+	now := metav1.Now()
+	for resource, s := range totals {
+		if s.Matched == 0 && s.Deleted == 0 {
+			continue
+		}
+
+		err := c.updateStatus(ctx, resource.gvr, resource.namespace, resource.name, func(status *Status, _ int64) {
+			status.MatchCount += s.Matched
+			status.DeleteCount += s.Deleted
+			if s.Matched > 0 {
+				status.LastMatchTime = &now
+			}
+		})
+		if err != nil {
+			logrus.WithError(err).WithField("rule", resource.name).Warn("Failed to update rule status")
+			metrics.Errors.WithLabelValues("rule_status").Inc()
+		}
+	}
+}
+
+// updateStatus applies a change to the latest status of a rule resource,
+// retrying on conflicts
+func (c *Controller) updateStatus(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string, update func(status *Status, generation int64)) error {
+	client := c.client.Resource(gvr)
+	var resource dynamic.ResourceInterface = client
+	if namespace != "" {
+		resource = client.Namespace(namespace)
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, err := resource.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		status, err := getStatus(obj)
+		if err != nil {
+			return fmt.Errorf("invalid status: %w", err)
+		}
+		update(&status, obj.GetGeneration())
+		if err := setStatus(obj, status); err != nil {
+			return err
+		}
+		_, err = resource.UpdateStatus(ctx, obj, metav1.UpdateOptions{FieldManager: fieldmanager.Name})
+		return err
+	})
+}
+
+func resourceOf(obj *unstructured.Unstructured) schema.GroupVersionResource {
+	if obj.GetNamespace() != "" {
+		return JanitorRules
+	}
+	return ClusterJanitorRules
+}
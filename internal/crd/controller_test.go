@@ -0,0 +1,230 @@
+package crd
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/fieldmanager"
+	"github.com/blaxel-ai/kube-janitor-go/internal/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func newFakeClient(objects ...runtime.Object) *fake.FakeDynamicClient {
+	return fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		JanitorRules:        "JanitorRuleList",
+		ClusterJanitorRules: "ClusterJanitorRuleList",
+	}, objects...)
+}
+
+// statusRecorder records the field manager of status updates, which the fake
+// dynamic client drops.
+type statusRecorder struct {
+	dynamic.Interface
+	managers *[]string
+}
+
+func (r statusRecorder) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return statusRecorderResource{r.Interface.Resource(gvr), r.managers}
+}
+
+type statusRecorderResource struct {
+	dynamic.NamespaceableResourceInterface
+	managers *[]string
+}
+
+func (r statusRecorderResource) Namespace(namespace string) dynamic.ResourceInterface {
+	return statusRecorderNamespace{r.NamespaceableResourceInterface.Namespace(namespace), r.managers}
+}
+
+func (r statusRecorderResource) UpdateStatus(ctx context.Context, obj *unstructured.Unstructured, opts metav1.UpdateOptions) (*unstructured.Unstructured, error) {
+	*r.managers = append(*r.managers, opts.FieldManager)
+	return r.NamespaceableResourceInterface.UpdateStatus(ctx, obj, opts)
+}
+
+type statusRecorderNamespace struct {
+	dynamic.ResourceInterface
+	managers *[]string
+}
+
+func (r statusRecorderNamespace) UpdateStatus(ctx context.Context, obj *unstructured.Unstructured, opts metav1.UpdateOptions) (*unstructured.Unstructured, error) {
+	*r.managers = append(*r.managers, opts.FieldManager)
+	return r.ResourceInterface.UpdateStatus(ctx, obj, opts)
+}
+
+func newPod(namespace, name string) *unstructured.Unstructured {
+	pod := &unstructured.Unstructured{}
+	pod.SetAPIVersion("v1")
+	pod.SetKind("Pod")
+	pod.SetNamespace(namespace)
+	pod.SetName(name)
+	return pod
+}
+
+func ruleIDs(engine *rules.Engine, obj *unstructured.Unstructured) []string {
+	var ids []string
+	for _, trace := range engine.Trace(context.Background(), obj) {
+		ids = append(ids, trace.Rule.ID)
+	}
+	return ids
+}
+
+func TestLoad(t *testing.T) {
+	podSpec := func(expression string) map[string]interface{} {
+		return map[string]interface{}{
+			"resources":  []interface{}{"pods"},
+			"expression": expression,
+			"ttl":        "1h",
+		}
+	}
+	client := newFakeClient(
+		newRuleObject("JanitorRule", "team-a", "previews", podSpec("true")),
+		newRuleObject("JanitorRule", "team-a", "broken", podSpec("object.metadata.name ==")),
+		newRuleObject("ClusterJanitorRule", "", "b-cluster", podSpec("true")),
+		newRuleObject("ClusterJanitorRule", "", "a-cluster", podSpec("false")),
+		newRuleObject("ClusterJanitorRule", "", "file-rule", podSpec("true")),
+	)
+
+	var engine *rules.Engine
+	controller := NewController(client, []rules.Rule{
+		{ID: "file-rule", Resources: []string{"pods"}, Expression: "false", TTL: "1d"},
+	}, func(e *rules.Engine) { engine = e })
+
+	require.NoError(t, controller.Load(context.Background()))
+	require.NotNil(t, engine)
+
+	// The rules file comes first, then cluster rules and namespaced rules by name,
+	// without the invalid rule and the one reusing a rules file ID
+	assert.Equal(t, []string{"file-rule", "a-cluster", "b-cluster", "team-a/previews"},
+		ruleIDs(engine, newPod("team-a", "web")))
+
+	match, err := engine.Match(context.Background(), newPod("team-a", "web"))
+	require.NoError(t, err)
+	require.NotNil(t, match)
+	assert.Equal(t, "b-cluster", match.Rule.ID)
+
+	// Namespaced rules never apply outside their namespace
+	traces := engine.Trace(context.Background(), newPod("team-b", "web"))
+	assert.Equal(t, "rule only applies to namespace team-a", traces[3].NotSelected)
+
+	// Load does not touch the status
+	obj, err := client.Resource(JanitorRules).Namespace("team-a").Get(context.Background(), "broken", metav1.GetOptions{})
+	require.NoError(t, err)
+	_, found := obj.Object["status"]
+	assert.False(t, found)
+}
+
+func TestLoadRejectsRuleIDsOfOtherResources(t *testing.T) {
+	// The second rule of the built-in policy is team-a/jobs-pods
+	client := newFakeClient(
+		newRuleObject("JanitorRule", "team-a", "jobs", map[string]interface{}{"builtin": "completed-jobs"}),
+		newRuleObject("JanitorRule", "team-a", "jobs-pods", map[string]interface{}{
+			"resources": []interface{}{"pods"}, "expression": "true", "ttl": "1h",
+		}),
+	)
+
+	var engine *rules.Engine
+	controller := NewController(client, nil, func(e *rules.Engine) { engine = e })
+	require.NoError(t, controller.Load(context.Background()))
+	require.NotNil(t, engine)
+
+	pod := newPod("team-a", "web")
+	assert.Equal(t, []string{"team-a/jobs", "team-a/jobs-pods"}, ruleIDs(engine, pod))
+	match, err := engine.Match(context.Background(), pod)
+	require.NoError(t, err)
+	assert.Nil(t, match)
+}
+
+func TestRunUpdatesStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := newFakeClient(
+		newRuleObject("ClusterJanitorRule", "", "valid", map[string]interface{}{
+			"resources": []interface{}{"pods"}, "expression": "true", "ttl": "1h",
+		}),
+		newRuleObject("JanitorRule", "team-a", "invalid", map[string]interface{}{
+			"resources": []interface{}{"pods"}, "expression": "true", "ttl": "forever",
+		}),
+		newRuleObject("JanitorRule", "team-a", "jobs", map[string]interface{}{"builtin": "completed-jobs"}),
+	)
+
+	var engine atomic.Pointer[rules.Engine]
+	var managers []string
+	controller := NewController(statusRecorder{client, &managers}, nil, engine.Store)
+	require.NoError(t, controller.Run(ctx))
+	require.NotNil(t, engine.Load())
+
+	ready := func(gvr schema.GroupVersionResource, namespace, name string) (*metav1.Condition, Status) {
+		obj, err := client.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		require.NoError(t, err)
+		status, err := getStatus(obj)
+		require.NoError(t, err)
+		return meta.FindStatusCondition(status.Conditions, ConditionReady), status
+	}
+
+	condition, status := ready(ClusterJanitorRules, "", "valid")
+	require.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+	assert.Equal(t, int64(1), status.ObservedGeneration)
+
+	condition, _ = ready(JanitorRules, "team-a", "invalid")
+	require.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, reasonCompileError, condition.Reason)
+	assert.Contains(t, condition.Message, "invalid TTL 'forever'")
+
+	// Counts add up over runs and skip rules that are not resources
+	controller.Report(ctx, map[string]RuleStats{
+		"valid":         {Matched: 3, Deleted: 1},
+		"team-a/absent": {Matched: 1},
+	})
+	controller.Report(ctx, map[string]RuleStats{"valid": {Matched: 2}})
+
+	_, status = ready(ClusterJanitorRules, "", "valid")
+	assert.Equal(t, int64(5), status.MatchCount)
+	assert.Equal(t, int64(1), status.DeleteCount)
+	assert.NotNil(t, status.LastMatchTime)
+
+	// The rules of a built-in policy all count for its resource
+	controller.Report(ctx, map[string]RuleStats{
+		"team-a/jobs":      {Matched: 1, Deleted: 1},
+		"team-a/jobs-pods": {Matched: 2, Deleted: 2},
+	})
+	condition, status = ready(JanitorRules, "team-a", "jobs")
+	require.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+	assert.Equal(t, int64(3), status.MatchCount)
+	assert.Equal(t, int64(3), status.DeleteCount)
+
+	// Runs without new matches or deletions do not write the status
+	updates := len(client.Actions())
+	controller.Report(ctx, map[string]RuleStats{"valid": {}, "team-a/jobs": {}})
+	assert.Len(t, client.Actions(), updates)
+
+	// Status updates are attributed to the janitor's field manager
+	require.NotEmpty(t, managers)
+	for _, manager := range managers {
+		assert.Equal(t, fieldmanager.Name, manager)
+	}
+
+	// New rule resources are picked up by the watch
+	_, err := client.Resource(ClusterJanitorRules).Create(ctx, newRuleObject("ClusterJanitorRule", "", "added", map[string]interface{}{
+		"resources": []interface{}{"pods"}, "expression": "true", "ttl": "1h",
+	}), metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		condition, _ := ready(ClusterJanitorRules, "", "added")
+		return condition != nil && condition.Status == metav1.ConditionTrue
+	}, 5*time.Second, 10*time.Millisecond)
+}
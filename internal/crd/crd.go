@@ -0,0 +1,100 @@
+// Package crd loads cleanup rules from JanitorRule and ClusterJanitorRule
+// resources, so that teams can manage their own rules without access to the
+// rules file.
+package crd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/rules"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// Group is the API group of the rule resources
+	Group = "janitor.blaxel.ai"
+	// Version is the served version of the rule resources
+	Version = "v1alpha1"
+)
+
+var (
+	// JanitorRules are namespaced rules, which only apply to objects in their own namespace
+	JanitorRules = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "janitorrules"}
+	// ClusterJanitorRules are cluster-wide rules, like those of the rules file
+	ClusterJanitorRules = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "clusterjanitorrules"}
+)
+
+// RuleID returns the ID of the rule defined by a resource: its name for
+// ClusterJanitorRules and "<namespace>/<name>" for JanitorRules
+func RuleID(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() != "" {
+		return obj.GetNamespace() + "/" + obj.GetName()
+	}
+	return obj.GetName()
+}
+
+// ruleFromObject converts the spec of a rule resource, which has the same
+// fields as an entry of the rules file without the id
+func ruleFromObject(obj *unstructured.Unstructured) (rules.Rule, error) {
+	var rule rules.Rule
+
+	spec, _, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil {
+		return rule, fmt.Errorf("invalid spec: %w", err)
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return rule, fmt.Errorf("invalid spec: %w", err)
+	}
+	if err := json.Unmarshal(data, &rule); err != nil {
+		return rule, fmt.Errorf("invalid spec: %w", err)
+	}
+
+	rule.ID = RuleID(obj)
+	rule.Namespace = obj.GetNamespace()
+	return rule, nil
+}
+
+// Status is the status of a rule resource
+type Status struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+	// MatchCount and DeleteCount add up the objects the rule matched and
+	// deleted over all cleanup runs. An object is counted once while it
+	// keeps matching.
+	MatchCount  int64 `json:"matchCount,omitempty"`
+	DeleteCount int64 `json:"deleteCount,omitempty"`
+	// LastMatchTime is when the rule last matched a new object
+	LastMatchTime *metav1.Time `json:"lastMatchTime,omitempty"`
+}
+
+const (
+	// ConditionReady tells whether the rule compiled and is in use
+	ConditionReady = "Ready"
+
+	reasonCompiled     = "Compiled"
+	reasonCompileError = "CompileError"
+)
+
+func getStatus(obj *unstructured.Unstructured) (Status, error) {
+	var status Status
+	content, ok := obj.Object["status"].(map[string]interface{})
+	if !ok {
+		return status, nil
+	}
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, &status)
+	return status, err
+}
+
+func setStatus(obj *unstructured.Unstructured, status Status) error {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return err
+	}
+	obj.Object["status"] = content
+	return nil
+}
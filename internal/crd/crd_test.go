@@ -0,0 +1,99 @@
+package crd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newRuleObject(kind, namespace, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	obj.SetAPIVersion(Group + "/" + Version)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetGeneration(1)
+	return obj
+}
+
+func TestRuleFromObject(t *testing.T) {
+	obj := newRuleObject("JanitorRule", "team-a", "previews", map[string]interface{}{
+		"resources":     []interface{}{"deployments"},
+		"expression":    `object.metadata.name.startsWith("preview-")`,
+		"ttl":           "2d",
+		"ttlExpression": `"3d"`,
+		"ttlFrom":       "lastUpdate",
+		"labelSelector": map[string]interface{}{
+			"matchLabels": map[string]interface{}{"app": "preview"},
+		},
+		// Neither may be set from the spec
+		"id":        "other",
+		"namespace": "team-b",
+	})
+
+	rule, err := ruleFromObject(obj)
+	require.NoError(t, err)
+	assert.Equal(t, "team-a/previews", rule.ID)
+	assert.Equal(t, "team-a", rule.Namespace)
+	assert.Equal(t, []string{"deployments"}, rule.Resources)
+	assert.Equal(t, `object.metadata.name.startsWith("preview-")`, rule.Expression)
+	assert.Equal(t, "2d", rule.TTL)
+	assert.Equal(t, `"3d"`, rule.TTLExpression)
+	assert.Equal(t, "lastUpdate", rule.TTLFrom)
+	assert.Equal(t, map[string]string{"app": "preview"}, rule.LabelSelector.MatchLabels)
+
+	cluster := newRuleObject("ClusterJanitorRule", "", "pvcs", map[string]interface{}{"ttl": "7d"})
+	rule, err = ruleFromObject(cluster)
+	require.NoError(t, err)
+	assert.Equal(t, "pvcs", rule.ID)
+	assert.Empty(t, rule.Namespace)
+
+	builtin := newRuleObject("JanitorRule", "team-a", "jobs", map[string]interface{}{"builtin": "completed-jobs", "ttl": "2h"})
+	rule, err = ruleFromObject(builtin)
+	require.NoError(t, err)
+	assert.Equal(t, "completed-jobs", rule.Builtin)
+	assert.Equal(t, "2h", rule.TTL)
+
+	invalid := newRuleObject("ClusterJanitorRule", "", "broken", map[string]interface{}{"resources": "pods"})
+	_, err = ruleFromObject(invalid)
+	assert.Error(t, err)
+}
+
+func TestStatusRoundTrip(t *testing.T) {
+	obj := newRuleObject("ClusterJanitorRule", "", "pvcs", map[string]interface{}{})
+
+	status, err := getStatus(obj)
+	require.NoError(t, err)
+	assert.Equal(t, Status{}, status)
+
+	now := metav1.Now().Rfc3339Copy()
+	want := Status{
+		ObservedGeneration: 2,
+		Conditions: []metav1.Condition{{
+			Type:               ConditionReady,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonCompiled,
+			Message:            "Rule compiled and in use",
+			LastTransitionTime: now,
+		}},
+		MatchCount:    3,
+		DeleteCount:   1,
+		LastMatchTime: &now,
+	}
+	require.NoError(t, setStatus(obj, want))
+
+	got, err := getStatus(obj)
+	require.NoError(t, err)
+	require.NotNil(t, got.LastMatchTime)
+	assert.True(t, now.Equal(got.LastMatchTime))
+	require.Len(t, got.Conditions, 1)
+	assert.True(t, now.Equal(&got.Conditions[0].LastTransitionTime))
+
+	// Times come back in the local zone
+	got.LastMatchTime, want.LastMatchTime = nil, nil
+	got.Conditions[0].LastTransitionTime, want.Conditions[0].LastTransitionTime = metav1.Time{}, metav1.Time{}
+	assert.Equal(t, want, got)
+}
@@ -0,0 +1,141 @@
+package expires
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Parser parses absolute expiration times, as used by the janitor/expires and
+// janitor/extend-until annotations. The accepted forms are:
+//
+//   - RFC3339 timestamps: 2026-11-01T18:00:00+01:00
+//   - Local dates and times: 2026-11-01T18:00:00, 2026-11-01 18:00, 2026-11-01
+//   - Any of the above without an offset followed by an IANA zone: 2026-11-01 18:00 Europe/Paris
+//   - Weekdays, optionally with a time: friday, next friday, next friday 18:00
+//   - Unix epoch seconds, with at least 10 digits: 1793552400
+//
+// Times without an offset or zone are interpreted in Location. Shorter
+// numbers, such as a bare year, are rejected rather than read as seconds
+// in 1970.
+type Parser struct {
+	// Location is used for times without an offset or zone (nil means UTC)
+	Location *time.Location
+}
+
+var localLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+var (
+	epochRegex   = regexp.MustCompile(`^\d{10,}$`)
+	weekdayRegex = regexp.MustCompile(`^(?:next\s+)?([a-z]+)(?:\s+(\d{1,2}:\d{2}))?$`)
+)
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// Parse parses an expiration time. Weekdays refer to the first such day
+// after the reference time, which must not move from one run to the next.
+func (p Parser) Parse(value string, reference time.Time) (time.Time, error) {
+	t, _, err := p.parse(value, reference)
+	return t, err
+}
+
+// IsRelative reports whether a valid value is a weekday, whose time depends
+// on the reference time
+func (p Parser) IsRelative(value string) bool {
+	_, relative, err := p.parse(value, time.Time{})
+	return err == nil && relative
+}
+
+func (p Parser) parse(value string, reference time.Time) (time.Time, bool, error) {
+	original := value
+	value = strings.TrimSpace(value)
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	if epochRegex.MatchString(value) {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid epoch seconds '%s': %w", value, err)
+		}
+		return time.Unix(seconds, 0).UTC(), false, nil
+	}
+
+	location := p.Location
+	if location == nil {
+		location = time.UTC
+	}
+	if i := strings.LastIndex(value, " "); i > 0 {
+		if zone, ok := loadZone(value[i+1:]); ok {
+			value, location = strings.TrimSpace(value[:i]), zone
+		}
+	}
+
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t, false, nil
+		}
+	}
+
+	if t, ok := parseWeekday(strings.ToLower(value), reference.In(location)); ok {
+		return t, true, nil
+	}
+
+	return time.Time{}, false, fmt.Errorf("unable to parse expiration time: %s", original)
+}
+
+// loadZone loads an IANA zone name such as Europe/Paris or UTC
+func loadZone(name string) (*time.Location, bool) {
+	// Skip clock times and offsets, which are not zones but would hit the zone database
+	if name == "Local" || strings.IndexFunc(name, unicode.IsLetter) < 0 {
+		return nil, false
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, false
+	}
+	return location, true
+}
+
+// parseWeekday parses "[next] <weekday> [HH:MM]" relative to the reference
+// time, whose location is used for the result
+func parseWeekday(value string, reference time.Time) (time.Time, bool) {
+	match := weekdayRegex.FindStringSubmatch(value)
+	if match == nil {
+		return time.Time{}, false
+	}
+	weekday, ok := weekdays[match[1]]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	var hour, minute int
+	if match[2] != "" {
+		clock, err := time.Parse("15:04", match[2])
+		if err != nil {
+			return time.Time{}, false
+		}
+		hour, minute = clock.Hour(), clock.Minute()
+	}
+
+	days := (int(weekday)-int(reference.Weekday())+6)%7 + 1
+	day := reference.AddDate(0, 0, days)
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, reference.Location()), true
+}
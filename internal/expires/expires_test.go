@@ -0,0 +1,139 @@
+package expires
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// A Wednesday
+	reference := time.Date(2026, 10, 28, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		value    string
+		location *time.Location
+		want     time.Time
+		wantErr  bool
+	}{
+		{
+			name:  "RFC3339",
+			value: "2024-12-31T23:59:59Z",
+			want:  time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name:     "RFC3339 ignores the default timezone",
+			value:    "2024-12-31T23:59:59+01:00",
+			location: newYork,
+			want:     time.Date(2024, 12, 31, 22, 59, 59, 0, time.UTC),
+		},
+		{
+			name:  "date defaults to UTC",
+			value: "2024-12-31",
+			want:  time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "date in the default timezone",
+			value:    "2024-12-31",
+			location: paris,
+			want:     time.Date(2024, 12, 31, 0, 0, 0, 0, paris),
+		},
+		{
+			name:     "local time in the default timezone",
+			value:    "2024-12-31T23:59",
+			location: paris,
+			want:     time.Date(2024, 12, 31, 23, 59, 0, 0, paris),
+		},
+		{
+			name:     "zone suffix overrides the default timezone",
+			value:    "2026-11-01 18:00 Europe/Paris",
+			location: newYork,
+			want:     time.Date(2026, 11, 1, 18, 0, 0, 0, paris),
+		},
+		{
+			name:  "zone suffix on a date",
+			value: "2026-11-01 America/New_York",
+			want:  time.Date(2026, 11, 1, 0, 0, 0, 0, newYork),
+		},
+		{
+			name:  "epoch seconds",
+			value: "1793552400",
+			want:  time.Unix(1793552400, 0).UTC(),
+		},
+		{
+			name:  "weekday",
+			value: "friday",
+			want:  time.Date(2026, 10, 30, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "next weekday with time",
+			value:    "Next Friday 18:00",
+			location: paris,
+			want:     time.Date(2026, 10, 30, 18, 0, 0, 0, paris),
+		},
+		{
+			name:  "same weekday is a week later",
+			value: "next wednesday",
+			want:  time.Date(2026, 11, 4, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "weekday with zone suffix",
+			value: "next monday 09:00 Europe/Paris",
+			want:  time.Date(2026, 11, 2, 9, 0, 0, 0, paris),
+		},
+		{
+			name:    "bare year is not epoch seconds",
+			value:   "2026",
+			wantErr: true,
+		},
+		{
+			name:    "compact date is not epoch seconds",
+			value:   "20261101",
+			wantErr: true,
+		},
+		{
+			name:    "unknown weekday",
+			value:   "next someday",
+			wantErr: true,
+		},
+		{
+			name:    "unknown zone",
+			value:   "2026-11-01 18:00 Mars/Olympus",
+			wantErr: true,
+		},
+		{
+			name:    "invalid",
+			value:   "invalid-date",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parser{Location: tt.location}.Parse(tt.value, reference)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(got), "want %s, got %s", tt.want, got)
+		})
+	}
+}
+
+func TestIsRelative(t *testing.T) {
+	p := Parser{}
+	assert.True(t, p.IsRelative("friday"))
+	assert.True(t, p.IsRelative("next monday 09:00 Europe/Paris"))
+	assert.False(t, p.IsRelative("2026-11-01"))
+	assert.False(t, p.IsRelative("1793552400"))
+	assert.False(t, p.IsRelative("next someday"))
+}
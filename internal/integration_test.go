@@ -228,7 +228,7 @@ func TestIntegrationRulesEngine(t *testing.T) {
 		},
 	}
 
-	rule, ttl := engine.Evaluate(deploymentNoLabel)
+	rule, ttl := engine.Evaluate(context.Background(), deploymentNoLabel)
 	assert.NotNil(t, rule)
 	assert.Equal(t, "require-app-label", rule.ID)
 	assert.Equal(t, 24*time.Hour, ttl)
@@ -243,7 +243,7 @@ func TestIntegrationRulesEngine(t *testing.T) {
 		},
 	}
 
-	rule, ttl = engine.Evaluate(prPod)
+	rule, ttl = engine.Evaluate(context.Background(), prPod)
 	assert.NotNil(t, rule)
 	assert.Equal(t, "cleanup-pr-resources", rule.ID)
 	assert.Equal(t, 4*time.Hour, ttl)
@@ -258,7 +258,7 @@ func TestIntegrationRulesEngine(t *testing.T) {
 		},
 	}
 
-	rule, ttl = engine.Evaluate(normalPod)
+	rule, ttl = engine.Evaluate(context.Background(), normalPod)
 	assert.Nil(t, rule)
 	assert.Equal(t, time.Duration(0), ttl)
 }
@@ -0,0 +1,112 @@
+package janitor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/audit"
+	"github.com/blaxel-ai/kube-janitor-go/internal/fieldmanager"
+	"github.com/blaxel-ai/kube-janitor-go/internal/metrics"
+	"github.com/blaxel-ai/kube-janitor-go/pkg/actions"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// annotationAction overrides the action of the matched rule
+const annotationAction = "janitor/action"
+
+// applyAction sets the action taken once the object expires: the one of its
+// janitor/action annotation, or else the one of the matched rule. Actions
+// that need parameters can only be set by rules.
+func applyAction(obj *unstructured.Unstructured, schedule *deletionSchedule) error {
+	if schedule.actionName == "" {
+		schedule.actionName = actions.Delete
+	}
+
+	name, ok := obj.GetAnnotations()[annotationAction]
+	if !ok {
+		return nil
+	}
+	action, err := actions.New(name, nil)
+	if err != nil {
+		return &invalidAnnotationError{annotation: annotationAction, value: name, err: err}
+	}
+	schedule.action = action
+	schedule.actionName = name
+	return nil
+}
+
+// act takes the action of an expired item, or only reports it in dry-run mode
+func (j *Janitor) act(ctx context.Context, item WorkItem, schedule *deletionSchedule, reason string, logger *logrus.Entry) {
+	action, name := schedule.action, schedule.actionName
+	if action == nil {
+		action, name = actions.NewDelete(), actions.Delete
+	}
+	deleting := name == actions.Delete
+	ref := objectReference(item)
+
+	logger.WithField("reason", reason).Infof("Resource marked for %s", name)
+
+	// Archive the resource so it can be restored; never delete what could not be saved
+	if deleting && !j.Config.DryRun {
+		if err := j.archiveItem(ctx, item, schedule, reason); err != nil {
+			logger.WithError(err).Error("Failed to archive resource, skipping deletion")
+			metrics.Errors.WithLabelValues("archive").Inc()
+			eventMessage := fmt.Sprintf("Failed to archive %s %s/%s before deletion: %v",
+				item.Resource.Resource, item.Namespace, item.Name, err)
+			j.EventRecorder.Event(ref, corev1.EventTypeWarning, "ArchiveFailed", eventMessage)
+			j.recordDecision(item, audit.ArchiveFailed, err.Error(), schedule)
+			return
+		}
+	}
+
+	result, err := action.Run(ctx, actions.Env{
+		Client:       j.DynamicClient,
+		FieldManager: fieldmanager.Name,
+		DryRun:       j.Config.DryRun,
+	}, actions.Target{
+		Resource:  item.Resource,
+		Namespace: item.Namespace,
+		Name:      item.Name,
+		Object:    item.Obj,
+		Reason:    reason,
+	})
+	if err != nil {
+		logger.WithError(err).Errorf("Failed to %s resource", name)
+		eventReason, decision, errorType := "ActionFailed", audit.ActionFailed, "action"
+		if deleting {
+			eventReason, decision, errorType = "DeletionFailed", audit.DeleteFailed, "delete_resource"
+		}
+		metrics.Errors.WithLabelValues(errorType).Inc()
+		eventMessage := fmt.Sprintf("Failed to %s %s %s/%s: %v",
+			name, item.Resource.Resource, item.Namespace, item.Name, err)
+		j.EventRecorder.Event(ref, corev1.EventTypeWarning, eventReason, eventMessage)
+		j.recordDecision(item, decision, err.Error(), schedule)
+		return
+	}
+
+	switch {
+	case !result.Changed:
+		logger.Debugf("Resource needs no %s", name)
+		j.recordDecision(item, audit.ActionTaken, "unchanged: "+reason, schedule)
+		return
+	case j.Config.DryRun:
+		logger.Info(result.Message)
+		if deleting {
+			j.recordDeletion(item, reason)
+		}
+		j.recordDecision(item, audit.DryRun, reason, schedule)
+	case deleting:
+		logger.Info("Resource deleted")
+		metrics.ResourcesDeleted.WithLabelValues(item.Resource.Resource, item.Namespace, reason).Inc()
+		j.recordDeletion(item, reason)
+		j.recordDecision(item, audit.Deleted, reason, schedule)
+	default:
+		logger.Info(result.Message)
+		metrics.ActionsTaken.WithLabelValues(name, item.Resource.Resource, item.Namespace).Inc()
+		j.recordDecision(item, audit.ActionTaken, reason, schedule)
+	}
+
+	j.EventRecorder.Event(ref, corev1.EventTypeNormal, result.Event, result.Message+" - "+reason)
+}
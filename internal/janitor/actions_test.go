@@ -0,0 +1,207 @@
+package janitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/rules"
+	"github.com/blaxel-ai/kube-janitor-go/pkg/actions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestApplyAction(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation string
+		rule       string
+		want       string
+		wantErr    bool
+	}{
+		{name: "default", want: actions.Delete},
+		{name: "rule", rule: actions.ScaleDown, want: actions.ScaleDown},
+		{name: "annotation", annotation: actions.Suspend, want: actions.Suspend},
+		{name: "annotation overrides rule", annotation: actions.Delete, rule: actions.ScaleDown, want: actions.Delete},
+		{name: "invalid annotation", annotation: "hibernate", rule: actions.ScaleDown, want: actions.ScaleDown, wantErr: true},
+		{name: "annotation without parameters", annotation: actions.Webhook, want: actions.Delete, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var annotations map[string]interface{}
+			if tt.annotation != "" {
+				annotations = map[string]interface{}{annotationAction: tt.annotation}
+			}
+			schedule := &deletionSchedule{actionName: tt.rule}
+			err := applyAction(newScheduledPod(annotations, time.Hour), schedule)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, schedule.actionName)
+		})
+	}
+}
+
+func TestInvalidActionAnnotation(t *testing.T) {
+	annotations := map[string]interface{}{annotationTTL: "1h", annotationAction: "hibernate"}
+
+	j := &Janitor{}
+	schedule, err := j.deletionSchedule(context.Background(), newScheduledPod(annotations, 2*time.Hour))
+	assert.ErrorContains(t, err, "invalid janitor/action annotation 'hibernate'")
+	assert.Nil(t, schedule, "resources with an invalid action are kept")
+
+	j.Config.InvalidAnnotationPolicy = InvalidAnnotationIgnore
+	schedule, err = j.deletionSchedule(context.Background(), newScheduledPod(annotations, 2*time.Hour))
+	assert.Error(t, err)
+	require.NotNil(t, schedule)
+	assert.Equal(t, actions.Delete, schedule.actionName)
+}
+
+func TestActScaleDown(t *testing.T) {
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+	tests := []struct {
+		name         string
+		replicas     int64
+		noScale      bool
+		dryRun       bool
+		wantScaled   bool
+		wantEvent    string
+		wantPrevious string
+	}{
+		{
+			name:         "scaled down",
+			replicas:     2,
+			wantScaled:   true,
+			wantEvent:    "Normal ResourceScaledDown Scaled down deployments default/web from 2 replicas",
+			wantPrevious: "2",
+		},
+		{
+			name:      "dry run",
+			replicas:  2,
+			dryRun:    true,
+			wantEvent: "Normal DryRunScaleDown DRY RUN: Would scale down deployments default/web from 2 replicas",
+		},
+		{
+			name:     "already scaled down",
+			replicas: 0,
+		},
+		{
+			name:      "no scale subresource",
+			noScale:   true,
+			wantEvent: "Warning ActionFailed Failed to scale-down deployments default/web",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata": map[string]interface{}{
+					"name":      "web",
+					"namespace": "default",
+					"annotations": map[string]interface{}{
+						annotationTTL:    "1h",
+						annotationAction: actions.ScaleDown,
+					},
+					"creationTimestamp": time.Now().Add(-2 * time.Hour).Format(time.RFC3339),
+				},
+			}}
+
+			client := fake.NewSimpleDynamicClient(runtime.NewScheme(), deployment)
+			client.PrependReactor("get", "deployments", func(action ktesting.Action) (bool, runtime.Object, error) {
+				if action.GetSubresource() != "scale" {
+					return false, nil, nil
+				}
+				if tt.noScale {
+					return true, nil, apierrors.NewNotFound(schema.GroupResource{Group: "apps", Resource: "deployments/scale"}, "web")
+				}
+				return true, &unstructured.Unstructured{Object: map[string]interface{}{
+					"apiVersion": "autoscaling/v1",
+					"kind":       "Scale",
+					"spec":       map[string]interface{}{"replicas": tt.replicas},
+				}}, nil
+			})
+			var scaled bool
+			client.PrependReactor("patch", "deployments", func(action ktesting.Action) (bool, runtime.Object, error) {
+				if action.GetSubresource() != "scale" {
+					return false, nil, nil
+				}
+				assert.JSONEq(t, `{"spec":{"replicas":0}}`, string(action.(ktesting.PatchAction).GetPatch()))
+				scaled = true
+				return true, deployment, nil
+			})
+			client.PrependReactor("delete", "deployments", func(_ ktesting.Action) (bool, runtime.Object, error) {
+				t.Error("scaled down resources must not be deleted")
+				return true, nil, nil
+			})
+
+			recorder := record.NewFakeRecorder(10)
+			j := &Janitor{
+				DynamicClient: client,
+				Config:        Config{DryRun: tt.dryRun},
+				EventRecorder: recorder,
+			}
+			j.processItem(context.Background(), WorkItem{Resource: deployments, Namespace: "default", Name: "web", Obj: deployment})
+
+			assert.Equal(t, tt.wantScaled, scaled)
+			if tt.wantEvent == "" {
+				assert.Empty(t, recorder.Events)
+			} else {
+				require.Len(t, recorder.Events, 1)
+				assert.Contains(t, <-recorder.Events, tt.wantEvent)
+			}
+
+			got, err := client.Resource(deployments).Namespace("default").Get(context.Background(), "web", metav1.GetOptions{})
+			require.NoError(t, err)
+			previous, ok := got.GetAnnotations()[actions.AnnotationPreviousReplicas]
+			assert.Equal(t, tt.wantPrevious != "", ok, "previous replicas annotation")
+			assert.Equal(t, tt.wantPrevious, previous)
+		})
+	}
+}
+
+func TestActPatchRule(t *testing.T) {
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	engine, err := rules.New([]rules.Rule{{
+		ID:           "label-old-pods",
+		Resources:    []string{"pods"},
+		Expression:   "true",
+		TTL:          "1h",
+		Action:       actions.Patch,
+		ActionParams: map[string]string{"patch": `{"metadata":{"labels":{"expired":"true"}}}`},
+	}})
+	require.NoError(t, err)
+
+	pod := newScheduledPod(nil, 2*time.Hour)
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), pod)
+	client.PrependReactor("delete", "pods", func(_ ktesting.Action) (bool, runtime.Object, error) {
+		t.Error("patched resources must not be deleted")
+		return true, nil, nil
+	})
+
+	recorder := record.NewFakeRecorder(10)
+	j := &Janitor{DynamicClient: client, RuleEngine: engine, EventRecorder: recorder}
+	item := WorkItem{Resource: pods, Namespace: "default", Name: "test-pod", Obj: pod}
+	j.processItem(context.Background(), item)
+
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Normal ResourcePatched Patched pods default/test-pod - Rule 'label-old-pods' matched")
+
+	got, err := client.Resource(pods).Namespace("default").Get(context.Background(), "test-pod", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "true", got.GetLabels()["expired"])
+
+	// The patched object needs no further change
+	item.Obj = got
+	j.processItem(context.Background(), item)
+	assert.Empty(t, recorder.Events)
+}
@@ -0,0 +1,116 @@
+package janitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/audit"
+	"github.com/blaxel-ai/kube-janitor-go/internal/metrics"
+	"github.com/blaxel-ai/kube-janitor-go/pkg/actions"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// recordDecision adds the outcome of evaluating an item to the run's rule
+// stats and writes it to the audit log, if one is configured, when it differs
+// from the item's previous decision
+func (j *Janitor) recordDecision(item WorkItem, decision audit.Decision, reason string, schedule *deletionSchedule) {
+	newMatch := schedule != nil && schedule.rule != nil && j.ruleMatches.add(schedule.rule.ID, item.Obj.GetUID())
+	item.run.countRule(decision, schedule, newMatch)
+	if j.Audit == nil {
+		return
+	}
+
+	key := decisionKey{decision: decision}
+	if schedule != nil {
+		key.deleteAt = schedule.deleteAt.Unix()
+		key.action = schedule.actionName
+		if schedule.rule != nil {
+			key.ruleID = schedule.rule.ID
+		}
+	}
+	if !j.decisions.changed(item.Obj.GetUID(), key) {
+		return
+	}
+
+	now := time.Now().UTC()
+	record := audit.Record{
+		UID:       string(item.Obj.GetUID()),
+		Time:      now,
+		Group:     item.Resource.Group,
+		Version:   item.Resource.Version,
+		Resource:  item.Resource.Resource,
+		Namespace: item.Namespace,
+		Name:      item.Name,
+		Decision:  decision,
+		Reason:    reason,
+	}
+	if schedule != nil {
+		deleteAt := schedule.deleteAt.UTC()
+		record.DeleteAt = &deleteAt
+		if schedule.rule != nil {
+			record.RuleID = schedule.rule.ID
+		}
+		if schedule.actionName != actions.Delete {
+			record.Action = schedule.actionName
+		}
+		if remaining := deleteAt.Sub(now); remaining > 0 {
+			record.Remaining = remaining.Round(time.Second).String()
+		}
+	}
+
+	if err := j.Audit.Log(record); err != nil {
+		logrus.WithError(err).Error("Failed to write audit record")
+		metrics.Errors.WithLabelValues("audit").Inc()
+	}
+}
+
+// decisionKey is what makes a decision worth a new audit record. The reason
+// is left out as it includes the object's age.
+type decisionKey struct {
+	decision audit.Decision
+	ruleID   string
+	action   string
+	deleteAt int64
+}
+
+// decisionCache remembers the last decision recorded for each object, so the
+// audit log gets a record when a decision changes rather than on every run
+type decisionCache struct {
+	mu   sync.Mutex
+	last map[types.UID]decisionEntry
+}
+
+type decisionEntry struct {
+	key  decisionKey
+	seen bool
+}
+
+// changed stores the object's decision and reports whether it differs from the previous one
+func (c *decisionCache) changed(uid types.UID, key decisionKey) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.last == nil {
+		c.last = make(map[types.UID]decisionEntry)
+	}
+	previous, ok := c.last[uid]
+	c.last[uid] = decisionEntry{key: key, seen: true}
+	return !ok || previous.key != key
+}
+
+// prune drops the objects not evaluated since the previous prune, such as
+// deleted ones
+func (c *decisionCache) prune() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for uid, entry := range c.last {
+		if !entry.seen {
+			delete(c.last, uid)
+			continue
+		}
+		entry.seen = false
+		c.last[uid] = entry
+	}
+}
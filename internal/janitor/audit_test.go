@@ -0,0 +1,219 @@
+package janitor
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/audit"
+	"github.com/blaxel-ai/kube-janitor-go/internal/rules"
+	"github.com/blaxel-ai/kube-janitor-go/internal/window"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestProcessItemAudit(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name          string
+		annotations   map[string]interface{}
+		age           time.Duration
+		dryRun        bool
+		window        string
+		wantDecision  audit.Decision
+		wantReason    string
+		wantRemaining bool
+	}{
+		{
+			name:         "no TTL",
+			age:          time.Hour,
+			wantDecision: audit.NoTTL,
+		},
+		{
+			name:         "invalid TTL",
+			annotations:  map[string]interface{}{annotationTTL: "soon"},
+			age:          time.Hour,
+			wantDecision: audit.InvalidTTL,
+			wantReason:   "invalid janitor/ttl annotation 'soon'",
+		},
+		{
+			name:          "not expired",
+			annotations:   map[string]interface{}{annotationTTL: "2h"},
+			age:           time.Hour,
+			wantDecision:  audit.NotExpired,
+			wantReason:    "ttl 2h",
+			wantRemaining: true,
+		},
+		{
+			name: "snoozed",
+			annotations: map[string]interface{}{
+				annotationTTL:         "1h",
+				annotationExtendUntil: now.Add(time.Hour).UTC().Format(time.RFC3339),
+			},
+			age:           2 * time.Hour,
+			wantDecision:  audit.Snoozed,
+			wantRemaining: true,
+		},
+		{
+			name: "protected",
+			annotations: map[string]interface{}{
+				annotationTTL:            "1h",
+				annotationProtectedUntil: now.Add(time.Hour).UTC().Format(time.RFC3339),
+			},
+			age:           2 * time.Hour,
+			wantDecision:  audit.Protected,
+			wantReason:    "protected until",
+			wantRemaining: true,
+		},
+		{
+			name:         "deferred",
+			annotations:  map[string]interface{}{annotationTTL: "1h"},
+			age:          2 * time.Hour,
+			window:       "* * 30 2 *",
+			wantDecision: audit.Deferred,
+			wantReason:   "TTL expired",
+		},
+		{
+			name:         "dry run",
+			annotations:  map[string]interface{}{annotationTTL: "1h"},
+			age:          2 * time.Hour,
+			dryRun:       true,
+			wantDecision: audit.DryRun,
+		},
+		{
+			name:         "deleted",
+			annotations:  map[string]interface{}{annotationTTL: "1h"},
+			age:          2 * time.Hour,
+			wantDecision: audit.Deleted,
+			wantReason:   "TTL expired",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newScheduledPod(tt.annotations, tt.age)
+			pod.SetUID("1234")
+
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+			logger, err := audit.New(path, 0, 0)
+			require.NoError(t, err)
+
+			j := &Janitor{
+				DynamicClient: fake.NewSimpleDynamicClient(runtime.NewScheme(), pod),
+				Config:        Config{DryRun: tt.dryRun},
+				EventRecorder: record.NewFakeRecorder(10),
+				Audit:         logger,
+			}
+			if tt.window != "" {
+				j.DeletionWindow, err = window.Parse(tt.window)
+				require.NoError(t, err)
+			}
+
+			j.processItem(context.Background(), WorkItem{
+				Resource:  schema.GroupVersionResource{Version: "v1", Resource: "pods"},
+				Namespace: "default",
+				Name:      "test-pod",
+				Obj:       pod,
+			})
+			require.NoError(t, logger.Close())
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			require.Len(t, lines, 1)
+
+			var got audit.Record
+			require.NoError(t, json.Unmarshal([]byte(lines[0]), &got))
+			assert.Equal(t, "1234", got.UID)
+			assert.Equal(t, "pods", got.Resource)
+			assert.Equal(t, "test-pod", got.Name)
+			assert.Equal(t, tt.wantDecision, got.Decision)
+			assert.Contains(t, got.Reason, tt.wantReason)
+			assert.Equal(t, tt.wantRemaining, got.Remaining != "")
+		})
+	}
+}
+
+func TestProcessItemRuleError(t *testing.T) {
+	engine, err := rules.New([]rules.Rule{
+		{ID: "broken", Resources: []string{"pods"}, Expression: `object.spec.nodeName == "a"`, TTL: "1h", OnError: rules.OnErrorFail},
+		{ID: "all-pods", Resources: []string{"pods"}, Expression: "true", TTL: "1h"},
+	})
+	require.NoError(t, err)
+
+	pod := newScheduledPod(nil, 2*time.Hour)
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	logger, err := audit.New(path, 0, 0)
+	require.NoError(t, err)
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), pod)
+	j := &Janitor{
+		DynamicClient: client,
+		RuleEngine:    engine,
+		EventRecorder: record.NewFakeRecorder(10),
+		Audit:         logger,
+	}
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	j.processItem(context.Background(), WorkItem{Resource: gvr, Namespace: "default", Name: "test-pod", Obj: pod})
+	require.NoError(t, logger.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var got audit.Record
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, audit.RuleError, got.Decision)
+	assert.Contains(t, got.Reason, "rule 'broken' failed to evaluate")
+
+	_, err = client.Resource(gvr).Namespace("default").Get(context.Background(), "test-pod", metav1.GetOptions{})
+	assert.NoError(t, err, "objects are not deleted when a rule fails")
+}
+
+func TestRecordDecisionChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	logger, err := audit.New(path, 0, 0)
+	require.NoError(t, err)
+
+	pod := newScheduledPod(nil, time.Hour)
+	pod.SetUID("1234")
+	item := WorkItem{
+		Resource:  schema.GroupVersionResource{Version: "v1", Resource: "pods"},
+		Namespace: "default",
+		Name:      "test-pod",
+		Obj:       pod,
+	}
+	schedule := &deletionSchedule{deleteAt: time.Now().Add(time.Hour)}
+	later := &deletionSchedule{deleteAt: time.Now().Add(2 * time.Hour)}
+
+	j := &Janitor{Audit: logger}
+	j.recordDecision(item, audit.NoTTL, "no TTL", nil)
+	j.recordDecision(item, audit.NoTTL, "no TTL", nil)
+	j.recordDecision(item, audit.NotExpired, "ttl 2h", schedule)
+	j.recordDecision(item, audit.NotExpired, "ttl 2h", schedule)
+	j.recordDecision(item, audit.NotExpired, "ttl 3h", later)
+
+	// Objects that were not evaluated since the previous prune are forgotten
+	j.decisions.prune()
+	j.decisions.prune()
+	j.recordDecision(item, audit.NotExpired, "ttl 3h", later)
+	require.NoError(t, logger.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var decisions []audit.Decision
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record audit.Record
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		decisions = append(decisions, record.Decision)
+	}
+	assert.Equal(t, []audit.Decision{audit.NoTTL, audit.NotExpired, audit.NotExpired, audit.NotExpired}, decisions)
+}
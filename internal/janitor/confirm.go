@@ -0,0 +1,213 @@
+package janitor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/audit"
+	"github.com/blaxel-ai/kube-janitor-go/internal/metrics"
+	"github.com/blaxel-ai/kube-janitor-go/pkg/actions"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// labelMarkedAt records, in Unix seconds, when an expired resource was first
+// found expired with a confirmation period. Label values cannot hold RFC 3339
+// times, and a label lets owners list the marked resources with a selector.
+const labelMarkedAt = "janitor/marked-at"
+
+// markedAt returns the time an object was marked, if it was
+func markedAt(obj *unstructured.Unstructured) (time.Time, bool, error) {
+	value, ok := obj.GetLabels()[labelMarkedAt]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, true, fmt.Errorf("invalid %s label '%s'", labelMarkedAt, value)
+	}
+	return time.Unix(seconds, 0), true, nil
+}
+
+// confirmed reports whether an expired item may be acted on. With a
+// confirmation period, the item is only labeled when first found expired and
+// confirmed once it stayed expired for the period.
+func (j *Janitor) confirmed(ctx context.Context, item WorkItem, schedule *deletionSchedule, reason string, now time.Time, logger *logrus.Entry) bool {
+	if j.Config.ConfirmationPeriod <= 0 {
+		return true
+	}
+
+	_, ok, err := markedAt(item.Obj)
+	if err != nil {
+		logger.WithError(err).Warn("Invalid marked-at label, marking again")
+	}
+	if !ok || err != nil {
+		j.mark(ctx, item, schedule, reason, now, logger)
+		return false
+	}
+
+	if pending := j.pendingConfirmation(item.Obj, now); pending != "" {
+		j.recordDecision(item, audit.Marked, pending+": "+reason, schedule)
+		return false
+	}
+	return true
+}
+
+// mark labels a newly expired item and emits a ResourceMarked event, or only
+// reports and remembers it in dry-run mode
+func (j *Janitor) mark(ctx context.Context, item WorkItem, schedule *deletionSchedule, reason string, now time.Time, logger *logrus.Entry) {
+	action := schedule.actionName
+	if action == "" {
+		action = actions.Delete
+	}
+	ref := objectReference(item)
+	confirmAt := now.Add(j.Config.ConfirmationPeriod).UTC().Format(time.RFC3339)
+
+	if j.Config.DryRun {
+		j.dryRunMarks.remember(item.Obj.GetUID(), strconv.FormatInt(now.Unix(), 10))
+		logger.Info("DRY RUN: Would mark resource")
+		eventMessage := fmt.Sprintf("DRY RUN: Would mark %s %s/%s for %s at %s - %s",
+			item.Resource.Resource, item.Namespace, item.Name, action, confirmAt, reason)
+		j.EventRecorder.Event(ref, corev1.EventTypeNormal, "DryRunMark", eventMessage)
+		j.recordDecision(item, audit.DryRun, "marked: "+reason, schedule)
+		return
+	}
+
+	if err := j.patchLabels(ctx, item, map[string]interface{}{
+		labelMarkedAt: strconv.FormatInt(now.Unix(), 10),
+	}); err != nil {
+		logger.WithError(err).Error("Failed to mark resource")
+		metrics.Errors.WithLabelValues("patch_resource").Inc()
+		return
+	}
+
+	logger.WithFields(logrus.Fields{"reason": reason, "confirmAt": confirmAt}).Info("Resource marked")
+	metrics.ResourcesMarked.WithLabelValues(item.Resource.Resource, item.Namespace).Inc()
+	j.recordDecision(item, audit.Marked, reason, schedule)
+
+	eventMessage := fmt.Sprintf("Marked %s %s/%s for %s at %s - %s",
+		item.Resource.Resource, item.Namespace, item.Name, action, confirmAt, reason)
+	j.EventRecorder.Event(ref, corev1.EventTypeWarning, "ResourceMarked", eventMessage)
+}
+
+// unmark removes the mark of an item that is no longer expired, so that it
+// has to be confirmed again should it expire again
+func (j *Janitor) unmark(ctx context.Context, item WorkItem, logger *logrus.Entry) {
+	if _, ok := item.Obj.GetLabels()[labelMarkedAt]; !ok {
+		return
+	}
+	if j.Config.DryRun {
+		if j.dryRunMarks.forget(item.Obj.GetUID()) {
+			logger.Info("DRY RUN: Would unmark resource")
+		}
+		return
+	}
+
+	if err := j.patchLabels(ctx, item, map[string]interface{}{labelMarkedAt: nil}); err != nil {
+		logger.WithError(err).Error("Failed to unmark resource")
+		metrics.Errors.WithLabelValues("patch_resource").Inc()
+		return
+	}
+
+	logger.Info("Resource no longer expired, unmarked")
+	eventMessage := fmt.Sprintf("Unmarked %s %s/%s, it is no longer expired",
+		item.Resource.Resource, item.Namespace, item.Name)
+	j.EventRecorder.Event(objectReference(item), corev1.EventTypeNormal, "ResourceUnmarked", eventMessage)
+}
+
+// pendingConfirmation tells why an expired object is not confirmed yet, for
+// explanations. It is empty once the object is confirmed.
+func (j *Janitor) pendingConfirmation(obj *unstructured.Unstructured, now time.Time) string {
+	if j.Config.ConfirmationPeriod <= 0 {
+		return ""
+	}
+	marked, ok, err := markedAt(obj)
+	if !ok || err != nil {
+		return fmt.Sprintf("will be marked on the next run and confirmed %s later", j.Config.ConfirmationPeriod)
+	}
+	confirmAt := marked.Add(j.Config.ConfirmationPeriod)
+	if !now.Before(confirmAt) {
+		return ""
+	}
+	return fmt.Sprintf("marked at %s, confirmed at %s",
+		marked.UTC().Format(time.RFC3339), confirmAt.UTC().Format(time.RFC3339))
+}
+
+// recallMark applies the mark remembered in dry-run mode, so that dry runs
+// confirm expired items after the confirmation period like real runs instead
+// of marking them again on every pass
+func (j *Janitor) recallMark(item WorkItem) {
+	if !j.Config.DryRun {
+		return
+	}
+	marked, ok := j.dryRunMarks.recall(item.Obj.GetUID())
+	if !ok {
+		return
+	}
+	labels := item.Obj.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[labelMarkedAt] = marked
+	item.Obj.SetLabels(labels)
+}
+
+// markStamps are the marked-at labels remembered in dry-run mode. Like
+// decisionCache, marks of objects a run no longer saw are dropped by prune.
+type markStamps struct {
+	mu     sync.Mutex
+	stamps map[types.UID]markStamp
+}
+
+type markStamp struct {
+	marked string
+	seen   bool
+}
+
+func (s *markStamps) remember(uid types.UID, marked string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stamps == nil {
+		s.stamps = make(map[types.UID]markStamp)
+	}
+	s.stamps[uid] = markStamp{marked: marked, seen: true}
+}
+
+func (s *markStamps) recall(uid types.UID) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stamp, ok := s.stamps[uid]
+	if ok {
+		stamp.seen = true
+		s.stamps[uid] = stamp
+	}
+	return stamp.marked, ok
+}
+
+// forget drops a remembered mark and reports whether there was one
+func (s *markStamps) forget(uid types.UID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.stamps[uid]
+	delete(s.stamps, uid)
+	return ok
+}
+
+// prune forgets the marks of objects not seen since the last prune
+func (s *markStamps) prune() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for uid, stamp := range s.stamps {
+		if !stamp.seen {
+			delete(s.stamps, uid)
+			continue
+		}
+		stamp.seen = false
+		s.stamps[uid] = stamp
+	}
+}
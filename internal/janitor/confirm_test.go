@@ -0,0 +1,216 @@
+package janitor
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestConfirmationPeriod(t *testing.T) {
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	markedAgo := func(d time.Duration) string {
+		return strconv.FormatInt(time.Now().Add(-d).Unix(), 10)
+	}
+
+	tests := []struct {
+		name     string
+		ttl      string
+		markedAt string
+		dryRun   bool
+		// dryRunMarkedAt is a mark remembered by an earlier dry run
+		dryRunMarkedAt string
+		wantDeleted    bool
+		wantMarked     bool
+		wantEvent      string
+	}{
+		{
+			name:       "first match marks",
+			ttl:        "1h",
+			wantMarked: true,
+			wantEvent:  "Warning ResourceMarked Marked pods default/test-pod for delete at ",
+		},
+		{
+			name:       "marked within the confirmation period",
+			ttl:        "1h",
+			markedAt:   markedAgo(time.Hour),
+			wantMarked: true,
+		},
+		{
+			name:        "confirmed after the confirmation period",
+			ttl:         "1h",
+			markedAt:    markedAgo(25 * time.Hour),
+			wantDeleted: true,
+			wantEvent:   "Normal ResourceDeleted Deleted pods default/test-pod",
+		},
+		{
+			name:       "invalid mark marks again",
+			ttl:        "1h",
+			markedAt:   "yesterday",
+			wantMarked: true,
+			wantEvent:  "Warning ResourceMarked",
+		},
+		{
+			name:      "no longer expired unmarks",
+			ttl:       "24h",
+			markedAt:  markedAgo(25 * time.Hour),
+			wantEvent: "Normal ResourceUnmarked Unmarked pods default/test-pod",
+		},
+		{
+			name:      "dry run does not mark",
+			ttl:       "1h",
+			dryRun:    true,
+			wantEvent: "Normal DryRunMark DRY RUN: Would mark pods default/test-pod for delete at ",
+		},
+		{
+			name:           "dry run within the confirmation period",
+			ttl:            "1h",
+			dryRun:         true,
+			dryRunMarkedAt: markedAgo(time.Hour),
+		},
+		{
+			name:           "dry run confirmed after the confirmation period",
+			ttl:            "1h",
+			dryRun:         true,
+			dryRunMarkedAt: markedAgo(25 * time.Hour),
+			wantEvent:      "Normal DryRunDeletion",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newScheduledPod(map[string]interface{}{annotationTTL: tt.ttl}, 2*time.Hour)
+			pod.SetUID("1234")
+			if tt.markedAt != "" {
+				pod.SetLabels(map[string]string{labelMarkedAt: tt.markedAt})
+			}
+			client := fake.NewSimpleDynamicClient(runtime.NewScheme(), pod)
+
+			recorder := record.NewFakeRecorder(10)
+			j := &Janitor{
+				DynamicClient: client,
+				Config:        Config{DryRun: tt.dryRun, ConfirmationPeriod: 24 * time.Hour},
+				EventRecorder: recorder,
+			}
+			if tt.dryRunMarkedAt != "" {
+				j.dryRunMarks.remember(pod.GetUID(), tt.dryRunMarkedAt)
+			}
+			j.processItem(context.Background(), WorkItem{Resource: pods, Namespace: "default", Name: "test-pod", Obj: pod})
+
+			if tt.wantEvent == "" {
+				assert.Empty(t, recorder.Events)
+			} else {
+				require.Len(t, recorder.Events, 1)
+				assert.Contains(t, <-recorder.Events, tt.wantEvent)
+			}
+
+			got, err := client.Resource(pods).Namespace("default").Get(context.Background(), "test-pod", metav1.GetOptions{})
+			if tt.wantDeleted {
+				assert.True(t, apierrors.IsNotFound(err), "resource should be deleted")
+				return
+			}
+			require.NoError(t, err)
+			marked, _, err := markedAt(got)
+			assert.Equal(t, tt.wantMarked, err == nil && !marked.IsZero(), "marked-at label")
+			if tt.dryRun {
+				_, remembered := j.dryRunMarks.recall(pod.GetUID())
+				assert.True(t, remembered, "dry runs remember their marks")
+			}
+		})
+	}
+}
+
+func TestPendingConfirmation(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	pod := func(markedAt string) *unstructured.Unstructured {
+		obj := newScheduledPod(nil, time.Hour)
+		if markedAt != "" {
+			obj.SetLabels(map[string]string{labelMarkedAt: markedAt})
+		}
+		return obj
+	}
+
+	j := &Janitor{}
+	assert.Empty(t, j.pendingConfirmation(pod(""), now), "disabled without a confirmation period")
+
+	j.Config.ConfirmationPeriod = 24 * time.Hour
+	assert.Equal(t, "will be marked on the next run and confirmed 24h0m0s later", j.pendingConfirmation(pod(""), now))
+	assert.Equal(t, "marked at 2024-01-15T09:00:00Z, confirmed at 2024-01-16T09:00:00Z",
+		j.pendingConfirmation(pod(strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)), now))
+	assert.Empty(t, j.pendingConfirmation(pod(strconv.FormatInt(now.Add(-24*time.Hour).Unix(), 10)), now))
+}
+
+func TestUnresolvedScheduleKeepsMark(t *testing.T) {
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+	tests := []struct {
+		name   string
+		rule   rules.Rule
+		cancel bool
+	}{
+		{
+			name: "rule error",
+			rule: rules.Rule{ID: "broken", Resources: []string{"pods"}, Expression: "object.spec.missing == 1", TTL: "1h", OnError: rules.OnErrorFail},
+		},
+		{
+			name:   "interrupted evaluation",
+			rule:   rules.Rule{ID: "all-pods", Resources: []string{"pods"}, Expression: "true", TTL: "1h"},
+			cancel: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newScheduledPod(nil, 2*time.Hour)
+			pod.SetLabels(map[string]string{labelMarkedAt: strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)})
+			client := fake.NewSimpleDynamicClient(runtime.NewScheme(), pod)
+
+			engine, err := rules.New([]rules.Rule{tt.rule})
+			require.NoError(t, err)
+			j := &Janitor{
+				DynamicClient: client,
+				Config:        Config{ConfirmationPeriod: 24 * time.Hour},
+				EventRecorder: record.NewFakeRecorder(10),
+				RuleEngine:    engine,
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancel {
+				cancel()
+			}
+			defer cancel()
+			j.processItem(ctx, WorkItem{Resource: pods, Namespace: "default", Name: "test-pod", Obj: pod})
+
+			got, err := client.Resource(pods).Namespace("default").Get(context.Background(), "test-pod", metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Contains(t, got.GetLabels(), labelMarkedAt)
+		})
+	}
+}
+
+func TestMarkStampsPrune(t *testing.T) {
+	var marks markStamps
+	marks.remember("1234", "1700000000")
+	marks.remember("5678", "1700000000")
+
+	marks.prune()
+	_, ok := marks.recall("1234")
+	assert.True(t, ok)
+
+	marks.prune()
+	_, ok = marks.recall("1234")
+	assert.True(t, ok, "kept while it is seen")
+	_, ok = marks.recall("5678")
+	assert.False(t, ok, "forgotten once a run no longer saw it")
+}
@@ -0,0 +1,270 @@
+package janitor
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/metrics"
+	"github.com/blaxel-ai/kube-janitor-go/pkg/duration"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// annotationEmptySince is written by the janitor on namespaces to record when
+// it first found them empty
+const annotationEmptySince = "janitor/empty-since"
+
+var namespacesGVR = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+
+// DefaultEmptyNamespaceIgnore are the objects Kubernetes creates in every
+// namespace, which do not keep a namespace from being empty
+var DefaultEmptyNamespaceIgnore = []string{
+	"Event",
+	"ServiceAccount/default",
+	"ConfigMap/kube-root-ca.crt",
+	"Secret/default-token-*",
+}
+
+// systemNamespaces are never deleted, as they cannot be or hold the
+// cluster's own objects
+var systemNamespaces = []string{"default", "kube-system", "kube-public", "kube-node-lease"}
+
+// ignoredObject matches objects by kind and, optionally, by a name pattern
+type ignoredObject struct {
+	kind string
+	name string
+}
+
+// parseEmptyNamespaceIgnore parses <Kind> and <Kind>/<name> entries, where
+// the name may contain shell wildcards
+func parseEmptyNamespaceIgnore(entries []string) ([]ignoredObject, error) {
+	ignored := make([]ignoredObject, 0, len(entries))
+	for _, entry := range entries {
+		kind, name, hasName := strings.Cut(strings.TrimSpace(entry), "/")
+		if kind == "" || (hasName && name == "") {
+			return nil, fmt.Errorf("invalid empty namespace ignore entry '%s': must be <Kind> or <Kind>/<name>", entry)
+		}
+		if _, err := path.Match(name, ""); err != nil {
+			return nil, fmt.Errorf("invalid empty namespace ignore entry '%s': %w", entry, err)
+		}
+		ignored = append(ignored, ignoredObject{kind: kind, name: name})
+	}
+	return ignored, nil
+}
+
+// namespaceInventory counts the objects of each namespace that a cleanup run
+// lists, leaving out ignored ones. A namespace is only known to be empty if
+// every resource type was listed in it, so a failed listing never makes a
+// namespace look empty.
+type namespaceInventory struct {
+	ignored []ignoredObject
+
+	mu sync.Mutex
+	// resources is the number of namespaced resource types listed
+	resources int
+	// listed counts the successful listings of each namespace, and objects
+	// the objects found by them
+	listed  map[string]int
+	objects map[string]int
+}
+
+func newNamespaceInventory(ignored []ignoredObject) *namespaceInventory {
+	return &namespaceInventory{
+		ignored: ignored,
+		listed:  make(map[string]int),
+		objects: make(map[string]int),
+	}
+}
+
+// ignoresKind reports whether all objects of a kind are ignored, so that its
+// resources need not be listed
+func (inv *namespaceInventory) ignoresKind(kind string) bool {
+	for _, ignored := range inv.ignored {
+		if ignored.kind == kind && ignored.name == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (inv *namespaceInventory) ignores(kind, name string) bool {
+	for _, ignored := range inv.ignored {
+		if ignored.kind != kind {
+			continue
+		}
+		if matched, _ := path.Match(ignored.name, name); ignored.name == "" || matched {
+			return true
+		}
+	}
+	return false
+}
+
+// addResource announces that a namespaced resource type is listed in every
+// namespace. The methods tolerate a nil inventory, for runs that do not
+// look for empty namespaces.
+func (inv *namespaceInventory) addResource() {
+	if inv == nil {
+		return
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.resources++
+}
+
+// add records the objects of a kind listed in a namespace. Kinds ignored as
+// a whole are still listed when they are processed, but are not announced
+// by addResource, so their listings must not count.
+func (inv *namespaceInventory) add(kind, namespace string, items []unstructured.Unstructured) {
+	if inv == nil || namespace == "" || inv.ignoresKind(kind) {
+		return
+	}
+
+	count := 0
+	for _, item := range items {
+		if !inv.ignores(kind, item.GetName()) {
+			count++
+		}
+	}
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.listed[namespace]++
+	inv.objects[namespace] += count
+}
+
+// empty reports whether a namespace holds nothing but ignored objects, and
+// whether all of its resources were listed to tell
+func (inv *namespaceInventory) empty(namespace string) (empty, known bool) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if inv.resources == 0 || inv.listed[namespace] != inv.resources {
+		return false, false
+	}
+	return inv.objects[namespace] == 0, true
+}
+
+// cleanupEmptyNamespaces deletes the namespaces that held nothing but ignored
+// objects for longer than the empty namespace TTL, according to the
+// inventory of the run
+func (j *Janitor) cleanupEmptyNamespaces(ctx context.Context, run *cleanupRun) {
+	if run.namespaces == nil {
+		return
+	}
+
+	list, err := j.resourceClient(namespacesGVR, "").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to list namespaces")
+		metrics.Errors.WithLabelValues("list_namespaces").Inc()
+		return
+	}
+
+	now := time.Now()
+	emptyNamespaces := 0
+	for i := range list.Items {
+		obj := &list.Items[i]
+		empty, known := run.namespaces.empty(obj.GetName())
+		if !known || contains(systemNamespaces, obj.GetName()) || obj.GetDeletionTimestamp() != nil {
+			continue
+		}
+		if empty {
+			emptyNamespaces++
+		}
+		j.processEmptyNamespace(ctx, WorkItem{Resource: namespacesGVR, Name: obj.GetName(), Obj: obj, run: run}, empty, now)
+	}
+	metrics.EmptyNamespaces.Set(float64(emptyNamespaces))
+}
+
+// processEmptyNamespace records when a namespace became empty, or forgets it
+// once it is no longer, and deletes it once it has been empty for the TTL
+func (j *Janitor) processEmptyNamespace(ctx context.Context, item WorkItem, empty bool, now time.Time) {
+	logger := logrus.WithFields(logrus.Fields{
+		"resource": item.Resource.Resource,
+		"name":     item.Name,
+	})
+
+	j.recallMark(item)
+
+	emptySince, stamped := item.Obj.GetAnnotations()[annotationEmptySince]
+	if !empty {
+		if stamped && !j.Config.DryRun {
+			if err := j.patchAnnotations(ctx, item, map[string]interface{}{annotationEmptySince: nil}); err != nil {
+				logger.WithError(err).Error("Failed to clear empty namespace annotation")
+				metrics.Errors.WithLabelValues("patch_resource").Inc()
+				return
+			}
+			logger.Info("Namespace is no longer empty")
+		}
+		if stamped {
+			j.unmark(ctx, item, logger)
+		}
+		return
+	}
+
+	schedule, err := j.emptyNamespaceSchedule(item.Obj)
+	if !stamped || err != nil {
+		if stamped {
+			logger.WithError(err).WithField("emptySince", emptySince).Warn("Invalid empty-since timestamp, restarting")
+		}
+		if !j.Config.DryRun {
+			if err := j.patchAnnotations(ctx, item, map[string]interface{}{
+				annotationEmptySince: now.UTC().Format(time.RFC3339),
+			}); err != nil {
+				logger.WithError(err).Error("Failed to record empty namespace")
+				metrics.Errors.WithLabelValues("patch_resource").Inc()
+				return
+			}
+		}
+		logger.Info("Namespace is empty")
+		return
+	}
+
+	if !schedule.expired(now) {
+		// A protected namespace is not expired for processItem either, so
+		// its mark cannot be one processItem still relies on
+		if schedule.protectedUntil.After(now) {
+			j.unmark(ctx, item, logger)
+		}
+		return
+	}
+
+	reason := fmt.Sprintf("Namespace empty (since: %s, ttl: %s)", emptySince, j.Config.EmptyNamespaceTTL)
+	if !j.confirmed(ctx, item, schedule, reason, now, logger) {
+		return
+	}
+	j.expire(ctx, item, schedule, reason, now, logger)
+}
+
+// emptyNamespaceSchedule is the deletion schedule of a namespace from its
+// janitor/empty-since annotation
+func (j *Janitor) emptyNamespaceSchedule(obj *unstructured.Unstructured) (*deletionSchedule, error) {
+	since, err := time.Parse(time.RFC3339, obj.GetAnnotations()[annotationEmptySince])
+	if err != nil {
+		return nil, err
+	}
+	schedule := &deletionSchedule{
+		deleteAt: since.Add(j.Config.EmptyNamespaceTTL),
+		since:    since,
+		ttl:      duration.Duration{Fixed: j.Config.EmptyNamespaceTTL},
+	}
+	applyProtection(obj, schedule)
+	return schedule, nil
+}
+
+// emptyNamespaceExpired reports whether an item is a namespace that has been
+// empty for the TTL, as of its last empty namespace check
+func (j *Janitor) emptyNamespaceExpired(item WorkItem, now time.Time) bool {
+	if j.Config.EmptyNamespaceTTL <= 0 || item.Resource != namespacesGVR {
+		return false
+	}
+	if _, ok := item.Obj.GetAnnotations()[annotationEmptySince]; !ok {
+		return false
+	}
+	schedule, err := j.emptyNamespaceSchedule(item.Obj)
+	return err == nil && schedule.expired(now)
+}
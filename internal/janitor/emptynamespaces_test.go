@@ -0,0 +1,391 @@
+package janitor
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestParseEmptyNamespaceIgnore(t *testing.T) {
+	ignored, err := parseEmptyNamespaceIgnore(DefaultEmptyNamespaceIgnore)
+	require.NoError(t, err)
+	assert.Len(t, ignored, len(DefaultEmptyNamespaceIgnore))
+
+	for _, entry := range []string{"", "/default", "Secret/", "Secret/[default"} {
+		_, err := parseEmptyNamespaceIgnore([]string{entry})
+		assert.Error(t, err, entry)
+	}
+}
+
+func TestNamespaceInventory(t *testing.T) {
+	ignored, err := parseEmptyNamespaceIgnore(DefaultEmptyNamespaceIgnore)
+	require.NoError(t, err)
+	named := func(names ...string) []unstructured.Unstructured {
+		items := make([]unstructured.Unstructured, len(names))
+		for i, name := range names {
+			items[i].SetName(name)
+		}
+		return items
+	}
+
+	inv := newNamespaceInventory(ignored)
+	assert.True(t, inv.ignoresKind("Event"))
+	assert.False(t, inv.ignoresKind("Secret"))
+
+	inv.addResource()
+	inv.addResource()
+	inv.add("Secret", "empty", named("default-token-abcde"))
+	inv.add("ServiceAccount", "empty", named("default"))
+	inv.add("Secret", "used", named("default-token-abcde", "credentials"))
+	inv.add("ServiceAccount", "used", named("default"))
+	inv.add("Secret", "partial", nil)
+
+	empty, known := inv.empty("empty")
+	assert.True(t, known)
+	assert.True(t, empty)
+
+	empty, known = inv.empty("used")
+	assert.True(t, known)
+	assert.False(t, empty)
+
+	_, known = inv.empty("partial")
+	assert.False(t, known, "namespaces with a failed listing are unknown")
+
+	var disabled *namespaceInventory
+	disabled.addResource()
+	disabled.add("Secret", "empty", nil)
+}
+
+func TestCleanupEmptyNamespaces(t *testing.T) {
+	now := time.Now()
+	stamp := func(age time.Duration) map[string]interface{} {
+		return map[string]interface{}{annotationEmptySince: now.Add(-age).UTC().Format(time.RFC3339)}
+	}
+
+	tests := []struct {
+		name          string
+		namespace     string
+		annotations   map[string]interface{}
+		objects       int
+		dryRun        bool
+		wantDeleted   bool
+		wantStamped   bool
+		wantUnchanged bool
+	}{
+		{
+			name:        "newly empty",
+			namespace:   "team-a",
+			wantStamped: true,
+		},
+		{
+			name:        "empty for less than the TTL",
+			namespace:   "team-a",
+			annotations: stamp(time.Hour),
+			wantStamped: true,
+		},
+		{
+			name:        "empty for longer than the TTL",
+			namespace:   "team-a",
+			annotations: stamp(48 * time.Hour),
+			wantDeleted: true,
+		},
+		{
+			name:        "invalid stamp",
+			namespace:   "team-a",
+			annotations: map[string]interface{}{annotationEmptySince: "yesterday"},
+			wantStamped: true,
+		},
+		{
+			name:        "no longer empty",
+			namespace:   "team-a",
+			annotations: stamp(48 * time.Hour),
+			objects:     1,
+		},
+		{
+			name:      "protected",
+			namespace: "team-a",
+			annotations: map[string]interface{}{
+				annotationEmptySince:     now.Add(-48 * time.Hour).UTC().Format(time.RFC3339),
+				annotationProtectedUntil: now.Add(time.Hour).UTC().Format(time.RFC3339),
+			},
+			wantStamped: true,
+		},
+		{
+			name:          "dry run",
+			namespace:     "team-a",
+			dryRun:        true,
+			wantUnchanged: true,
+		},
+		{
+			name:          "dry run after the TTL",
+			namespace:     "team-a",
+			annotations:   stamp(48 * time.Hour),
+			dryRun:        true,
+			wantStamped:   true,
+			wantUnchanged: true,
+		},
+		{
+			name:          "system namespace",
+			namespace:     "kube-public",
+			wantUnchanged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns := &unstructured.Unstructured{}
+			ns.SetAPIVersion("v1")
+			ns.SetKind("Namespace")
+			ns.SetName(tt.namespace)
+			if tt.annotations != nil {
+				annotations := map[string]string{}
+				for key, value := range tt.annotations {
+					annotations[key] = value.(string)
+				}
+				ns.SetAnnotations(annotations)
+			}
+
+			client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+				map[schema.GroupVersionResource]string{namespacesGVR: "NamespaceList"}, ns)
+			recorder := record.NewFakeRecorder(10)
+			j := &Janitor{
+				DynamicClient: client,
+				Config:        Config{DryRun: tt.dryRun, EmptyNamespaceTTL: 24 * time.Hour},
+				EventRecorder: recorder,
+			}
+
+			run := newCleanupRun()
+			run.namespaces = newNamespaceInventory(nil)
+			run.namespaces.addResource()
+			items := make([]unstructured.Unstructured, tt.objects)
+			run.namespaces.add("ConfigMap", tt.namespace, items)
+			j.cleanupEmptyNamespaces(context.Background(), run)
+
+			got, err := client.Resource(namespacesGVR).Get(context.Background(), tt.namespace, metav1.GetOptions{})
+			if tt.wantDeleted {
+				assert.True(t, apierrors.IsNotFound(err), "namespace should be deleted")
+				require.Len(t, recorder.Events, 1)
+				assert.Contains(t, <-recorder.Events, "Namespace empty")
+				return
+			}
+			require.NoError(t, err)
+
+			if tt.wantUnchanged {
+				assert.Equal(t, ns.GetAnnotations(), got.GetAnnotations())
+			}
+			_, stamped := got.GetAnnotations()[annotationEmptySince]
+			assert.Equal(t, tt.wantStamped, stamped)
+			if tt.dryRun && tt.wantStamped {
+				require.Len(t, recorder.Events, 1)
+				assert.Contains(t, <-recorder.Events, "DryRunDeletion")
+			}
+		})
+	}
+}
+
+func TestCleanupEmptyNamespacesConfirmation(t *testing.T) {
+	now := time.Now()
+	ago := func(age time.Duration) string { return now.Add(-age).UTC().Format(time.RFC3339) }
+	markedAgo := func(age time.Duration) string { return strconv.FormatInt(now.Add(-age).Unix(), 10) }
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		markedAt    string
+		objects     int
+		wantDeleted bool
+		wantMarked  bool
+	}{
+		{
+			name:        "expired marks",
+			annotations: map[string]string{annotationEmptySince: ago(48 * time.Hour)},
+			wantMarked:  true,
+		},
+		{
+			name:        "marked within the confirmation period",
+			annotations: map[string]string{annotationEmptySince: ago(48 * time.Hour)},
+			markedAt:    markedAgo(time.Hour),
+			wantMarked:  true,
+		},
+		{
+			name:        "confirmed after the confirmation period",
+			annotations: map[string]string{annotationEmptySince: ago(48 * time.Hour)},
+			markedAt:    markedAgo(25 * time.Hour),
+			wantDeleted: true,
+		},
+		{
+			name:        "no longer empty unmarks",
+			annotations: map[string]string{annotationEmptySince: ago(48 * time.Hour)},
+			markedAt:    markedAgo(time.Hour),
+			objects:     1,
+		},
+		{
+			name: "protected unmarks",
+			annotations: map[string]string{
+				annotationEmptySince:     ago(48 * time.Hour),
+				annotationProtectedUntil: now.Add(time.Hour).UTC().Format(time.RFC3339),
+			},
+			markedAt: markedAgo(time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns := &unstructured.Unstructured{}
+			ns.SetAPIVersion("v1")
+			ns.SetKind("Namespace")
+			ns.SetName("team-a")
+			ns.SetAnnotations(tt.annotations)
+			if tt.markedAt != "" {
+				ns.SetLabels(map[string]string{labelMarkedAt: tt.markedAt})
+			}
+
+			client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+				map[schema.GroupVersionResource]string{namespacesGVR: "NamespaceList"}, ns)
+			j := &Janitor{
+				DynamicClient: client,
+				Config:        Config{EmptyNamespaceTTL: 24 * time.Hour, ConfirmationPeriod: 24 * time.Hour},
+				EventRecorder: record.NewFakeRecorder(10),
+			}
+
+			run := newCleanupRun()
+			run.namespaces = newNamespaceInventory(nil)
+			run.namespaces.addResource()
+			run.namespaces.add("ConfigMap", "team-a", make([]unstructured.Unstructured, tt.objects))
+			j.cleanupEmptyNamespaces(context.Background(), run)
+
+			got, err := client.Resource(namespacesGVR).Get(context.Background(), "team-a", metav1.GetOptions{})
+			if tt.wantDeleted {
+				assert.True(t, apierrors.IsNotFound(err), "namespace should be deleted")
+				return
+			}
+			require.NoError(t, err)
+			_, marked := got.GetLabels()[labelMarkedAt]
+			assert.Equal(t, tt.wantMarked, marked, "marked-at label")
+		})
+	}
+}
+
+func TestProcessItemKeepsEmptyNamespaceMark(t *testing.T) {
+	ns := &unstructured.Unstructured{}
+	ns.SetAPIVersion("v1")
+	ns.SetKind("Namespace")
+	ns.SetName("team-a")
+	ns.SetAnnotations(map[string]string{annotationEmptySince: time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)})
+	ns.SetLabels(map[string]string{labelMarkedAt: strconv.FormatInt(time.Now().Unix(), 10)})
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), ns)
+	j := &Janitor{
+		DynamicClient: client,
+		Config:        Config{EmptyNamespaceTTL: 24 * time.Hour, ConfirmationPeriod: 24 * time.Hour},
+		EventRecorder: record.NewFakeRecorder(10),
+	}
+	j.processItem(context.Background(), WorkItem{Resource: namespacesGVR, Name: "team-a", Obj: ns})
+
+	got, err := client.Resource(namespacesGVR).Get(context.Background(), "team-a", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, got.GetLabels(), labelMarkedAt, "the mark of an expired empty namespace is kept")
+}
+
+// preferredDiscovery serves its resources as the preferred ones, which the
+// fake discovery client leaves empty
+type preferredDiscovery struct {
+	*fakediscovery.FakeDiscovery
+}
+
+func (d preferredDiscovery) ServerPreferredResources() ([]*metav1.APIResourceList, error) {
+	return d.Resources, nil
+}
+
+func TestCleanupFindsEmptyNamespaces(t *testing.T) {
+	serviceAccountsGVR := schema.GroupVersionResource{Version: "v1", Resource: "serviceaccounts"}
+	configMapsGVR := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+	tests := []struct {
+		name   string
+		ignore []string
+	}{
+		{name: "ignored by name", ignore: []string{"ServiceAccount/default"}},
+		{name: "ignored kind that is processed", ignore: []string{"ServiceAccount"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			object := func(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+				obj := &unstructured.Unstructured{}
+				obj.SetAPIVersion(apiVersion)
+				obj.SetKind(kind)
+				obj.SetNamespace(namespace)
+				obj.SetName(name)
+				return obj
+			}
+			client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+				map[schema.GroupVersionResource]string{
+					namespacesGVR:      "NamespaceList",
+					serviceAccountsGVR: "ServiceAccountList",
+					configMapsGVR:      "ConfigMapList",
+				},
+				object("v1", "Namespace", "", "empty"),
+				object("v1", "Namespace", "", "used"),
+				object("v1", "ServiceAccount", "empty", "default"),
+				object("v1", "ServiceAccount", "used", "default"),
+				object("v1", "ConfigMap", "used", "settings"),
+			)
+
+			discovery := kubefake.NewSimpleClientset().Discovery().(*fakediscovery.FakeDiscovery)
+			discovery.Resources = []*metav1.APIResourceList{
+				{
+					GroupVersion: "v1",
+					APIResources: []metav1.APIResource{
+						{Name: "namespaces", Kind: "Namespace", Verbs: metav1.Verbs{"list"}},
+						{Name: "serviceaccounts", Kind: "ServiceAccount", Namespaced: true, Verbs: metav1.Verbs{"list", "delete"}},
+						{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: metav1.Verbs{"list", "delete"}},
+					},
+				},
+			}
+
+			ignored, err := parseEmptyNamespaceIgnore(tt.ignore)
+			require.NoError(t, err)
+			j := &Janitor{
+				Clientset: kubefake.NewSimpleClientset(
+					&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "empty"}},
+					&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "used"}},
+				),
+				DynamicClient:        client,
+				DiscoveryClient:      preferredDiscovery{discovery},
+				Config:               Config{EmptyNamespaceTTL: 24 * time.Hour},
+				ResourceFilter:       NewResourceFilter(nil, nil, nil, nil),
+				WorkQueue:            make(chan WorkItem, 10),
+				EventRecorder:        record.NewFakeRecorder(10),
+				emptyNamespaceIgnore: ignored,
+			}
+			j.wg.Add(1)
+			go j.worker(ctx)
+
+			require.NoError(t, j.cleanup(ctx))
+
+			for name, wantStamped := range map[string]bool{"empty": true, "used": false} {
+				got, err := client.Resource(namespacesGVR).Get(ctx, name, metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, wantStamped, got.GetAnnotations()[annotationEmptySince] != "", name)
+			}
+		})
+	}
+}
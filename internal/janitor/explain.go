@@ -0,0 +1,307 @@
+package janitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/audit"
+	"github.com/blaxel-ai/kube-janitor-go/internal/rules"
+	"github.com/blaxel-ai/kube-janitor-go/pkg/actions"
+	"github.com/blaxel-ai/kube-janitor-go/pkg/duration"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// decisionExcluded is reported for objects the resource and namespace filters skip
+const decisionExcluded audit.Decision = "excluded"
+
+// Check is a single step of an explanation
+type Check struct {
+	Name   string
+	Passed bool
+	Detail string
+}
+
+// Explanation traces how the janitor evaluates a single object
+type Explanation struct {
+	Resource  schema.GroupVersionResource
+	Namespace string
+	Name      string
+	UID       string
+	Created   time.Time
+
+	Filters     []Check
+	Annotations []Check
+	// RulesIgnored explains why rules were not consulted, if they were not
+	RulesIgnored string
+	Rules        []rules.RuleTrace
+
+	// Schedule is set when the object is subject to deletion
+	TTL        duration.Duration
+	Source     string
+	Since      time.Time
+	TimeSource rules.TimeSource
+	DeleteAt   time.Time
+	Action     string
+
+	Decision audit.Decision
+	Reason   string
+}
+
+// Explain fetches an object and traces the filters, annotations and rules
+// that decide whether and when it is deleted, without modifying it
+func (j *Janitor) Explain(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) (*Explanation, error) {
+	obj, err := j.resourceClient(gvr, namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s: %w", gvr.Resource, name, err)
+	}
+	return j.explain(ctx, gvr, obj, time.Now()), nil
+}
+
+func (j *Janitor) explain(ctx context.Context, gvr schema.GroupVersionResource, obj *unstructured.Unstructured, now time.Time) *Explanation {
+	e := &Explanation{
+		Resource:  gvr,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		UID:       string(obj.GetUID()),
+		Created:   obj.GetCreationTimestamp().Time,
+	}
+
+	e.Filters = j.explainFilters(gvr, obj.GetNamespace())
+	e.Annotations = j.explainAnnotations(obj)
+
+	ruleEngine := j.ruleEngine()
+	annotations := obj.GetAnnotations()
+	if _, ok := annotations[annotationTTL]; ok {
+		e.RulesIgnored = "the janitor/ttl annotation takes precedence over rules"
+	} else if _, ok := annotations[annotationExpires]; ok {
+		e.RulesIgnored = "the janitor/expires annotation takes precedence over rules"
+	} else if ruleEngine == nil {
+		e.RulesIgnored = "no rules file is configured"
+	}
+	if ruleEngine != nil {
+		e.Rules = ruleEngine.Trace(ctx, obj)
+	}
+
+	schedule, err := j.deletionSchedule(ctx, obj)
+	if schedule != nil {
+		e.TTL = schedule.ttl
+		e.Source = schedule.describe()
+		e.Since = schedule.since
+		e.TimeSource = schedule.timeSource
+		e.DeleteAt = schedule.deleteAt
+		e.Action = schedule.actionName
+	}
+
+	for _, filter := range e.Filters {
+		if !filter.Passed {
+			e.Decision, e.Reason = decisionExcluded, filter.Detail
+			return e
+		}
+	}
+
+	switch {
+	case isRuleError(err) && schedule == nil:
+		e.Decision, e.Reason = audit.RuleError, err.Error()
+	case err != nil && schedule == nil:
+		e.Decision, e.Reason = audit.InvalidTTL, err.Error()
+	case schedule == nil:
+		e.Decision, e.Reason = audit.NoTTL, "no TTL or expiration annotation and no matching rule"
+	case !schedule.expired(now):
+		e.Decision = schedule.pendingDecision(now)
+		e.Reason = fmt.Sprintf("deletion in %s", schedule.deleteAt.Sub(now).Round(time.Second))
+	case j.pendingConfirmation(obj, now) != "":
+		e.Decision, e.Reason = audit.Marked, j.pendingConfirmation(obj, now)+": "+schedule.reason(now)
+	case !j.inDeletionWindow(schedule, now):
+		e.Decision, e.Reason = audit.Deferred, "expired, waiting for the deletion window: "+schedule.reason(now)
+	case j.Config.DryRun:
+		e.Decision, e.Reason = audit.DryRun, schedule.reason(now)
+	case e.Action != "" && e.Action != actions.Delete:
+		e.Decision, e.Reason = audit.ActionTaken, fmt.Sprintf("will %s on the next run: %s", e.Action, schedule.reason(now))
+	default:
+		e.Decision, e.Reason = audit.Deleted, "will be deleted on the next run: "+schedule.reason(now)
+	}
+	return e
+}
+
+func (j *Janitor) explainFilters(gvr schema.GroupVersionResource, namespace string) []Check {
+	var checks []Check
+
+	if j.ResourceFilter != nil {
+		passed := j.ResourceFilter.ShouldProcessResource(gvr.Resource)
+		checks = append(checks, Check{
+			Name:   "resource filter",
+			Passed: passed,
+			Detail: fmt.Sprintf("%s is %s by --include-resources/--exclude-resources", gvr.Resource, includedOrExcluded(passed)),
+		})
+
+		if namespace != "" {
+			passed := j.ResourceFilter.ShouldProcessNamespace(namespace)
+			checks = append(checks, Check{
+				Name:   "namespace filter",
+				Passed: passed,
+				Detail: fmt.Sprintf("%s is %s by --include-namespaces/--exclude-namespaces", namespace, includedOrExcluded(passed)),
+			})
+		}
+	}
+
+	if j.DiscoveryClient != nil {
+		check := Check{Name: "verbs", Detail: fmt.Sprintf("%s supports list and delete", gvr.Resource)}
+		resources, err := j.DiscoveryClient.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+		if err != nil {
+			check.Detail = fmt.Sprintf("failed to discover %s: %v", gvr.GroupVersion(), err)
+		}
+		if resources != nil {
+			for _, resource := range resources.APIResources {
+				if resource.Name == gvr.Resource {
+					check.Passed = contains(resource.Verbs, "list") && contains(resource.Verbs, "delete")
+				}
+			}
+			if !check.Passed {
+				check.Detail = fmt.Sprintf("%s does not support list and delete", gvr.Resource)
+			}
+		}
+		checks = append(checks, check)
+	}
+
+	return checks
+}
+
+func includedOrExcluded(included bool) string {
+	if included {
+		return "included"
+	}
+	return "excluded"
+}
+
+// explainAnnotations parses each janitor annotation present on the object
+func (j *Janitor) explainAnnotations(obj *unstructured.Unstructured) []Check {
+	parsers := []struct {
+		annotation string
+		parse      func(string) error
+	}{
+		{annotationTTL, func(v string) error { _, err := duration.Parse(v); return err }},
+		{annotationExpires, func(string) error { _, err := j.parseExpirationTime(obj, annotationExpires); return err }},
+		{annotationTTLFrom, func(v string) error { _, err := rules.ParseTimeSource(v); return err }},
+		{annotationSnooze, func(v string) error { _, err := duration.Parse(v); return err }},
+		{annotationExtendUntil, func(string) error { _, err := j.parseExpirationTime(obj, annotationExtendUntil); return err }},
+		{annotationProtectedUntil, func(v string) error { _, err := time.Parse(time.RFC3339, v); return err }},
+		{annotationAction, func(v string) error { _, err := actions.New(v, nil); return err }},
+	}
+
+	annotations := obj.GetAnnotations()
+	var checks []Check
+	for _, p := range parsers {
+		value, ok := annotations[p.annotation]
+		if !ok {
+			continue
+		}
+		check := Check{Name: p.annotation, Passed: true, Detail: value}
+		if err := p.parse(value); err != nil {
+			check.Passed = false
+			check.Detail = fmt.Sprintf("%s: %v", value, err)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// Print writes the explanation as a human-readable trace
+func (e *Explanation) Print(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	name := e.Name
+	if e.Namespace != "" {
+		name = e.Namespace + "/" + name
+	}
+	fmt.Fprintf(w, "Resource:\t%s %s\n", e.Resource.Resource, name)
+	fmt.Fprintf(w, "UID:\t%s\n", e.UID)
+	fmt.Fprintf(w, "Created:\t%s\n", formatTime(e.Created))
+
+	fmt.Fprintln(w, "\nFilters:")
+	printChecks(w, e.Filters)
+
+	fmt.Fprintln(w, "\nAnnotations:")
+	if len(e.Annotations) == 0 {
+		fmt.Fprintln(w, "  (none)")
+	}
+	printChecks(w, e.Annotations)
+
+	fmt.Fprintln(w, "\nRules:")
+	if e.RulesIgnored != "" {
+		fmt.Fprintf(w, "  (%s)\n", e.RulesIgnored)
+	}
+	matched := false
+	for _, trace := range e.Rules {
+		var result string
+		switch {
+		case !trace.ResourceMatched:
+			result = "skipped\tresource not selected by the rule"
+		case trace.NotSelected != "":
+			result = fmt.Sprintf("skipped\t%s", trace.NotSelected)
+		case trace.ErrorDecides() && !matched && e.RulesIgnored == "":
+			// The policy decides the outcome, so later rules are not used
+			matched = true
+			result = fmt.Sprintf("error\t%v (onError: %s)", trace.Err, trace.Rule.OnError)
+		case trace.Err != nil:
+			result = fmt.Sprintf("error\t%v (onError: %s)", trace.Err, trace.Rule.OnError)
+		case trace.Matched && !matched && e.RulesIgnored == "":
+			matched = true
+			result = fmt.Sprintf("matched\t%s, %s (first match wins)", trace.Result, describeRuleTTL(trace))
+		case trace.Matched:
+			result = fmt.Sprintf("matched\t%s, %s (not used)", trace.Result, describeRuleTTL(trace))
+		default:
+			result = fmt.Sprintf("no match\t%s", trace.Result)
+		}
+		fmt.Fprintf(w, "  %s\t%s\n", trace.Rule.ID, result)
+	}
+
+	fmt.Fprintln(w, "\nSchedule:")
+	if e.DeleteAt.IsZero() {
+		fmt.Fprintln(w, "  (not scheduled for deletion)")
+	} else {
+		if !e.TTL.IsZero() {
+			fmt.Fprintf(w, "  Effective TTL:\t%s\n", e.TTL)
+			fmt.Fprintf(w, "  Measured from:\t%s (%s)\n", e.TimeSource, formatTime(e.Since))
+		}
+		fmt.Fprintf(w, "  Source:\t%s\n", e.Source)
+		fmt.Fprintf(w, "  Deletion time:\t%s\n", formatTime(e.DeleteAt))
+		if e.Action != "" && e.Action != actions.Delete {
+			fmt.Fprintf(w, "  Action:\t%s\n", e.Action)
+		}
+	}
+
+	fmt.Fprintf(w, "\nDecision:\t%s\n", e.Decision)
+	fmt.Fprintf(w, "Reason:\t%s\n", e.Reason)
+	return w.Flush()
+}
+
+// describeRuleTTL tells the TTL or expiration time a matched rule computed
+func describeRuleTTL(trace rules.RuleTrace) string {
+	switch {
+	case trace.TTLErr != nil:
+		return fmt.Sprintf("ttl %s (ttlExpression failed: %v)", trace.TTL, trace.TTLErr)
+	case !trace.Expires.IsZero():
+		return fmt.Sprintf("expires %s", formatTime(trace.Expires))
+	default:
+		return fmt.Sprintf("ttl %s", trace.TTL)
+	}
+}
+
+func printChecks(w io.Writer, checks []Check) {
+	for _, check := range checks {
+		status := "pass"
+		if !check.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", status, check.Name, check.Detail)
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,192 @@
+package janitor
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/audit"
+	"github.com/blaxel-ai/kube-janitor-go/internal/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+var podsGVR = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+func TestExplain(t *testing.T) {
+	engine, err := rules.New([]rules.Rule{
+		{ID: "services", Resources: []string{"services"}, Expression: "true", TTL: "1h"},
+		{ID: "labelled", Resources: []string{"pods"}, Expression: `has(object.metadata.labels) && object.metadata.labels.temp == "true"`, TTL: "1h"},
+		{ID: "all-pods", Resources: []string{"pods"}, Expression: "true", TTL: "3h"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		annotations  map[string]interface{}
+		age          time.Duration
+		exclude      []string
+		dryRun       bool
+		wantDecision audit.Decision
+		wantTTL      time.Duration
+		wantOutput   []string
+	}{
+		{
+			name:         "rule not expired",
+			age:          time.Hour,
+			wantDecision: audit.NotExpired,
+			wantTTL:      3 * time.Hour,
+			wantOutput: []string{
+				"services  skipped",
+				"labelled  no match",
+				"all-pods  matched   true, ttl 3h (first match wins)",
+				"Effective TTL:  3h",
+				"Decision:  not-expired",
+				"deletion in 2h0m0s",
+			},
+		},
+		{
+			name:         "annotation takes precedence",
+			annotations:  map[string]interface{}{annotationTTL: "30m"},
+			age:          time.Hour,
+			wantDecision: audit.Deleted,
+			wantTTL:      30 * time.Minute,
+			wantOutput: []string{
+				"pass  janitor/ttl  30m",
+				"(the janitor/ttl annotation takes precedence over rules)",
+				"all-pods  matched   true, ttl 3h (not used)",
+				"will be deleted on the next run",
+			},
+		},
+		{
+			name:         "dry run",
+			annotations:  map[string]interface{}{annotationTTL: "30m"},
+			age:          time.Hour,
+			dryRun:       true,
+			wantDecision: audit.DryRun,
+			wantTTL:      30 * time.Minute,
+		},
+		{
+			name:         "invalid annotation",
+			annotations:  map[string]interface{}{annotationTTL: "soon"},
+			age:          time.Hour,
+			wantDecision: audit.InvalidTTL,
+			wantOutput:   []string{"FAIL  janitor/ttl  soon: invalid duration format", "(not scheduled for deletion)"},
+		},
+		{
+			name:         "excluded resource",
+			age:          time.Hour,
+			exclude:      []string{"pods"},
+			wantDecision: decisionExcluded,
+			wantTTL:      3 * time.Hour,
+			wantOutput:   []string{"FAIL  resource filter"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newScheduledPod(tt.annotations, tt.age)
+			j := &Janitor{
+				RuleEngine:     engine,
+				ResourceFilter: NewResourceFilter(nil, tt.exclude, nil, nil),
+				Config:         Config{DryRun: tt.dryRun},
+			}
+
+			// Timestamps are truncated to seconds, so measure from the creation time
+			e := j.explain(context.Background(), podsGVR, pod, pod.GetCreationTimestamp().Add(tt.age))
+			assert.Equal(t, tt.wantDecision, e.Decision)
+			assert.Equal(t, tt.wantTTL, e.TTL.Fixed)
+			require.Len(t, e.Rules, 3)
+
+			var out bytes.Buffer
+			require.NoError(t, e.Print(&out))
+			for _, want := range tt.wantOutput {
+				assert.Contains(t, out.String(), want)
+			}
+		})
+	}
+}
+
+func TestExplainFetchesObject(t *testing.T) {
+	pod := newScheduledPod(map[string]interface{}{annotationTTL: "2h"}, time.Hour)
+
+	discovery := kubefake.NewSimpleClientset().Discovery().(*fakediscovery.FakeDiscovery)
+	discovery.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", Namespaced: true, Verbs: metav1.Verbs{"get", "list", "delete"}},
+			},
+		},
+	}
+
+	j := &Janitor{
+		DynamicClient:   fake.NewSimpleDynamicClient(runtime.NewScheme(), pod),
+		DiscoveryClient: discovery,
+		ResourceFilter:  NewResourceFilter(nil, nil, nil, []string{"kube-system"}),
+	}
+
+	e, err := j.Explain(context.Background(), podsGVR, "default", "test-pod")
+	require.NoError(t, err)
+	assert.Equal(t, audit.NotExpired, e.Decision)
+	require.Len(t, e.Filters, 3)
+	for _, filter := range e.Filters {
+		assert.True(t, filter.Passed, filter.Name)
+	}
+	assert.WithinDuration(t, time.Now().Add(time.Hour), e.DeleteAt, time.Minute)
+
+	_, err = j.Explain(context.Background(), podsGVR, "default", "missing")
+	assert.Error(t, err)
+}
+
+func TestExplainRuleError(t *testing.T) {
+	tests := []struct {
+		onError      string
+		wantDecision audit.Decision
+		wantOutput   []string
+	}{
+		{
+			onError:      rules.OnErrorSkip,
+			wantDecision: audit.NotExpired,
+			wantOutput:   []string{"broken    error    no such key: spec (onError: skip)", "all-pods  matched  true, ttl 3h (first match wins)"},
+		},
+		{
+			onError:      rules.OnErrorMatch,
+			wantDecision: audit.Deleted,
+			wantOutput:   []string{"broken    error    no such key: spec (onError: match)", "all-pods  matched  true, ttl 3h (not used)"},
+		},
+		{
+			onError:      rules.OnErrorFail,
+			wantDecision: audit.RuleError,
+			wantOutput:   []string{"Decision:  rule-error", "rule 'broken' failed to evaluate"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.onError, func(t *testing.T) {
+			engine, err := rules.New([]rules.Rule{
+				{ID: "broken", Resources: []string{"pods"}, Expression: `object.spec.nodeName == "a"`, TTL: "1h", OnError: tt.onError},
+				{ID: "all-pods", Resources: []string{"pods"}, Expression: "true", TTL: "3h"},
+			})
+			require.NoError(t, err)
+
+			pod := newScheduledPod(nil, 2*time.Hour)
+			j := &Janitor{RuleEngine: engine}
+			e := j.explain(context.Background(), podsGVR, pod, pod.GetCreationTimestamp().Add(2*time.Hour))
+			assert.Equal(t, tt.wantDecision, e.Decision)
+
+			var out bytes.Buffer
+			require.NoError(t, e.Print(&out))
+			for _, want := range tt.wantOutput {
+				assert.Contains(t, out.String(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package janitor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/metrics"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Policies for TTL and expiration annotations whose value cannot be parsed
+const (
+	// InvalidAnnotationProtect keeps the resource until the annotation is fixed
+	InvalidAnnotationProtect = "protect"
+	// InvalidAnnotationIgnore treats the annotation as missing, so the
+	// remaining annotations and rules decide
+	InvalidAnnotationIgnore = "ignore"
+	// InvalidAnnotationExpire deletes the resource as if it had expired
+	InvalidAnnotationExpire = "expire"
+)
+
+func validateInvalidAnnotationPolicy(policy string) error {
+	switch policy {
+	case "", InvalidAnnotationProtect, InvalidAnnotationIgnore, InvalidAnnotationExpire:
+		return nil
+	default:
+		return fmt.Errorf("invalid annotation policy '%s': must be one of %s, %s, %s",
+			policy, InvalidAnnotationProtect, InvalidAnnotationIgnore, InvalidAnnotationExpire)
+	}
+}
+
+// invalidAnnotationError reports a janitor annotation whose value cannot be parsed
+type invalidAnnotationError struct {
+	annotation string
+	value      string
+	err        error
+}
+
+func (e *invalidAnnotationError) Error() string {
+	return fmt.Sprintf("invalid %s annotation '%s': %v", e.annotation, e.value, e.err)
+}
+
+func (e *invalidAnnotationError) Unwrap() error {
+	return e.err
+}
+
+// invalidAnnotations returns the invalid annotations reported by deletionSchedule
+func invalidAnnotations(err error) []*invalidAnnotationError {
+	if err == nil {
+		return nil
+	}
+
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+
+	var invalid []*invalidAnnotationError
+	for _, err := range errs {
+		var annotationErr *invalidAnnotationError
+		if errors.As(err, &annotationErr) {
+			invalid = append(invalid, annotationErr)
+		}
+	}
+	return invalid
+}
+
+func (j *Janitor) invalidAnnotationPolicy() string {
+	if j.Config.InvalidAnnotationPolicy == "" {
+		return InvalidAnnotationProtect
+	}
+	return j.Config.InvalidAnnotationPolicy
+}
+
+// invalidAnnotationSchedule applies the invalid annotation policy to an
+// object whose TTL or expiration annotation cannot be parsed. It returns nil
+// when the object is protected.
+func (j *Janitor) invalidAnnotationSchedule(obj *unstructured.Unstructured, invalid *invalidAnnotationError) *deletionSchedule {
+	if j.invalidAnnotationPolicy() != InvalidAnnotationExpire {
+		return nil
+	}
+
+	created := obj.GetCreationTimestamp().Time
+	return &deletionSchedule{
+		deleteAt: created,
+		since:    created,
+		invalid:  invalid,
+	}
+}
+
+// reportInvalidAnnotations logs every invalid annotation found on an item and,
+// once per resource version, counts it and emits an InvalidAnnotation event so
+// the owner learns why the annotation has no effect
+func (j *Janitor) reportInvalidAnnotations(item WorkItem, err error, logger *logrus.Entry) {
+	invalid := invalidAnnotations(err)
+	if len(invalid) == 0 {
+		j.invalidReports.forget(item.Obj.GetUID())
+		return
+	}
+
+	policy := j.invalidAnnotationPolicy()
+	for _, annotationErr := range invalid {
+		logger.WithError(annotationErr).WithField("policy", policy).Warn("Invalid annotation")
+	}
+
+	if !j.invalidReports.allow(item.Obj.GetUID(), item.Obj.GetResourceVersion()) {
+		return
+	}
+
+	var consequence string
+	switch policy {
+	case InvalidAnnotationIgnore:
+		consequence = "the annotation is ignored"
+	case InvalidAnnotationExpire:
+		consequence = "the resource will be deleted"
+	default:
+		consequence = "the resource is kept until the annotation is fixed"
+	}
+
+	ref := objectReference(item)
+	for _, annotationErr := range invalid {
+		metrics.InvalidAnnotations.WithLabelValues(item.Resource.Resource, annotationErr.annotation).Inc()
+		eventMessage := fmt.Sprintf("Invalid %s annotation '%s' on %s %s/%s: %v; %s",
+			annotationErr.annotation, annotationErr.value, item.Resource.Resource, item.Namespace, item.Name,
+			annotationErr.err, consequence)
+		j.EventRecorder.Event(ref, corev1.EventTypeWarning, "InvalidAnnotation", eventMessage)
+	}
+}
+
+// reportLimiter remembers the resource version at which each object was last
+// reported, so that a problem is reported once per change of the object
+// rather than on every run
+type reportLimiter struct {
+	mu       sync.Mutex
+	reported map[types.UID]reportedVersion
+}
+
+type reportedVersion struct {
+	resourceVersion string
+	// seen is set when the object was checked since the previous prune
+	seen bool
+}
+
+// allow reports whether the given version of the object has not been reported yet
+func (l *reportLimiter) allow(uid types.UID, resourceVersion string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.reported == nil {
+		l.reported = make(map[types.UID]reportedVersion)
+	}
+	reported, ok := l.reported[uid]
+	l.reported[uid] = reportedVersion{resourceVersion: resourceVersion, seen: true}
+	return !ok || reported.resourceVersion != resourceVersion
+}
+
+// forget drops the object, so it is reported again if the problem comes back
+func (l *reportLimiter) forget(uid types.UID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.reported, uid)
+}
+
+// prune drops the objects not checked since the previous prune, such as
+// deleted ones
+func (l *reportLimiter) prune() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for uid, reported := range l.reported {
+		if !reported.seen {
+			delete(l.reported, uid)
+			continue
+		}
+		reported.seen = false
+		l.reported[uid] = reported
+	}
+}
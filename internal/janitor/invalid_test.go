@@ -0,0 +1,173 @@
+package janitor
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestInvalidAnnotationPolicy(t *testing.T) {
+	past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name        string
+		policy      string
+		annotations map[string]interface{}
+		wantDeleted bool
+		wantEvents  int
+	}{
+		{
+			name:        "protect by default",
+			annotations: map[string]interface{}{annotationTTL: "3 fortnights"},
+			wantEvents:  1,
+		},
+		{
+			name:        "protect ignores valid expiration",
+			policy:      InvalidAnnotationProtect,
+			annotations: map[string]interface{}{annotationTTL: "3 fortnights", annotationExpires: past},
+			wantEvents:  1,
+		},
+		{
+			name:        "ignore falls back to expiration",
+			policy:      InvalidAnnotationIgnore,
+			annotations: map[string]interface{}{annotationTTL: "3 fortnights", annotationExpires: past},
+			wantDeleted: true,
+			wantEvents:  1,
+		},
+		{
+			name:        "ignore reports every invalid annotation",
+			policy:      InvalidAnnotationIgnore,
+			annotations: map[string]interface{}{annotationTTL: "3 fortnights", annotationExpires: "tomorrow"},
+			wantEvents:  2,
+		},
+		{
+			name:        "expire deletes",
+			policy:      InvalidAnnotationExpire,
+			annotations: map[string]interface{}{annotationExpires: "tomorrow"},
+			wantDeleted: true,
+			wantEvents:  1,
+		},
+		{
+			name:        "expire respects protection",
+			policy:      InvalidAnnotationExpire,
+			annotations: map[string]interface{}{annotationTTL: "3 fortnights", annotationProtectedUntil: future},
+			wantEvents:  1,
+		},
+		{
+			name:        "valid annotation is not reported",
+			policy:      InvalidAnnotationExpire,
+			annotations: map[string]interface{}{annotationTTL: "1h"},
+			wantDeleted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newScheduledPod(tt.annotations, 2*time.Hour)
+			client := fake.NewSimpleDynamicClient(runtime.NewScheme(), pod)
+			recorder := record.NewFakeRecorder(10)
+			j := &Janitor{
+				DynamicClient: client,
+				Config:        Config{InvalidAnnotationPolicy: tt.policy},
+				EventRecorder: recorder,
+			}
+
+			j.processItem(context.Background(), WorkItem{
+				Resource:  podsGVR,
+				Namespace: "default",
+				Name:      "test-pod",
+				Obj:       pod,
+			})
+
+			_, err := client.Resource(podsGVR).Namespace("default").Get(context.Background(), "test-pod", metav1.GetOptions{})
+			assert.Equal(t, tt.wantDeleted, errors.IsNotFound(err))
+
+			invalidEvents := 0
+			for len(recorder.Events) > 0 {
+				if strings.HasPrefix(<-recorder.Events, "Warning InvalidAnnotation") {
+					invalidEvents++
+				}
+			}
+			assert.Equal(t, tt.wantEvents, invalidEvents)
+		})
+	}
+}
+
+func TestReportInvalidAnnotationsOncePerVersion(t *testing.T) {
+	pod := newScheduledPod(map[string]interface{}{annotationTTL: "3 fortnights"}, time.Hour)
+	pod.SetUID("1234")
+	pod.SetResourceVersion("1")
+
+	recorder := record.NewFakeRecorder(10)
+	j := &Janitor{
+		DynamicClient: fake.NewSimpleDynamicClient(runtime.NewScheme(), pod),
+		EventRecorder: recorder,
+	}
+	counter := metrics.InvalidAnnotations.WithLabelValues("pods", annotationTTL)
+	before := testutil.ToFloat64(counter)
+
+	process := func() {
+		j.processItem(context.Background(), WorkItem{
+			Resource:  podsGVR,
+			Namespace: "default",
+			Name:      "test-pod",
+			Obj:       pod,
+		})
+	}
+
+	process()
+	process()
+	require.Len(t, recorder.Events, 1)
+	event := <-recorder.Events
+	assert.Contains(t, event, "Warning InvalidAnnotation")
+	assert.Contains(t, event, "Invalid janitor/ttl annotation '3 fortnights'")
+	assert.Contains(t, event, "the resource is kept until the annotation is fixed")
+
+	// A new version of the object is reported again
+	pod.SetResourceVersion("2")
+	process()
+	assert.Len(t, recorder.Events, 1)
+	<-recorder.Events
+
+	// Once fixed, the object is forgotten and a new mistake is reported
+	pod.SetAnnotations(map[string]string{annotationTTL: "3d"})
+	process()
+	pod.SetAnnotations(map[string]string{annotationTTL: "3 fortnights"})
+	process()
+	assert.Len(t, recorder.Events, 1)
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(counter)-before)
+}
+
+func TestReportLimiterPrune(t *testing.T) {
+	var limiter reportLimiter
+	assert.True(t, limiter.allow("deleted", "1"))
+	assert.True(t, limiter.allow("kept", "1"))
+
+	limiter.prune()
+	assert.False(t, limiter.allow("kept", "1"))
+	limiter.prune()
+
+	assert.Len(t, limiter.reported, 1)
+	assert.Contains(t, limiter.reported, types.UID("kept"))
+}
+
+func TestValidateInvalidAnnotationPolicy(t *testing.T) {
+	for _, policy := range []string{"", InvalidAnnotationProtect, InvalidAnnotationIgnore, InvalidAnnotationExpire} {
+		assert.NoError(t, validateInvalidAnnotationPolicy(policy))
+	}
+	assert.ErrorContains(t, validateInvalidAnnotationPolicy("delete"), "must be one of protect, ignore, expire")
+}
@@ -2,16 +2,22 @@ package janitor
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
-	"regexp"
-	"strconv"
-	"strings"
 	"sync"
 	"time"
 
+	"github.com/blaxel-ai/kube-janitor-go/internal/archive"
+	"github.com/blaxel-ai/kube-janitor-go/internal/audit"
+	"github.com/blaxel-ai/kube-janitor-go/internal/crd"
+	"github.com/blaxel-ai/kube-janitor-go/internal/expires"
 	"github.com/blaxel-ai/kube-janitor-go/internal/metrics"
+	"github.com/blaxel-ai/kube-janitor-go/internal/notify"
 	"github.com/blaxel-ai/kube-janitor-go/internal/rules"
+	"github.com/blaxel-ai/kube-janitor-go/internal/window"
+	"github.com/blaxel-ai/kube-janitor-go/pkg/actions"
+	"github.com/blaxel-ai/kube-janitor-go/pkg/duration"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
@@ -19,30 +25,73 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/record"
 )
 
 const (
-	annotationTTL     = "janitor/ttl"
-	annotationExpires = "janitor/expires"
+	annotationTTL               = "janitor/ttl"
+	annotationExpires           = "janitor/expires"
+	annotationScheduledDeletion = "janitor/scheduled-deletion"
+	annotationTTLFrom           = "janitor/ttl-from"
+	// annotationProtectedUntil is set on restored resources so they are not
+	// deleted again right away
+	annotationProtectedUntil = "janitor/protected-until"
 )
 
 // Config holds the janitor configuration
 type Config struct {
-	DryRun            bool
-	Interval          time.Duration
-	Once              bool
-	IncludeResources  []string
-	ExcludeResources  []string
-	IncludeNamespaces []string
-	ExcludeNamespaces []string
-	RulesFile         string
-	MaxWorkers        int
+	DryRun             bool
+	Interval           time.Duration
+	Once               bool
+	IncludeResources   []string
+	ExcludeResources   []string
+	IncludeNamespaces  []string
+	ExcludeNamespaces  []string
+	RulesFile          string
+	MaxWorkers         int
+	NotifyBefore       time.Duration
+	WebhookURL         string
+	WebhookFormat      string
+	NotifyOwnerLabels  []string
+	MaxExtension       time.Duration
+	DeletionWindow     string
+	ArchiveDir         string
+	ArchiveFormat      string
+	ArchiveRetention   time.Duration
+	ArchiveS3          archive.S3Config
+	AuditLog           string
+	AuditLogMaxSize    int64
+	AuditLogMaxBackups int
+	// InvalidAnnotationPolicy is one of the InvalidAnnotation* policies
+	InvalidAnnotationPolicy string
+	// DefaultTimezone is the IANA zone for expiration times without a zone (default UTC)
+	DefaultTimezone string
+	// RuleCRDs loads rules from JanitorRule and ClusterJanitorRule resources too
+	RuleCRDs bool
+	// RuleCostLimit and RuleEvalTimeout bound each rule evaluation (zero means no bound)
+	RuleCostLimit   uint64
+	RuleEvalTimeout time.Duration
+	// RuleSchemas checks the field paths of rules against the API server's OpenAPI schemas
+	RuleSchemas bool
+	// BuiltinPolicies enables built-in policies, as <name> or <name>=<ttl>,
+	// after the rules of the rules file
+	BuiltinPolicies []string
+	// EmptyNamespaceTTL deletes namespaces that held only ignored objects for
+	// this long (zero disables it)
+	EmptyNamespaceTTL time.Duration
+	// EmptyNamespaceIgnore lists the objects, as <Kind> or <Kind>/<name>,
+	// that do not keep a namespace from being empty
+	EmptyNamespaceIgnore []string
+	// ConfirmationPeriod only labels expired resources at first, and acts on
+	// them once they stayed expired for this long (zero acts right away)
+	ConfirmationPeriod time.Duration
 }
 
 // Janitor is the main cleanup controller
@@ -52,10 +101,25 @@ type Janitor struct {
 	DiscoveryClient discovery.DiscoveryInterface
 	Config          Config
 	RuleEngine      *rules.Engine
+	RuleController  *crd.Controller
+	rulesMu         sync.RWMutex
 	ResourceFilter  *ResourceFilter
 	WorkQueue       chan WorkItem
 	wg              sync.WaitGroup
 	EventRecorder   record.EventRecorder
+	Notifier        notify.Notifier
+	DeletionWindow  *window.Window
+	Timezone        *time.Location
+	Archive         archive.Sink
+	Audit           *audit.Logger
+	invalidReports  reportLimiter
+	decisions       decisionCache
+	ruleMatches     ruleMatches
+	dryRunStamps    annotationStamps
+	dryRunMarks     markStamps
+	namespaces      *namespaceCache
+	// emptyNamespaceIgnore is the parsed EmptyNamespaceIgnore
+	emptyNamespaceIgnore []ignoredObject
 }
 
 // WorkItem represents an item to be processed
@@ -64,6 +128,7 @@ type WorkItem struct {
 	Namespace string
 	Name      string
 	Obj       *unstructured.Unstructured
+	run       *cleanupRun
 }
 
 // New creates a new Janitor instance
@@ -78,14 +143,120 @@ func New(clientset kubernetes.Interface, restConfig *rest.Config, config Config)
 		return nil, fmt.Errorf("failed to create discovery client: %w", err)
 	}
 
-	var ruleEngine *rules.Engine
+	timezone := time.UTC
+	if config.DefaultTimezone != "" {
+		timezone, err = time.LoadLocation(config.DefaultTimezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid default timezone: %w", err)
+		}
+	}
+
+	namespaces := newNamespaceCache(clientset)
+	owners := &ownerLookup{
+		client: dynamicClient,
+		mapper: restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient)),
+	}
+	ruleOptions := []rules.Option{
+		rules.WithDefaultTimezone(timezone),
+		rules.WithNamespaceLabels(namespaces.namespaceLabels),
+		rules.WithOwnerLookup(owners.owner),
+		rules.WithCostLimit(config.RuleCostLimit),
+		rules.WithEvalTimeout(config.RuleEvalTimeout),
+		// Shared so that the counts survive rebuilds by the rule controller
+		rules.WithStats(rules.NewStats()),
+	}
+	rulesEnabled := config.RulesFile != "" || config.RuleCRDs || len(config.BuiltinPolicies) > 0
+	if config.RuleSchemas && rulesEnabled {
+		schemas, err := loadSchemas(discoveryClient.OpenAPIV3())
+		if err != nil {
+			return nil, err
+		}
+		ruleOptions = append(ruleOptions, rules.WithSchemas(schemas))
+	}
+
+	var fileRules []rules.Rule
 	if config.RulesFile != "" {
-		ruleEngine, err = rules.LoadFromFile(config.RulesFile)
+		fileRules, err = rules.ReadFile(config.RulesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load rules: %w", err)
+		}
+	}
+	policyRules, err := rules.ParseBuiltinPolicies(config.BuiltinPolicies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid builtin policies: %w", err)
+	}
+	// Expanded, so that the rule controller knows the IDs of every rule
+	fileRules, err = rules.ExpandBuiltins(append(fileRules, policyRules...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rules: %w", err)
+	}
+
+	var ruleEngine *rules.Engine
+	if rulesEnabled {
+		ruleEngine, err = rules.New(fileRules, ruleOptions...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load rules: %w", err)
 		}
 	}
 
+	if err := validateInvalidAnnotationPolicy(config.InvalidAnnotationPolicy); err != nil {
+		return nil, err
+	}
+
+	emptyNamespaceIgnore, err := parseEmptyNamespaceIgnore(config.EmptyNamespaceIgnore)
+	if err != nil {
+		return nil, err
+	}
+
+	var deletionWindow *window.Window
+	if config.DeletionWindow != "" {
+		deletionWindow, err = window.Parse(config.DeletionWindow)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deletion window: %w", err)
+		}
+	}
+
+	var notifier notify.Notifier
+	if config.WebhookURL != "" {
+		notifier, err = notify.NewWebhookNotifier(config.WebhookURL, config.WebhookFormat)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create notifier: %w", err)
+		}
+	}
+
+	var sinks archive.Multi
+	if config.ArchiveDir != "" {
+		sink, err := archive.New(config.ArchiveFormat, config.ArchiveDir, config.ArchiveRetention)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create archive: %w", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if config.ArchiveS3.Bucket != "" {
+		sink, err := archive.NewS3Sink(config.ArchiveS3)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create S3 archive: %w", err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	var archiveSink archive.Sink
+	switch len(sinks) {
+	case 0:
+	case 1:
+		archiveSink = sinks[0]
+	default:
+		archiveSink = sinks
+	}
+
+	var auditLogger *audit.Logger
+	if config.AuditLog != "" {
+		auditLogger, err = audit.New(config.AuditLog, config.AuditLogMaxSize, config.AuditLogMaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+	}
+
 	resourceFilter := NewResourceFilter(config.IncludeResources, config.ExcludeResources,
 		config.IncludeNamespaces, config.ExcludeNamespaces)
 
@@ -98,7 +269,7 @@ func New(clientset kubernetes.Interface, restConfig *rest.Config, config Config)
 		Host:      os.Getenv("HOSTNAME"),
 	})
 
-	return &Janitor{
+	j := &Janitor{
 		Clientset:       clientset,
 		DynamicClient:   dynamicClient,
 		DiscoveryClient: discoveryClient,
@@ -108,18 +279,61 @@ func New(clientset kubernetes.Interface, restConfig *rest.Config, config Config)
 		WorkQueue:       make(chan WorkItem, 1000),
 		wg:              sync.WaitGroup{},
 		EventRecorder:   recorder,
-	}, nil
+		Notifier:        notifier,
+		DeletionWindow:  deletionWindow,
+		Timezone:        timezone,
+		Archive:         archiveSink,
+		Audit:           auditLogger,
+		namespaces:      namespaces,
+
+		emptyNamespaceIgnore: emptyNamespaceIgnore,
+	}
+	if config.RuleCRDs {
+		j.RuleController = crd.NewController(dynamicClient, fileRules, j.setRuleEngine, ruleOptions...)
+	}
+	return j, nil
+}
+
+// ruleEngine returns the current rules engine, which the rule controller
+// replaces whenever a rule resource changes
+func (j *Janitor) ruleEngine() *rules.Engine {
+	j.rulesMu.RLock()
+	defer j.rulesMu.RUnlock()
+	return j.RuleEngine
+}
+
+func (j *Janitor) setRuleEngine(engine *rules.Engine) {
+	j.rulesMu.Lock()
+	defer j.rulesMu.Unlock()
+	j.RuleEngine = engine
+}
+
+// LoadRules loads the rule resources once, without watching them or updating
+// their status, for commands that evaluate objects outside of Run
+func (j *Janitor) LoadRules(ctx context.Context) error {
+	if j.RuleController == nil {
+		return nil
+	}
+	return j.RuleController.Load(ctx)
 }
 
 // Run starts the janitor
 func (j *Janitor) Run(ctx context.Context) error {
 	logrus.Info("Starting janitor")
 
+	if j.RuleController != nil {
+		if err := j.RuleController.Run(ctx); err != nil {
+			j.closeOutputs()
+			return fmt.Errorf("failed to watch rule resources: %w", err)
+		}
+	}
+
 	// Start workers
 	for i := 0; i < j.Config.MaxWorkers; i++ {
 		j.wg.Add(1)
 		go j.worker(ctx)
 	}
+	defer j.shutdown()
 
 	// Run cleanup loop
 	if j.Config.Once {
@@ -146,16 +360,37 @@ func (j *Janitor) Run(ctx context.Context) error {
 				}
 			case <-ctx.Done():
 				logrus.Info("Shutting down janitor")
-				close(j.WorkQueue)
-				j.wg.Wait()
 				return nil
 			}
 		}
 	}
 
+	return nil
+}
+
+// shutdown waits for the workers to finish, then closes the archive,
+// completing the runs that could not finish, and the audit log
+func (j *Janitor) shutdown() {
 	close(j.WorkQueue)
 	j.wg.Wait()
-	return nil
+	j.closeOutputs()
+}
+
+// closeOutputs completes the archive's open runs, stops its uploads and
+// closes the audit log
+func (j *Janitor) closeOutputs() {
+	if j.Archive != nil {
+		if err := j.Archive.Close(); err != nil {
+			logrus.WithError(err).Error("Failed to close archive")
+			metrics.Errors.WithLabelValues("archive").Inc()
+		}
+	}
+	if j.Audit != nil {
+		if err := j.Audit.Close(); err != nil {
+			logrus.WithError(err).Error("Failed to close audit log")
+			metrics.Errors.WithLabelValues("audit").Inc()
+		}
+	}
 }
 
 func (j *Janitor) cleanup(ctx context.Context) error {
@@ -169,6 +404,11 @@ func (j *Janitor) cleanup(ctx context.Context) error {
 		return fmt.Errorf("failed to discover resources: %w", err)
 	}
 
+	run := newCleanupRun()
+	if j.Config.EmptyNamespaceTTL > 0 {
+		run.namespaces = newNamespaceInventory(j.emptyNamespaceIgnore)
+	}
+
 	// Process each resource type
 	for _, resourceList := range resources {
 		if resourceList == nil {
@@ -182,13 +422,15 @@ func (j *Janitor) cleanup(ctx context.Context) error {
 		}
 
 		for _, resource := range resourceList.APIResources {
-			// Skip resources that can't be listed or deleted
-			if !contains(resource.Verbs, "list") || !contains(resource.Verbs, "delete") {
+			if !contains(resource.Verbs, "list") {
 				continue
 			}
 
-			// Apply resource filter
-			if !j.ResourceFilter.ShouldProcessResource(resource.Name) {
+			// Resources that can't be deleted or are filtered out are still
+			// listed to find empty namespaces, but never queued
+			process := contains(resource.Verbs, "delete") && j.ResourceFilter.ShouldProcessResource(resource.Name)
+			inventory := run.namespaces != nil && resource.Namespaced && !run.namespaces.ignoresKind(resource.Kind)
+			if !process && !inventory {
 				continue
 			}
 
@@ -206,13 +448,16 @@ func (j *Janitor) cleanup(ctx context.Context) error {
 					metrics.Errors.WithLabelValues("list_namespaces").Inc()
 					continue
 				}
+				if inventory {
+					run.namespaces.addResource()
+				}
 
 				for _, ns := range namespaces {
 					if !j.ResourceFilter.ShouldProcessNamespace(ns) {
 						continue
 					}
 
-					if err := j.processResources(ctx, gvr, ns); err != nil {
+					if err := j.processResources(ctx, gvr, resource.Kind, ns, run, process); err != nil {
 						logrus.WithError(err).WithFields(logrus.Fields{
 							"resource":  resource.Name,
 							"namespace": ns,
@@ -222,7 +467,7 @@ func (j *Janitor) cleanup(ctx context.Context) error {
 				}
 			} else {
 				// Process cluster-scoped resources
-				if err := j.processResources(ctx, gvr, ""); err != nil {
+				if err := j.processResources(ctx, gvr, resource.Kind, "", run, process); err != nil {
 					logrus.WithError(err).WithField("resource", resource.Name).Error("Failed to process resources")
 					metrics.Errors.WithLabelValues("process_resources").Inc()
 				}
@@ -230,33 +475,38 @@ func (j *Janitor) cleanup(ctx context.Context) error {
 		}
 	}
 
-	logrus.Info("Cleanup run completed")
+	j.cleanupEmptyNamespaces(ctx, run)
+	j.finish(ctx, run)
+
+	logrus.WithFields(run.report()).Info("Cleanup run completed")
 	return nil
 }
 
-func (j *Janitor) processResources(ctx context.Context, gvr schema.GroupVersionResource, namespace string) error {
-	var resourceInterface dynamic.ResourceInterface
-	if namespace != "" {
-		resourceInterface = j.DynamicClient.Resource(gvr).Namespace(namespace)
-	} else {
-		resourceInterface = j.DynamicClient.Resource(gvr)
-	}
-
-	list, err := resourceInterface.List(ctx, metav1.ListOptions{})
+// processResources lists the objects of a resource, adds them to the
+// namespace inventory and, if queue is set, queues them for processing
+func (j *Janitor) processResources(ctx context.Context, gvr schema.GroupVersionResource, kind, namespace string, run *cleanupRun, queue bool) error {
+	list, err := j.resourceClient(gvr, namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return err
 	}
 
+	run.namespaces.add(kind, namespace, list.Items)
+	if !queue {
+		return nil
+	}
+
 	for _, item := range list.Items {
 		obj := item
 		// Track evaluated resources
 		metrics.ResourcesEvaluated.WithLabelValues(gvr.Resource, namespace).Inc()
 
+		run.pending.Add(1)
 		j.WorkQueue <- WorkItem{
 			Resource:  gvr,
 			Namespace: namespace,
 			Name:      obj.GetName(),
 			Obj:       &obj,
+			run:       run,
 		}
 	}
 
@@ -273,6 +523,9 @@ func (j *Janitor) worker(ctx context.Context) {
 				return
 			}
 			j.processItem(ctx, item)
+			if item.run != nil {
+				item.run.pending.Done()
+			}
 		case <-ctx.Done():
 			return
 		}
@@ -286,101 +539,346 @@ func (j *Janitor) processItem(ctx context.Context, item WorkItem) {
 		"name":      item.Name,
 	})
 
+	j.recallSnooze(item)
+	j.recallWeekdays(item)
+	j.recallMark(item)
+
 	// Check if resource should be deleted
-	shouldDelete, reason := j.shouldDelete(item.Obj)
-	if !shouldDelete {
-		return
+	schedule, err := j.deletionSchedule(ctx, item.Obj)
+	j.reportInvalidAnnotations(item, err, logger)
+	if schedule != nil {
+		// Unstamped snoozes and weekdays already count from now, so stamping
+		// them afterwards does not change the schedule
+		j.stampSnooze(ctx, item, logger)
+		j.stampWeekdays(ctx, item, logger)
 	}
 
-	logger.WithField("reason", reason).Info("Resource marked for deletion")
+	now := time.Now()
+	expired := schedule != nil && schedule.expired(now)
+	if !expired {
+		// A rule that failed to evaluate says nothing about the item, and
+		// empty namespaces are marked by cleanupEmptyNamespaces too
+		if (schedule != nil || err == nil) && !j.emptyNamespaceExpired(item, now) {
+			j.unmark(ctx, item, logger)
+		}
+		j.warnScheduledDeletion(ctx, item, schedule, logger)
+	}
 
-	// Create a reference to the object for the event
-	ref := &corev1.ObjectReference{
-		APIVersion: item.Resource.Group + "/" + item.Resource.Version,
-		Kind:       item.Obj.GetKind(),
-		Namespace:  item.Namespace,
-		Name:       item.Name,
-		UID:        item.Obj.GetUID(),
+	if schedule == nil && isRuleError(err) {
+		j.recordDecision(item, audit.RuleError, err.Error(), nil)
+		return
+	}
+	if schedule == nil && err != nil {
+		j.recordDecision(item, audit.InvalidTTL, err.Error(), nil)
+		return
+	}
+	if schedule == nil {
+		j.recordDecision(item, audit.NoTTL, "no TTL or expiration annotation and no matching rule", nil)
+		return
 	}
 
-	if j.Config.DryRun {
-		logger.Info("DRY RUN: Would delete resource")
-		// Create event for dry-run
-		eventMessage := fmt.Sprintf("DRY RUN: Would delete %s %s/%s - %s",
-			item.Resource.Resource, item.Namespace, item.Name, reason)
-		j.EventRecorder.Event(ref, corev1.EventTypeNormal, "DryRunDeletion", eventMessage)
+	if !expired {
+		j.recordDecision(item, schedule.pendingDecision(now), "scheduled for deletion by "+schedule.describe(), schedule)
 		return
 	}
 
-	// Delete the resource
-	var resourceInterface dynamic.ResourceInterface
-	if item.Namespace != "" {
-		resourceInterface = j.DynamicClient.Resource(item.Resource).Namespace(item.Namespace)
-	} else {
-		resourceInterface = j.DynamicClient.Resource(item.Resource)
+	reason := schedule.reason(now)
+	if !j.confirmed(ctx, item, schedule, reason, now, logger) {
+		return
 	}
+	j.expire(ctx, item, schedule, reason, now, logger)
+}
 
-	err := resourceInterface.Delete(ctx, item.Name, metav1.DeleteOptions{})
-	if err != nil {
-		logger.WithError(err).Error("Failed to delete resource")
-		metrics.Errors.WithLabelValues("delete_resource").Inc()
-		// Create event for failed deletion
-		eventMessage := fmt.Sprintf("Failed to delete %s %s/%s: %v",
-			item.Resource.Resource, item.Namespace, item.Name, err)
-		j.EventRecorder.Event(ref, corev1.EventTypeWarning, "DeletionFailed", eventMessage)
+// expire takes the action of an expired item, or defers it outside the
+// deletion window
+func (j *Janitor) expire(ctx context.Context, item WorkItem, schedule *deletionSchedule, reason string, now time.Time, logger *logrus.Entry) {
+	if !j.inDeletionWindow(schedule, now) {
+		logger.WithField("reason", reason).Info("Outside deletion window, deferring deletion")
+		metrics.ResourcesDeferred.WithLabelValues(item.Resource.Resource, item.Namespace).Inc()
+		item.run.countDeferred()
+		j.recordDecision(item, audit.Deferred, reason, schedule)
 		return
 	}
 
-	logger.Info("Resource deleted")
-	metrics.ResourcesDeleted.WithLabelValues(item.Resource.Resource, item.Namespace, reason).Inc()
+	j.act(ctx, item, schedule, reason, logger)
+}
+
+// archiveItem stores the object's manifest in the archive, if one is configured
+func (j *Janitor) archiveItem(ctx context.Context, item WorkItem, schedule *deletionSchedule, reason string) error {
+	if j.Archive == nil {
+		return nil
+	}
+
+	entry := archive.Entry{
+		RunID:     item.run.runID(),
+		Time:      time.Now().UTC(),
+		Group:     item.Resource.Group,
+		Version:   item.Resource.Version,
+		Resource:  item.Resource.Resource,
+		Kind:      item.Obj.GetKind(),
+		Namespace: item.Namespace,
+		Name:      item.Name,
+		UID:       string(item.Obj.GetUID()),
+		Reason:    reason,
+	}
+	if schedule.rule != nil {
+		entry.RuleID = schedule.rule.ID
+	}
+	if err := j.Archive.Store(ctx, entry, item.Obj); err != nil {
+		return err
+	}
+
+	// Items processed outside a cleanup run get a run of their own, which
+	// nothing else completes
+	if item.run == nil {
+		if err := j.Archive.Flush(entry.RunID); err != nil {
+			logrus.WithError(err).WithField("run", entry.RunID).Error("Failed to flush archive")
+			metrics.Errors.WithLabelValues("archive").Inc()
+		}
+	}
+	return nil
+}
+
+// inDeletionWindow reports whether both the global deletion window and the
+// matched rule's schedule, if any, allow deleting now
+func (j *Janitor) inDeletionWindow(schedule *deletionSchedule, now time.Time) bool {
+	if j.DeletionWindow != nil && !j.DeletionWindow.Contains(now) {
+		return false
+	}
+	return schedule.window == nil || schedule.window.Contains(now)
+}
+
+// deletionSchedule describes when an object becomes eligible for deletion and why
+type deletionSchedule struct {
+	deleteAt       time.Time
+	since          time.Time
+	ttl            duration.Duration
+	expires        string
+	rule           *rules.Rule
+	timeSource     rules.TimeSource
+	window         *window.Window
+	extendedFrom   time.Time
+	protectedUntil time.Time
+	// invalid is set when the invalid annotation policy expired the object
+	invalid *invalidAnnotationError
+	// action is taken once the object expires, deletion if nil
+	action     actions.Action
+	actionName string
+}
+
+func (s *deletionSchedule) expired(now time.Time) bool {
+	return now.After(s.deleteAt)
+}
+
+func (s *deletionSchedule) reason(now time.Time) string {
+	age := now.Sub(s.since)
+	switch {
+	case s.invalid != nil:
+		return fmt.Sprintf("Expired by the invalid annotation policy (%s)", s.invalid)
+	case s.rule != nil && s.expires != "":
+		return fmt.Sprintf("Rule '%s' matched (expiration time reached: %s)", s.rule.ID, s.expires)
+	case s.rule != nil:
+		return fmt.Sprintf("Rule '%s' matched (age: %s, ttl: %s%s)", s.rule.ID, age, s.ttl, s.measuredFrom())
+	case s.expires != "":
+		return fmt.Sprintf("Expiration time reached (%s)", s.expires)
+	default:
+		return fmt.Sprintf("TTL expired (age: %s, ttl: %s%s)", age, s.ttl, s.measuredFrom())
+	}
+}
+
+// pendingDecision tells what keeps an object that has not reached its deletion time
+func (s *deletionSchedule) pendingDecision(now time.Time) audit.Decision {
+	switch {
+	case !s.protectedUntil.IsZero():
+		return audit.Protected
+	case !s.extendedFrom.IsZero() && !now.Before(s.extendedFrom):
+		return audit.Snoozed
+	default:
+		return audit.NotExpired
+	}
+}
+
+func (s *deletionSchedule) measuredFrom() string {
+	if s.timeSource.IsCreation() {
+		return ""
+	}
+	return ", measured from " + s.timeSource.String()
+}
+
+// describe explains where the deletion time comes from, for use before it is reached
+func (s *deletionSchedule) describe() string {
+	var description string
+	switch {
+	case s.invalid != nil:
+		description = fmt.Sprintf("invalid annotation policy (%s)", s.invalid)
+	case s.rule != nil && s.expires != "":
+		description = fmt.Sprintf("rule '%s' (expiration time %s)", s.rule.ID, s.expires)
+	case s.rule != nil:
+		description = fmt.Sprintf("rule '%s' (ttl: %s%s)", s.rule.ID, s.ttl, s.measuredFrom())
+	case s.expires != "":
+		description = fmt.Sprintf("expiration time %s", s.expires)
+	default:
+		description = fmt.Sprintf("ttl %s%s", s.ttl, s.measuredFrom())
+	}
+
+	if !s.extendedFrom.IsZero() {
+		description += fmt.Sprintf(", extended from %s", s.extendedFrom.UTC().Format(time.RFC3339))
+	}
+	if !s.protectedUntil.IsZero() {
+		description += fmt.Sprintf(", protected until %s", s.protectedUntil.UTC().Format(time.RFC3339))
+	}
+	return description
+}
+
+// deletionSchedule resolves the annotations and rules that apply to an object.
+// It returns nil when the object is not subject to deletion at all. Invalid
+// TTL or expiration annotations are returned as an error alongside the
+// schedule chosen by the invalid annotation policy, which is nil when the
+// object is protected. An invalid action annotation keeps the object unless
+// the policy ignores it. Rules that fail to evaluate under the fail policy
+// return an error and no schedule.
+func (j *Janitor) deletionSchedule(ctx context.Context, obj *unstructured.Unstructured) (*deletionSchedule, error) {
+	schedule, maxExtension, err := j.baseSchedule(ctx, obj)
+	if schedule == nil {
+		return nil, err
+	}
+	if actionErr := applyAction(obj, schedule); actionErr != nil {
+		err = errors.Join(err, actionErr)
+		if j.invalidAnnotationPolicy() != InvalidAnnotationIgnore {
+			return nil, err
+		}
+	}
+
+	j.applySnooze(obj, schedule, maxExtension)
+	applyProtection(obj, schedule)
+	return schedule, err
+}
+
+// isRuleError reports whether a rule failed to evaluate, rather than an
+// annotation being invalid
+func isRuleError(err error) bool {
+	var evalErr *rules.EvaluationError
+	return errors.As(err, &evalErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// applyProtection holds back the deletion until the janitor/protected-until
+// time. Unlike snoozes, protection is not limited by the maximum extension.
+func applyProtection(obj *unstructured.Unstructured, schedule *deletionSchedule) {
+	protectedUntil, ok := obj.GetAnnotations()[annotationProtectedUntil]
+	if !ok {
+		return
+	}
 
-	// Create event for successful deletion
-	eventMessage := fmt.Sprintf("Deleted %s %s/%s - %s",
-		item.Resource.Resource, item.Namespace, item.Name, reason)
-	j.EventRecorder.Event(ref, corev1.EventTypeNormal, "ResourceDeleted", eventMessage)
+	until, err := time.Parse(time.RFC3339, protectedUntil)
+	if err != nil {
+		logrus.WithError(err).WithField("protectedUntil", protectedUntil).Warn("Invalid protected-until format")
+		return
+	}
+	if until.After(schedule.deleteAt) {
+		schedule.protectedUntil = until
+		schedule.deleteAt = until
+	}
 }
 
-func (j *Janitor) shouldDelete(obj *unstructured.Unstructured) (bool, string) {
+// baseSchedule returns the deletion schedule before any snooze is applied,
+// along with the rule's maximum extension if a rule matched
+func (j *Janitor) baseSchedule(ctx context.Context, obj *unstructured.Unstructured) (*deletionSchedule, duration.Duration, error) {
+	created := obj.GetCreationTimestamp().Time
+	// invalid collects the annotations skipped by the ignore policy
+	var invalid []error
+
 	// Check TTL annotation
 	if ttl, ok := obj.GetAnnotations()[annotationTTL]; ok {
-		duration, err := ParseExtendedDuration(ttl)
-		if err != nil {
-			logrus.WithError(err).WithField("ttl", ttl).Warn("Invalid TTL format")
-			return false, ""
+		ttlDuration, err := duration.Parse(ttl)
+		if err == nil {
+			timeSource := j.annotationTimeSource(obj, rules.TimeSource{})
+			since := timeSource.Resolve(obj)
+			return &deletionSchedule{
+				deleteAt:   ttlDuration.AddTo(since),
+				since:      since,
+				ttl:        ttlDuration,
+				timeSource: timeSource,
+			}, duration.Duration{}, nil
 		}
 
-		age := time.Since(obj.GetCreationTimestamp().Time)
-		if age > duration {
-			return true, fmt.Sprintf("TTL expired (age: %s, ttl: %s)", age, duration)
+		annotationErr := &invalidAnnotationError{annotation: annotationTTL, value: ttl, err: err}
+		if j.invalidAnnotationPolicy() != InvalidAnnotationIgnore {
+			return j.invalidAnnotationSchedule(obj, annotationErr), duration.Duration{}, annotationErr
 		}
-		return false, ""
+		invalid = append(invalid, annotationErr)
 	}
 
 	// Check expiration annotation
 	if expires, ok := obj.GetAnnotations()[annotationExpires]; ok {
-		expirationTime, err := parseExpirationTime(expires)
-		if err != nil {
-			logrus.WithError(err).WithField("expires", expires).Warn("Invalid expiration format")
-			return false, ""
+		expirationTime, err := j.parseExpirationTime(obj, annotationExpires)
+		if err == nil {
+			return &deletionSchedule{
+				deleteAt: expirationTime,
+				since:    created,
+				expires:  expires,
+			}, duration.Duration{}, errors.Join(invalid...)
 		}
 
-		if time.Now().After(expirationTime) {
-			return true, fmt.Sprintf("Expiration time reached (%s)", expires)
+		annotationErr := &invalidAnnotationError{annotation: annotationExpires, value: expires, err: err}
+		if j.invalidAnnotationPolicy() != InvalidAnnotationIgnore {
+			return j.invalidAnnotationSchedule(obj, annotationErr), duration.Duration{}, annotationErr
 		}
-		return false, ""
+		invalid = append(invalid, annotationErr)
 	}
 
 	// Check rules
-	if j.RuleEngine != nil {
-		if rule, ttl := j.RuleEngine.Evaluate(obj); rule != nil {
-			age := time.Since(obj.GetCreationTimestamp().Time)
-			if age > ttl {
-				return true, fmt.Sprintf("Rule '%s' matched (age: %s, ttl: %s)", rule.ID, age, ttl)
+	if ruleEngine := j.ruleEngine(); ruleEngine != nil {
+		match, err := ruleEngine.Match(ctx, obj)
+		if err != nil {
+			return nil, duration.Duration{}, errors.Join(append(invalid, err)...)
+		}
+		if match != nil {
+			// A ttlExpression may return an expiration time instead of a TTL
+			if !match.Expires.IsZero() {
+				return &deletionSchedule{
+					deleteAt: match.Expires,
+					since:    created,
+					expires:  match.Expires.UTC().Format(time.RFC3339),
+					rule:     match.Rule,
+					window:   match.Window,
+
+					action:     match.Action,
+					actionName: match.Rule.Action,
+				}, match.MaxExtension, errors.Join(invalid...)
 			}
+
+			timeSource := j.annotationTimeSource(obj, match.TimeSource)
+			since := timeSource.Resolve(obj)
+			return &deletionSchedule{
+				deleteAt:   match.TTL.AddTo(since),
+				since:      since,
+				ttl:        match.TTL,
+				rule:       match.Rule,
+				timeSource: timeSource,
+				window:     match.Window,
+				action:     match.Action,
+				actionName: match.Rule.Action,
+			}, match.MaxExtension, errors.Join(invalid...)
 		}
 	}
 
-	return false, ""
+	return nil, duration.Duration{}, errors.Join(invalid...)
+}
+
+// annotationTimeSource returns the time source from the janitor/ttl-from
+// annotation, or the fallback if the annotation is missing or invalid
+func (j *Janitor) annotationTimeSource(obj *unstructured.Unstructured, fallback rules.TimeSource) rules.TimeSource {
+	value, ok := obj.GetAnnotations()[annotationTTLFrom]
+	if !ok {
+		return fallback
+	}
+
+	timeSource, err := rules.ParseTimeSource(value)
+	if err != nil {
+		logrus.WithError(err).WithField("ttlFrom", value).Warn("Invalid TTL time source")
+		return fallback
+	}
+	return timeSource.In(j.Timezone)
 }
 
 func (j *Janitor) getNamespaces(ctx context.Context) ([]string, error) {
@@ -389,6 +887,10 @@ func (j *Janitor) getNamespaces(ctx context.Context) ([]string, error) {
 		return nil, err
 	}
 
+	if j.namespaces != nil {
+		j.namespaces.update(namespaceList.Items)
+	}
+
 	namespaces := make([]string, 0, len(namespaceList.Items))
 	for _, ns := range namespaceList.Items {
 		namespaces = append(namespaces, ns.Name)
@@ -397,95 +899,34 @@ func (j *Janitor) getNamespaces(ctx context.Context) ([]string, error) {
 	return namespaces, nil
 }
 
-func parseExpirationTime(expires string) (time.Time, error) {
-	// Try different formats
-	formats := []string{
-		time.RFC3339,
-		"2006-01-02T15:04:05",
-		"2006-01-02T15:04",
-		"2006-01-02",
-	}
-
-	for _, format := range formats {
-		t, err := time.Parse(format, expires)
-		if err == nil {
-			// For date-only format, set time to midnight UTC
-			if format == "2006-01-02" {
-				t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
-			}
-			return t, nil
-		}
-	}
-
-	return time.Time{}, fmt.Errorf("unable to parse expiration time: %s", expires)
+// parseExpirationTime parses the janitor/expires or janitor/extend-until
+// annotation of an object. Times without a zone are in the default timezone,
+// and weekdays are relative to when the janitor first saw the value.
+func (j *Janitor) parseExpirationTime(obj *unstructured.Unstructured, annotation string) (time.Time, error) {
+	return j.expirationParser().Parse(obj.GetAnnotations()[annotation], weekdaySeenAt(obj, annotation))
 }
 
-// ParseExtendedDuration parses duration strings with extended units:
-// - Standard Go units: h, m, s, ms, us, ns
-// - Extended units: d (days), w (weeks), month/months
-// Examples: "7d", "2w", "1month", "2w3d", "1month2w3d12h30m"
-func ParseExtendedDuration(s string) (time.Duration, error) {
-	// First try standard Go duration parsing
-	if d, err := time.ParseDuration(s); err == nil {
-		return d, nil
-	}
-
-	// Extended parsing with regex
-	re := regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(months?|w|d|h|m|s|ms|us|µs|ns)`)
-	matches := re.FindAllStringSubmatch(s, -1)
-
-	if len(matches) == 0 {
-		return 0, fmt.Errorf("invalid duration format: %s", s)
-	}
-
-	var totalDuration time.Duration
-
-	for _, match := range matches {
-		value, err := strconv.ParseFloat(match[1], 64)
-		if err != nil {
-			return 0, fmt.Errorf("invalid number in duration: %s", match[1])
-		}
-
-		unit := match[2]
-		var unitDuration time.Duration
-
-		switch unit {
-		case "month", "months":
-			// Approximate month as 30 days
-			unitDuration = time.Duration(value * 30 * 24 * float64(time.Hour))
-		case "w":
-			unitDuration = time.Duration(value * 7 * 24 * float64(time.Hour))
-		case "d":
-			unitDuration = time.Duration(value * 24 * float64(time.Hour))
-		case "h":
-			unitDuration = time.Duration(value * float64(time.Hour))
-		case "m":
-			unitDuration = time.Duration(value * float64(time.Minute))
-		case "s":
-			unitDuration = time.Duration(value * float64(time.Second))
-		case "ms":
-			unitDuration = time.Duration(value * float64(time.Millisecond))
-		case "us", "µs":
-			unitDuration = time.Duration(value * float64(time.Microsecond))
-		case "ns":
-			unitDuration = time.Duration(value * float64(time.Nanosecond))
-		default:
-			return 0, fmt.Errorf("unknown time unit: %s", unit)
-		}
+func (j *Janitor) expirationParser() expires.Parser {
+	return expires.Parser{Location: j.Timezone}
+}
 
-		totalDuration += unitDuration
+// resourceClient returns the dynamic client for a resource, scoped to the namespace if one is given
+func (j *Janitor) resourceClient(gvr schema.GroupVersionResource, namespace string) dynamic.ResourceInterface {
+	if namespace != "" {
+		return j.DynamicClient.Resource(gvr).Namespace(namespace)
 	}
+	return j.DynamicClient.Resource(gvr)
+}
 
-	// Verify we consumed the entire string (ignoring whitespace)
-	consumed := ""
-	for _, match := range matches {
-		consumed += match[0]
-	}
-	if strings.ReplaceAll(s, " ", "") != strings.ReplaceAll(consumed, " ", "") {
-		return 0, fmt.Errorf("invalid duration format: %s", s)
+// objectReference builds the reference used to attach events to a work item
+func objectReference(item WorkItem) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion: item.Resource.GroupVersion().String(),
+		Kind:       item.Obj.GetKind(),
+		Namespace:  item.Namespace,
+		Name:       item.Name,
+		UID:        item.Obj.GetUID(),
 	}
-
-	return totalDuration, nil
 }
 
 func contains(slice []string, item string) bool {
@@ -2,9 +2,12 @@ package janitor
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/blaxel-ai/kube-janitor-go/internal/rules"
+	"github.com/blaxel-ai/kube-janitor-go/internal/window"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
@@ -54,7 +57,9 @@ func TestParseExpirationTime(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := parseExpirationTime(tt.expires)
+			obj := &unstructured.Unstructured{}
+			obj.SetAnnotations(map[string]string{annotationExpires: tt.expires})
+			got, err := (&Janitor{}).parseExpirationTime(obj, annotationExpires)
 			if tt.wantError {
 				assert.Error(t, err)
 				return
@@ -65,7 +70,18 @@ func TestParseExpirationTime(t *testing.T) {
 	}
 }
 
-func TestShouldDelete(t *testing.T) {
+// expiredNow reports whether the object's schedule expired, and why
+func expiredNow(t *testing.T, j *Janitor, obj *unstructured.Unstructured) (bool, string) {
+	t.Helper()
+	schedule, _ := j.deletionSchedule(context.Background(), obj)
+	now := time.Now()
+	if schedule == nil || !schedule.expired(now) {
+		return false, ""
+	}
+	return true, schedule.reason(now)
+}
+
+func TestDeletionScheduleExpired(t *testing.T) {
 	now := time.Now()
 
 	tests := []struct {
@@ -149,6 +165,39 @@ func TestShouldDelete(t *testing.T) {
 			},
 			wantDelete: false,
 		},
+		{
+			name: "Protected after restore",
+			obj: &unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"metadata": map[string]interface{}{
+						"name":              "test-pod",
+						"creationTimestamp": now.Add(-2 * time.Hour).Format(time.RFC3339),
+						"annotations": map[string]interface{}{
+							annotationTTL:            "1h",
+							annotationProtectedUntil: now.Add(1 * time.Hour).Format(time.RFC3339),
+						},
+					},
+				},
+			},
+			wantDelete: false,
+		},
+		{
+			name: "Protection elapsed",
+			obj: &unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"metadata": map[string]interface{}{
+						"name":              "test-pod",
+						"creationTimestamp": now.Add(-2 * time.Hour).Format(time.RFC3339),
+						"annotations": map[string]interface{}{
+							annotationTTL:            "1h",
+							annotationProtectedUntil: now.Add(-1 * time.Minute).Format(time.RFC3339),
+						},
+					},
+				},
+			},
+			wantDelete: true,
+			wantReason: "TTL expired",
+		},
 		{
 			name: "No annotations",
 			obj: &unstructured.Unstructured{
@@ -164,8 +213,7 @@ func TestShouldDelete(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			j := &Janitor{}
-			gotDelete, gotReason := j.shouldDelete(tt.obj)
+			gotDelete, gotReason := expiredNow(t, &Janitor{}, tt.obj)
 			assert.Equal(t, tt.wantDelete, gotDelete)
 			if tt.wantDelete && tt.wantReason != "" {
 				assert.Contains(t, gotReason, tt.wantReason)
@@ -174,6 +222,76 @@ func TestShouldDelete(t *testing.T) {
 	}
 }
 
+func TestDeletionScheduleTTLFrom(t *testing.T) {
+	now := time.Now()
+
+	newObj := func(annotations map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name":              "preview",
+					"creationTimestamp": now.Add(-48 * time.Hour).Format(time.RFC3339),
+					"annotations":       annotations,
+					"managedFields": []interface{}{
+						map[string]interface{}{
+							"manager":   "kubectl",
+							"operation": "Update",
+							"time":      now.Add(-30 * time.Minute).Format(time.RFC3339),
+						},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]interface{}
+		wantDelete  bool
+		wantReason  string
+	}{
+		{
+			name:        "measured from creation",
+			annotations: map[string]interface{}{annotationTTL: "1d"},
+			wantDelete:  true,
+			wantReason:  "TTL expired",
+		},
+		{
+			name:        "recently updated",
+			annotations: map[string]interface{}{annotationTTL: "1d", annotationTTLFrom: "lastUpdate"},
+			wantDelete:  false,
+		},
+		{
+			name:        "idle for longer than TTL",
+			annotations: map[string]interface{}{annotationTTL: "10m", annotationTTLFrom: "managedFields"},
+			wantDelete:  true,
+			wantReason:  "measured from managedFields",
+		},
+		{
+			name: "user annotation",
+			annotations: map[string]interface{}{
+				annotationTTL:           "1d",
+				annotationTTLFrom:       "annotation:example.com/last-used",
+				"example.com/last-used": now.Add(-2 * time.Hour).UTC().Format(time.RFC3339),
+			},
+			wantDelete: false,
+		},
+		{
+			name:        "invalid time source falls back to creation",
+			annotations: map[string]interface{}{annotationTTL: "1d", annotationTTLFrom: "whenever"},
+			wantDelete:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotDelete, gotReason := expiredNow(t, &Janitor{}, newObj(tt.annotations))
+			assert.Equal(t, tt.wantDelete, gotDelete)
+			assert.Contains(t, gotReason, tt.wantReason)
+		})
+	}
+}
+
 func TestProcessItem(t *testing.T) {
 	ctx := context.Background()
 
@@ -186,7 +304,7 @@ func TestProcessItem(t *testing.T) {
 				"name":      "test-pod",
 				"namespace": "default",
 				"annotations": map[string]interface{}{
-					annotationTTL: "0s", // Expired immediately
+					annotationTTL: "1s", // Already expired
 				},
 				"creationTimestamp": time.Now().Add(-1 * time.Hour).Format(time.RFC3339),
 			},
@@ -246,7 +364,7 @@ func TestProcessItemDryRun(t *testing.T) {
 				"name":      "test-pod",
 				"namespace": "default",
 				"annotations": map[string]interface{}{
-					annotationTTL: "0s", // Expired immediately
+					annotationTTL: "1s", // Already expired
 				},
 				"creationTimestamp": time.Now().Add(-1 * time.Hour).Format(time.RFC3339),
 			},
@@ -294,6 +412,83 @@ func TestProcessItemDryRun(t *testing.T) {
 	assert.False(t, deleteCalled, "Delete should not have been called in dry-run mode")
 }
 
+func TestProcessItemDeletionWindow(t *testing.T) {
+	now := time.Now()
+	hour := now.UTC().Hour()
+	openNow := fmt.Sprintf("* %d * * *", hour)
+	closedNow := fmt.Sprintf("* %d * * *", (hour+12)%24)
+
+	tests := []struct {
+		name         string
+		window       string
+		ruleSchedule string
+		wantDelete   bool
+	}{
+		{name: "no window", wantDelete: true},
+		{name: "inside window", window: openNow, wantDelete: true},
+		{name: "outside window", window: closedNow, wantDelete: false},
+		{name: "outside rule schedule", ruleSchedule: closedNow, wantDelete: false},
+		{name: "rule schedule cannot widen window", window: closedNow, ruleSchedule: openNow, wantDelete: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": "v1",
+					"kind":       "Pod",
+					"metadata": map[string]interface{}{
+						"name":              "test-pod",
+						"namespace":         "default",
+						"creationTimestamp": now.Add(-2 * time.Hour).Format(time.RFC3339),
+					},
+				},
+			}
+
+			dynamicClient := fake.NewSimpleDynamicClient(runtime.NewScheme(), pod)
+			var deleteCalled bool
+			dynamicClient.PrependReactor("delete", "pods", func(_ ktesting.Action) (bool, runtime.Object, error) {
+				deleteCalled = true
+				return true, nil, nil
+			})
+
+			engine, err := rules.New([]rules.Rule{
+				{ID: "all-pods", Resources: []string{"pods"}, Expression: "true", TTL: "1h", Schedule: tt.ruleSchedule},
+			})
+			require.NoError(t, err)
+
+			j := &Janitor{
+				DynamicClient: dynamicClient,
+				RuleEngine:    engine,
+				EventRecorder: record.NewFakeRecorder(10),
+			}
+			if tt.window != "" {
+				j.DeletionWindow, err = window.Parse(tt.window)
+				require.NoError(t, err)
+			}
+
+			run := newCleanupRun()
+			j.processItem(context.Background(), WorkItem{
+				Resource:  schema.GroupVersionResource{Version: "v1", Resource: "pods"},
+				Namespace: "default",
+				Name:      "test-pod",
+				Obj:       pod,
+				run:       run,
+			})
+
+			assert.Equal(t, tt.wantDelete, deleteCalled)
+			report := run.report()
+			if tt.wantDelete {
+				assert.Equal(t, int64(1), report["deleted"])
+				assert.Equal(t, int64(0), report["deferred"])
+			} else {
+				assert.Equal(t, int64(0), report["deleted"])
+				assert.Equal(t, int64(1), report["deferred"])
+			}
+		})
+	}
+}
+
 func TestGetNamespaces(t *testing.T) {
 	ctx := context.Background()
 
@@ -361,240 +556,84 @@ func TestContains(t *testing.T) {
 	}
 }
 
-func TestParseExtendedDuration(t *testing.T) {
+func TestParseExpirationTimeDefaultTimezone(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+
+	j := &Janitor{Timezone: paris}
+
 	tests := []struct {
-		name     string
-		input    string
-		expected time.Duration
-		wantErr  bool
+		expires string
+		want    time.Time
 	}{
-		// Standard Go durations (backward compatibility)
-		{
-			name:     "standard hours",
-			input:    "24h",
-			expected: 24 * time.Hour,
-			wantErr:  false,
-		},
-		{
-			name:     "standard minutes",
-			input:    "30m",
-			expected: 30 * time.Minute,
-			wantErr:  false,
-		},
-		{
-			name:     "standard combined",
-			input:    "1h30m",
-			expected: 90 * time.Minute,
-			wantErr:  false,
-		},
-		// Extended durations - days
-		{
-			name:     "single day",
-			input:    "1d",
-			expected: 24 * time.Hour,
-			wantErr:  false,
-		},
-		{
-			name:     "multiple days",
-			input:    "7d",
-			expected: 7 * 24 * time.Hour,
-			wantErr:  false,
-		},
-		{
-			name:     "fractional days",
-			input:    "1.5d",
-			expected: 36 * time.Hour,
-			wantErr:  false,
-		},
-		// Extended durations - weeks
-		{
-			name:     "single week",
-			input:    "1w",
-			expected: 7 * 24 * time.Hour,
-			wantErr:  false,
-		},
-		{
-			name:     "multiple weeks",
-			input:    "2w",
-			expected: 14 * 24 * time.Hour,
-			wantErr:  false,
-		},
-		{
-			name:     "fractional weeks",
-			input:    "0.5w",
-			expected: 84 * time.Hour,
-			wantErr:  false,
-		},
-		// Extended durations - months
-		{
-			name:     "single month",
-			input:    "1month",
-			expected: 30 * 24 * time.Hour,
-			wantErr:  false,
-		},
-		{
-			name:     "single month plural",
-			input:    "1months",
-			expected: 30 * 24 * time.Hour,
-			wantErr:  false,
-		},
-		{
-			name:     "multiple months",
-			input:    "3months",
-			expected: 90 * 24 * time.Hour,
-			wantErr:  false,
-		},
-		// Combined durations
-		{
-			name:     "weeks and days",
-			input:    "2w3d",
-			expected: 17 * 24 * time.Hour,
-			wantErr:  false,
-		},
-		{
-			name:     "month week and days",
-			input:    "1month1w2d",
-			expected: 39 * 24 * time.Hour,
-			wantErr:  false,
-		},
-		{
-			name:     "complex combination",
-			input:    "1month2w3d12h30m",
-			expected: 47*24*time.Hour + 12*time.Hour + 30*time.Minute,
-			wantErr:  false,
-		},
-		{
-			name:     "with spaces",
-			input:    "2w 3d 12h",
-			expected: 17*24*time.Hour + 12*time.Hour,
-			wantErr:  false,
-		},
-		// Error cases
-		{
-			name:     "invalid format",
-			input:    "invalid",
-			expected: 0,
-			wantErr:  true,
-		},
-		{
-			name:     "invalid unit",
-			input:    "5x",
-			expected: 0,
-			wantErr:  true,
-		},
-		{
-			name:     "invalid number",
-			input:    "abcd",
-			expected: 0,
-			wantErr:  true,
-		},
-		{
-			name:     "mixed invalid",
-			input:    "2w3x",
-			expected: 0,
-			wantErr:  true,
-		},
-		// Edge cases
-		{
-			name:     "zero duration",
-			input:    "0d",
-			expected: 0,
-			wantErr:  false,
-		},
-		{
-			name:     "very small duration",
-			input:    "1ms",
-			expected: time.Millisecond,
-			wantErr:  false,
-		},
-		{
-			name:     "microseconds with µ",
-			input:    "100µs",
-			expected: 100 * time.Microsecond,
-			wantErr:  false,
-		},
-		{
-			name:     "microseconds with us",
-			input:    "100us",
-			expected: 100 * time.Microsecond,
-			wantErr:  false,
-		},
+		{expires: "2024-12-31", want: time.Date(2024, 12, 31, 0, 0, 0, 0, paris)},
+		{expires: "2024-12-31T23:59:59Z", want: time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC)},
+		{expires: "2026-11-01 18:00 America/New_York", want: time.Date(2026, 11, 1, 23, 0, 0, 0, time.UTC)},
+		{expires: "next friday 18:00", want: time.Date(2026, 10, 30, 18, 0, 0, 0, paris)},
+		{expires: "1793552400", want: time.Unix(1793552400, 0)},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := ParseExtendedDuration(tt.input)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("ParseExtendedDuration() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if got != tt.expected {
-				t.Errorf("ParseExtendedDuration() = %v, want %v", got, tt.expected)
-			}
+		t.Run(tt.expires, func(t *testing.T) {
+			// First seen on a Wednesday
+			obj := &unstructured.Unstructured{}
+			obj.SetAnnotations(map[string]string{
+				annotationExpires:                      tt.expires,
+				weekdayStamps[annotationExpires].at:    "2026-10-28T15:00:00Z",
+				weekdayStamps[annotationExpires].value: tt.expires,
+			})
+			got, err := j.parseExpirationTime(obj, annotationExpires)
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(got), "want %s, got %s", tt.want, got)
 		})
 	}
 }
 
-// TestParseExtendedDurationRealWorld tests real-world scenarios
-func TestParseExtendedDurationRealWorld(t *testing.T) {
-	tests := []struct {
-		name        string
-		annotation  string
-		ageInHours  float64
-		shouldMatch bool
-	}{
-		{
-			name:        "7 day TTL, 5 day old resource",
-			annotation:  "7d",
-			ageInHours:  120, // 5 days
-			shouldMatch: false,
-		},
-		{
-			name:        "7 day TTL, 8 day old resource",
-			annotation:  "7d",
-			ageInHours:  192, // 8 days
-			shouldMatch: true,
-		},
-		{
-			name:        "2 week TTL, 10 day old resource",
-			annotation:  "2w",
-			ageInHours:  240, // 10 days
-			shouldMatch: false,
-		},
-		{
-			name:        "1 month TTL, 35 day old resource",
-			annotation:  "1month",
-			ageInHours:  840, // 35 days
-			shouldMatch: true,
-		},
-		{
-			name:        "complex TTL, just under limit",
-			annotation:  "1w3d12h",
-			ageInHours:  251, // Just under 10.5 days
-			shouldMatch: false,
-		},
+func TestCalendarTTL(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+	obj.SetCreationTimestamp(metav1.NewTime(time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)))
+	obj.SetAnnotations(map[string]string{annotationTTL: "1mo2d"})
+
+	schedule, err := (&Janitor{}).deletionSchedule(context.Background(), obj)
+	require.NoError(t, err)
+	require.NotNil(t, schedule)
+	assert.True(t, time.Date(2024, 2, 17, 12, 0, 0, 0, time.UTC).Equal(schedule.deleteAt), "got %s", schedule.deleteAt)
+	assert.Contains(t, schedule.describe(), "ttl 1mo2d")
+}
+
+func TestRuleTTLExpression(t *testing.T) {
+	engine, err := rules.New([]rules.Rule{
 		{
-			name:        "complex TTL, just over limit",
-			annotation:  "1w3d12h",
-			ageInHours:  253, // Just over 10.5 days
-			shouldMatch: true,
+			ID:            "dev-namespaces",
+			Resources:     []string{"pods"},
+			Expression:    `object.metadata.namespace.startsWith("dev-")`,
+			TTL:           "1w",
+			TTLExpression: `"expires" in object.metadata.labels ? timestamp(string(object.metadata.labels["expires"])) : dyn("1d")`,
 		},
+	})
+	require.NoError(t, err)
+	j := &Janitor{RuleEngine: engine}
+
+	created := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	newPod := func(labels map[string]string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetKind("Pod")
+		obj.SetNamespace("dev-feature")
+		obj.SetLabels(labels)
+		obj.SetCreationTimestamp(metav1.NewTime(created))
+		return obj
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			duration, err := ParseExtendedDuration(tt.annotation)
-			if err != nil {
-				t.Fatalf("Failed to parse duration: %v", err)
-			}
-
-			age := time.Duration(tt.ageInHours * float64(time.Hour))
-			shouldDelete := age > duration
+	schedule, err := j.deletionSchedule(context.Background(), newPod(map[string]string{}))
+	require.NoError(t, err)
+	require.NotNil(t, schedule)
+	assert.True(t, created.Add(24*time.Hour).Equal(schedule.deleteAt), "got %s", schedule.deleteAt)
+	assert.Equal(t, "rule 'dev-namespaces' (ttl: 1d)", schedule.describe())
 
-			if shouldDelete != tt.shouldMatch {
-				t.Errorf("Expected shouldDelete=%v for age=%v and TTL=%v, but got %v",
-					tt.shouldMatch, age, duration, shouldDelete)
-			}
-		})
-	}
+	schedule, err = j.deletionSchedule(context.Background(), newPod(map[string]string{"expires": "2024-02-01T00:00:00Z"}))
+	require.NoError(t, err)
+	require.NotNil(t, schedule)
+	assert.True(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC).Equal(schedule.deleteAt), "got %s", schedule.deleteAt)
+	assert.Equal(t, "rule 'dev-namespaces' (expiration time 2024-02-01T00:00:00Z)", schedule.describe())
+	assert.Equal(t, "Rule 'dev-namespaces' matched (expiration time reached: 2024-02-01T00:00:00Z)", schedule.reason(time.Now()))
 }
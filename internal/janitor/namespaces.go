@@ -0,0 +1,59 @@
+package janitor
+
+import (
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// namespaceCache keeps the labels of the namespaces seen by the last listing,
+// so that rule namespace selectors do not hit the API server for every object
+type namespaceCache struct {
+	clientset kubernetes.Interface
+	mu        sync.RWMutex
+	labels    map[string]labels.Set
+}
+
+func newNamespaceCache(clientset kubernetes.Interface) *namespaceCache {
+	return &namespaceCache{
+		clientset: clientset,
+		labels:    make(map[string]labels.Set),
+	}
+}
+
+// update replaces the cached labels with those of a fresh namespace list
+func (c *namespaceCache) update(namespaces []corev1.Namespace) {
+	updated := make(map[string]labels.Set, len(namespaces))
+	for _, ns := range namespaces {
+		updated[ns.Name] = ns.Labels
+	}
+
+	c.mu.Lock()
+	c.labels = updated
+	c.mu.Unlock()
+}
+
+// namespaceLabels returns the labels of a namespace, fetching namespaces that
+// were not part of the last listing
+func (c *namespaceCache) namespaceLabels(name string) (labels.Set, error) {
+	c.mu.RLock()
+	nsLabels, ok := c.labels[name]
+	c.mu.RUnlock()
+	if ok {
+		return nsLabels, nil
+	}
+
+	ns, err := c.clientset.CoreV1().Namespaces().Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.labels[name] = ns.Labels
+	c.mu.Unlock()
+	return ns.Labels, nil
+}
@@ -0,0 +1,53 @@
+package janitor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNamespaceCache(t *testing.T) {
+	clientset := k8sfake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev-api", Labels: map[string]string{"env": "dev"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod-api", Labels: map[string]string{"env": "prod"}}},
+	)
+	j := &Janitor{Clientset: clientset, namespaces: newNamespaceCache(clientset)}
+
+	namespaces, err := j.getNamespaces(context.Background())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"dev-api", "prod-api"}, namespaces)
+
+	// Listed namespaces are served from the cache, even once they change
+	_, err = clientset.CoreV1().Namespaces().Update(context.Background(),
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev-api", Labels: map[string]string{"env": "qa"}}},
+		metav1.UpdateOptions{})
+	require.NoError(t, err)
+	got, err := j.namespaces.namespaceLabels("dev-api")
+	require.NoError(t, err)
+	assert.Equal(t, labels.Set{"env": "dev"}, got)
+
+	// Namespaces created since the last listing are fetched
+	_, err = clientset.CoreV1().Namespaces().Create(context.Background(),
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "new", Labels: map[string]string{"env": "dev"}}},
+		metav1.CreateOptions{})
+	require.NoError(t, err)
+	got, err = j.namespaces.namespaceLabels("new")
+	require.NoError(t, err)
+	assert.Equal(t, labels.Set{"env": "dev"}, got)
+
+	_, err = j.namespaces.namespaceLabels("missing")
+	assert.Error(t, err)
+
+	// The next listing picks up label changes
+	_, err = j.getNamespaces(context.Background())
+	require.NoError(t, err)
+	got, err = j.namespaces.namespaceLabels("dev-api")
+	require.NoError(t, err)
+	assert.Equal(t, labels.Set{"env": "qa"}, got)
+}
@@ -0,0 +1,47 @@
+package janitor
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// ownerLookup fetches the owners of objects for the owner() rule helper
+type ownerLookup struct {
+	client dynamic.Interface
+	mapper meta.RESTMapper
+}
+
+// owner returns the object an owner reference points to, or nil if it no
+// longer exists or was replaced by another object of the same name
+func (l *ownerLookup) owner(namespace string, ref metav1.OwnerReference) (*unstructured.Unstructured, error) {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := l.mapper.RESTMapping(gv.WithKind(ref.Kind).GroupKind(), gv.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	var client dynamic.ResourceInterface = l.client.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		client = l.client.Resource(mapping.Resource).Namespace(namespace)
+	}
+	owner, err := client.Get(context.TODO(), ref.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ref.UID != "" && owner.GetUID() != ref.UID {
+		return nil, nil
+	}
+	return owner, nil
+}
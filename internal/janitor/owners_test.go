@@ -0,0 +1,51 @@
+package janitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func TestOwnerLookup(t *testing.T) {
+	deployment := &unstructured.Unstructured{}
+	deployment.SetAPIVersion("apps/v1")
+	deployment.SetKind("Deployment")
+	deployment.SetNamespace("default")
+	deployment.SetName("web")
+	deployment.SetUID("web-uid")
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	lookup := &ownerLookup{client: fake.NewSimpleDynamicClient(runtime.NewScheme(), deployment), mapper: mapper}
+
+	tests := []struct {
+		name      string
+		ref       metav1.OwnerReference
+		wantOwner bool
+		wantErr   bool
+	}{
+		{name: "existing owner", ref: metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "web", UID: "web-uid"}, wantOwner: true},
+		{name: "deleted owner", ref: metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "api", UID: "api-uid"}},
+		{name: "replaced owner", ref: metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "web", UID: "old-uid"}},
+		{name: "unknown kind", ref: metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "Widget", Name: "web"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner, err := lookup.owner("default", tt.ref)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantOwner, owner != nil)
+		})
+	}
+}
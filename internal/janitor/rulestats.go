@@ -0,0 +1,49 @@
+package janitor
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ruleReport is the JSON form of a rule and its stats served by RulesHandler
+type ruleReport struct {
+	ID        string   `json:"id"`
+	Namespace string   `json:"namespace,omitempty"`
+	Resources []string `json:"resources"`
+	TTL       string   `json:"ttl"`
+	// Evaluations, Matches and Errors count since the janitor started
+	Evaluations           int64   `json:"evaluations"`
+	Matches               int64   `json:"matches"`
+	Errors                int64   `json:"errors"`
+	AverageLatency        string  `json:"averageLatency"`
+	AverageLatencySeconds float64 `json:"averageLatencySeconds"`
+}
+
+// RulesHandler serves the rules in use, in evaluation order, with their stats
+func (j *Janitor) RulesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		reports := []ruleReport{}
+		if ruleEngine := j.ruleEngine(); ruleEngine != nil {
+			for _, r := range ruleEngine.Report() {
+				reports = append(reports, ruleReport{
+					ID:                    r.Rule.ID,
+					Namespace:             r.Rule.Namespace,
+					Resources:             r.Rule.Resources,
+					TTL:                   r.Rule.TTL,
+					Evaluations:           r.Stats.Evaluations,
+					Matches:               r.Stats.Matches,
+					Errors:                r.Stats.Errors,
+					AverageLatency:        r.Stats.AverageLatency.String(),
+					AverageLatencySeconds: r.Stats.AverageLatency.Seconds(),
+				})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{"rules": reports}); err != nil {
+			logrus.WithError(err).Error("Failed to write rules response")
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package janitor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRulesHandler(t *testing.T) {
+	get := func(j *Janitor) []ruleReport {
+		rec := httptest.NewRecorder()
+		j.RulesHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rules", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+		var body struct {
+			Rules []ruleReport `json:"rules"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		require.NotNil(t, body.Rules)
+		return body.Rules
+	}
+
+	assert.Empty(t, get(&Janitor{}))
+
+	engine, err := rules.New([]rules.Rule{
+		{
+			ID:         "pr-pods",
+			Resources:  []string{"pods"},
+			Expression: `object.metadata.name.startsWith("pr-")`,
+			TTL:        "1h",
+		},
+		{
+			ID:         "deployments",
+			Resources:  []string{"deployments"},
+			Expression: "true",
+			TTL:        "2d",
+		},
+	})
+	require.NoError(t, err)
+	j := &Janitor{RuleEngine: engine}
+
+	for _, name := range []string{"pr-1", "pr-2", "main"} {
+		obj := &unstructured.Unstructured{}
+		obj.SetKind("Pod")
+		obj.SetName(name)
+		engine.Match(context.Background(), obj)
+	}
+
+	reports := get(j)
+	require.Len(t, reports, 2)
+	assert.Equal(t, "pr-pods", reports[0].ID)
+	assert.Equal(t, []string{"pods"}, reports[0].Resources)
+	assert.Equal(t, "1h", reports[0].TTL)
+	assert.Equal(t, int64(3), reports[0].Evaluations)
+	assert.Equal(t, int64(2), reports[0].Matches)
+	assert.Equal(t, int64(0), reports[0].Errors)
+	assert.Positive(t, reports[0].AverageLatencySeconds)
+
+	assert.Equal(t, "deployments", reports[1].ID)
+	assert.Equal(t, int64(0), reports[1].Evaluations)
+	assert.Equal(t, "0s", reports[1].AverageLatency)
+}
@@ -0,0 +1,212 @@
+package janitor
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/archive"
+	"github.com/blaxel-ai/kube-janitor-go/internal/audit"
+	"github.com/blaxel-ai/kube-janitor-go/internal/crd"
+	"github.com/blaxel-ai/kube-janitor-go/internal/metrics"
+	"github.com/blaxel-ai/kube-janitor-go/internal/notify"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// cleanupRun tracks the work items queued by a single cleanup run and
+// collects their outcomes until every item has been processed
+type cleanupRun struct {
+	id        string
+	pending   sync.WaitGroup
+	mu        sync.Mutex
+	deletions []notify.Deletion
+	// ruleStats counts the objects each rule matched and deleted
+	ruleStats map[string]crd.RuleStats
+	deleted   atomic.Int64
+	deferred  atomic.Int64
+	// namespaces is set when the run looks for empty namespaces
+	namespaces *namespaceInventory
+}
+
+func newCleanupRun() *cleanupRun {
+	return &cleanupRun{id: archive.NewRunID(time.Now())}
+}
+
+// runID identifies the run in archives, falling back to the current time
+// for items processed outside a cleanup run
+func (r *cleanupRun) runID() string {
+	if r == nil {
+		return archive.NewRunID(time.Now())
+	}
+	return r.id
+}
+
+// wait blocks until all queued items are processed or the context is done
+func (r *cleanupRun) wait(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		r.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// countDeleted and countDeferred tolerate a nil run for items processed outside a cleanup run
+func (r *cleanupRun) countDeleted() {
+	if r != nil {
+		r.deleted.Add(1)
+	}
+}
+
+func (r *cleanupRun) countDeferred() {
+	if r != nil {
+		r.deferred.Add(1)
+	}
+}
+
+// report summarizes the run's outcomes for the completion log
+func (r *cleanupRun) report() logrus.Fields {
+	return logrus.Fields{
+		"deleted":  r.deleted.Load(),
+		"deferred": r.deferred.Load(),
+	}
+}
+
+// countRule adds an evaluated item to the stats of the rule that scheduled
+// it. Matches are only counted for objects the rule did not match before.
+func (r *cleanupRun) countRule(decision audit.Decision, schedule *deletionSchedule, newMatch bool) {
+	if r == nil || schedule == nil || schedule.rule == nil || (!newMatch && decision != audit.Deleted) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ruleStats == nil {
+		r.ruleStats = make(map[string]crd.RuleStats)
+	}
+	stats := r.ruleStats[schedule.rule.ID]
+	if newMatch {
+		stats.Matched++
+	}
+	if decision == audit.Deleted {
+		stats.Deleted++
+	}
+	r.ruleStats[schedule.rule.ID] = stats
+}
+
+// ruleMatches remembers the objects each rule matched, so that an object is
+// counted once while it keeps matching rather than on every run
+type ruleMatches struct {
+	mu      sync.Mutex
+	matched map[ruleMatch]bool
+}
+
+type ruleMatch struct {
+	ruleID string
+	uid    types.UID
+}
+
+// add records that the rule matched the object and reports whether it is a new match
+func (m *ruleMatches) add(ruleID string, uid types.UID) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.matched == nil {
+		m.matched = make(map[ruleMatch]bool)
+	}
+	key := ruleMatch{ruleID: ruleID, uid: uid}
+	_, ok := m.matched[key]
+	m.matched[key] = true
+	return !ok
+}
+
+// prune drops the matches not seen since the previous prune, so an object
+// that matches again later is counted again
+func (m *ruleMatches) prune() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, seen := range m.matched {
+		if !seen {
+			delete(m.matched, key)
+			continue
+		}
+		m.matched[key] = false
+	}
+}
+
+func (r *cleanupRun) addDeletion(d notify.Deletion) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deletions = append(r.deletions, d)
+}
+
+// recordDeletion counts a deleted item and adds it to the run's notification batch
+func (j *Janitor) recordDeletion(item WorkItem, reason string) {
+	item.run.countDeleted()
+	if item.run == nil || j.Notifier == nil {
+		return
+	}
+
+	var ownerLabels map[string]string
+	labels := item.Obj.GetLabels()
+	for _, key := range j.Config.NotifyOwnerLabels {
+		if value, ok := labels[key]; ok {
+			if ownerLabels == nil {
+				ownerLabels = make(map[string]string)
+			}
+			ownerLabels[key] = value
+		}
+	}
+
+	item.run.addDeletion(notify.Deletion{
+		Group:       item.Resource.Group,
+		Version:     item.Resource.Version,
+		Resource:    item.Resource.Resource,
+		Namespace:   item.Namespace,
+		Name:        item.Name,
+		Reason:      reason,
+		OwnerLabels: ownerLabels,
+		DryRun:      j.Config.DryRun,
+		Time:        time.Now().UTC(),
+	})
+}
+
+// finish waits for the run's items, forgets the objects the run no longer
+// saw, completes its archive and sends the collected notifications
+func (j *Janitor) finish(ctx context.Context, run *cleanupRun) {
+	if !run.wait(ctx) {
+		return
+	}
+	j.decisions.prune()
+	j.invalidReports.prune()
+	j.ruleMatches.prune()
+	j.dryRunMarks.prune()
+	j.dryRunStamps.prune()
+
+	if j.Archive != nil {
+		if err := j.Archive.Flush(run.id); err != nil {
+			logrus.WithError(err).WithField("run", run.id).Error("Failed to flush archive")
+			metrics.Errors.WithLabelValues("archive").Inc()
+		}
+	}
+
+	if j.RuleController != nil {
+		j.RuleController.Report(ctx, run.ruleStats)
+	}
+
+	if j.Notifier != nil && len(run.deletions) > 0 {
+		if err := j.Notifier.Notify(ctx, run.deletions); err != nil {
+			logrus.WithError(err).WithField("deletions", len(run.deletions)).Error("Failed to send deletion notifications")
+			metrics.Errors.WithLabelValues("notify").Inc()
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package janitor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/archive"
+	"github.com/blaxel-ai/kube-janitor-go/internal/audit"
+	"github.com/blaxel-ai/kube-janitor-go/internal/crd"
+	"github.com/blaxel-ai/kube-janitor-go/internal/notify"
+	"github.com/blaxel-ai/kube-janitor-go/internal/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+type fakeNotifier struct {
+	mu      sync.Mutex
+	batches [][]notify.Deletion
+}
+
+func (f *fakeNotifier) Notify(_ context.Context, deletions []notify.Deletion) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.batches = append(f.batches, deletions)
+	return nil
+}
+
+func newExpiredPod(name string, labels map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": "default",
+				"labels":    labels,
+				"annotations": map[string]interface{}{
+					annotationTTL: "1h",
+				},
+				"creationTimestamp": time.Now().Add(-2 * time.Hour).Format(time.RFC3339),
+			},
+		},
+	}
+}
+
+func TestCleanupRunNotifications(t *testing.T) {
+	tests := []struct {
+		name   string
+		dryRun bool
+	}{
+		{name: "deletions", dryRun: false},
+		{name: "dry run", dryRun: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			pods := []*unstructured.Unstructured{
+				newExpiredPod("pod-a", map[string]interface{}{"team": "platform", "app": "a"}),
+				newExpiredPod("pod-b", nil),
+			}
+			dynamicClient := fake.NewSimpleDynamicClient(runtime.NewScheme(), pods[0], pods[1])
+			dynamicClient.PrependReactor("delete", "pods", func(_ ktesting.Action) (bool, runtime.Object, error) {
+				return true, nil, nil
+			})
+
+			notifier := &fakeNotifier{}
+			j := &Janitor{
+				DynamicClient: dynamicClient,
+				Config: Config{
+					DryRun:            tt.dryRun,
+					NotifyOwnerLabels: []string{"team"},
+				},
+				WorkQueue:     make(chan WorkItem, 10),
+				EventRecorder: record.NewFakeRecorder(10),
+				Notifier:      notifier,
+			}
+			j.wg.Add(1)
+			go j.Worker(ctx)
+
+			run := newCleanupRun()
+			for _, pod := range pods {
+				run.pending.Add(1)
+				j.WorkQueue <- WorkItem{
+					Resource:  schema.GroupVersionResource{Version: "v1", Resource: "pods"},
+					Namespace: "default",
+					Name:      pod.GetName(),
+					Obj:       pod,
+					run:       run,
+				}
+			}
+			j.finish(ctx, run)
+
+			require.Len(t, notifier.batches, 1, "deletions should be sent as a single batch")
+			batch := notifier.batches[0]
+			require.Len(t, batch, 2)
+
+			byName := map[string]notify.Deletion{}
+			for _, d := range batch {
+				byName[d.Name] = d
+			}
+			assert.Equal(t, map[string]string{"team": "platform"}, byName["pod-a"].OwnerLabels)
+			assert.Nil(t, byName["pod-b"].OwnerLabels)
+			assert.Equal(t, tt.dryRun, byName["pod-a"].DryRun)
+			assert.Equal(t, "pods", byName["pod-a"].Resource)
+			assert.Contains(t, byName["pod-a"].Reason, "TTL expired")
+		})
+	}
+}
+
+func TestCleanupRunWaitCanceled(t *testing.T) {
+	run := newCleanupRun()
+	run.pending.Add(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, run.wait(ctx))
+}
+
+type fakeSink struct {
+	mu      sync.Mutex
+	err     error
+	entries []archive.Entry
+	flushed []string
+}
+
+func (f *fakeSink) Store(_ context.Context, entry archive.Entry, _ *unstructured.Unstructured) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.entries = append(f.entries, entry)
+	return nil
+}
+
+func (f *fakeSink) Flush(runID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flushed = append(f.flushed, runID)
+	return nil
+}
+
+func (f *fakeSink) Close() error {
+	return nil
+}
+
+func TestProcessItemArchive(t *testing.T) {
+	tests := []struct {
+		name       string
+		dryRun     bool
+		storeErr   error
+		wantStored bool
+		wantDelete bool
+	}{
+		{name: "archived before deletion", wantStored: true, wantDelete: true},
+		{name: "archive failure skips deletion", storeErr: errors.New("disk full"), wantDelete: false},
+		{name: "dry run is not archived", dryRun: true, wantDelete: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newExpiredPod("test-pod", nil)
+			pod.SetUID("1234")
+
+			dynamicClient := fake.NewSimpleDynamicClient(runtime.NewScheme(), pod)
+			var deleteCalled bool
+			dynamicClient.PrependReactor("delete", "pods", func(_ ktesting.Action) (bool, runtime.Object, error) {
+				deleteCalled = true
+				return true, nil, nil
+			})
+
+			sink := &fakeSink{err: tt.storeErr}
+			j := &Janitor{
+				DynamicClient: dynamicClient,
+				Config:        Config{DryRun: tt.dryRun},
+				EventRecorder: record.NewFakeRecorder(10),
+				Archive:       sink,
+			}
+
+			run := newCleanupRun()
+			run.pending.Add(1)
+			j.processItem(context.Background(), WorkItem{
+				Resource:  schema.GroupVersionResource{Version: "v1", Resource: "pods"},
+				Namespace: "default",
+				Name:      "test-pod",
+				Obj:       pod,
+				run:       run,
+			})
+			run.pending.Done()
+			j.finish(context.Background(), run)
+
+			assert.Equal(t, tt.wantDelete, deleteCalled)
+			assert.Equal(t, []string{run.id}, sink.flushed)
+			if !tt.wantStored {
+				assert.Empty(t, sink.entries)
+				return
+			}
+			require.Len(t, sink.entries, 1)
+			entry := sink.entries[0]
+			assert.Equal(t, run.id, entry.RunID)
+			assert.Equal(t, "Pod", entry.Kind)
+			assert.Equal(t, "pods", entry.Resource)
+			assert.Equal(t, "1234", entry.UID)
+			assert.Contains(t, entry.Reason, "TTL expired")
+		})
+	}
+}
+
+func TestCleanupRunRuleStats(t *testing.T) {
+	run := newCleanupRun()
+	rule := &rules.Rule{ID: "team-a/previews"}
+
+	run.countRule(audit.NotExpired, &deletionSchedule{rule: rule}, true)
+	run.countRule(audit.NotExpired, &deletionSchedule{rule: rule}, false)
+	run.countRule(audit.Deleted, &deletionSchedule{rule: rule}, true)
+	run.countRule(audit.Deleted, &deletionSchedule{rule: rule}, false)
+	run.countRule(audit.Deleted, &deletionSchedule{}, true)
+	run.countRule(audit.NoTTL, nil, false)
+
+	assert.Equal(t, map[string]crd.RuleStats{"team-a/previews": {Matched: 2, Deleted: 2}}, run.ruleStats)
+
+	// Items processed outside a run are not counted
+	var none *cleanupRun
+	none.countRule(audit.Deleted, &deletionSchedule{rule: rule}, true)
+}
+
+func TestRuleMatches(t *testing.T) {
+	var matches ruleMatches
+	assert.True(t, matches.add("previews", "1234"))
+	assert.False(t, matches.add("previews", "1234"), "counted once while it keeps matching")
+	assert.True(t, matches.add("other", "1234"))
+
+	matches.prune()
+	assert.False(t, matches.add("previews", "1234"))
+	matches.prune()
+	matches.prune()
+	assert.True(t, matches.add("previews", "1234"), "counted again once it stopped matching")
+}
@@ -0,0 +1,105 @@
+package janitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/fieldmanager"
+	"github.com/blaxel-ai/kube-janitor-go/internal/metrics"
+	"github.com/blaxel-ai/kube-janitor-go/pkg/actions"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// warnScheduledDeletion annotates a resource that will expire within the
+// notification window and emits a DeletionScheduled warning event naming the
+// action it is scheduled for. The annotation also records the deletion time
+// the owner has been warned about, so the warning is only repeated when that
+// time moves. It is removed once the resource leaves the window without
+// expiring, or is no longer scheduled at all (nil schedule).
+func (j *Janitor) warnScheduledDeletion(ctx context.Context, item WorkItem, schedule *deletionSchedule, logger *logrus.Entry) {
+	if j.Config.NotifyBefore <= 0 {
+		return
+	}
+
+	warned, ok := item.Obj.GetAnnotations()[annotationScheduledDeletion]
+	if schedule == nil || time.Until(schedule.deleteAt) > j.Config.NotifyBefore {
+		if ok {
+			j.clearScheduledDeletion(ctx, item, logger)
+		}
+		return
+	}
+
+	deleteAt := schedule.deleteAt.UTC().Format(time.RFC3339)
+	if ok && warned == deleteAt {
+		return
+	}
+	logger = logger.WithField("deleteAt", deleteAt)
+
+	if j.Config.DryRun {
+		logger.Info("DRY RUN: Would warn about scheduled deletion")
+		return
+	}
+
+	if err := j.patchAnnotations(ctx, item, map[string]interface{}{
+		annotationScheduledDeletion: deleteAt,
+	}); err != nil {
+		logger.WithError(err).Error("Failed to annotate resource with scheduled deletion")
+		metrics.Errors.WithLabelValues("patch_resource").Inc()
+		return
+	}
+
+	action := schedule.actionName
+	if action == "" {
+		action = actions.Delete
+	}
+	logger.WithField("action", action).Info("Resource scheduled for action")
+
+	eventMessage := fmt.Sprintf("%s %s/%s is scheduled for %s at %s - %s",
+		item.Resource.Resource, item.Namespace, item.Name, action, deleteAt, schedule.describe())
+	j.EventRecorder.Event(objectReference(item), corev1.EventTypeWarning, "DeletionScheduled", eventMessage)
+}
+
+// clearScheduledDeletion removes a stale scheduled deletion warning
+func (j *Janitor) clearScheduledDeletion(ctx context.Context, item WorkItem, logger *logrus.Entry) {
+	if j.Config.DryRun {
+		logger.Info("DRY RUN: Would clear scheduled deletion warning")
+		return
+	}
+	if err := j.patchAnnotations(ctx, item, map[string]interface{}{annotationScheduledDeletion: nil}); err != nil {
+		logger.WithError(err).Error("Failed to clear scheduled deletion warning")
+		metrics.Errors.WithLabelValues("patch_resource").Inc()
+		return
+	}
+	logger.Info("Resource no longer scheduled for deletion within the notification window")
+}
+
+// patchAnnotations sets annotations on a resource with a JSON merge patch.
+// A nil value removes the annotation.
+func (j *Janitor) patchAnnotations(ctx context.Context, item WorkItem, annotations map[string]interface{}) error {
+	return j.patchMetadata(ctx, item, "annotations", annotations)
+}
+
+// patchLabels sets labels on a resource like patchAnnotations
+func (j *Janitor) patchLabels(ctx context.Context, item WorkItem, labels map[string]interface{}) error {
+	return j.patchMetadata(ctx, item, "labels", labels)
+}
+
+func (j *Janitor) patchMetadata(ctx context.Context, item WorkItem, field string, values map[string]interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			field: values,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode patch: %w", err)
+	}
+
+	_, err = j.resourceClient(item.Resource, item.Namespace).Patch(ctx, item.Name, types.MergePatchType, patch,
+		metav1.PatchOptions{FieldManager: fieldmanager.Name})
+	return err
+}
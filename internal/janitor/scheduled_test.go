@@ -0,0 +1,188 @@
+package janitor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func newScheduledPod(annotations map[string]interface{}, age time.Duration) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"metadata": map[string]interface{}{
+				"name":              "test-pod",
+				"namespace":         "default",
+				"annotations":       annotations,
+				"creationTimestamp": time.Now().Add(-age).Format(time.RFC3339),
+			},
+		},
+	}
+}
+
+func TestWarnScheduledDeletion(t *testing.T) {
+	// current is the deletion time of a pod created at the given time with a 2h TTL
+	current := func(created time.Time) string { return created.Add(2 * time.Hour).UTC().Format(time.RFC3339) }
+	stale := func(time.Time) string { return "2024-01-01T00:00:00Z" }
+
+	tests := []struct {
+		name         string
+		ttl          string
+		action       string
+		warnedAt     func(created time.Time) string
+		age          time.Duration
+		notifyBefore time.Duration
+		dryRun       bool
+		wantPatch    bool
+		wantCleared  bool
+		wantEvent    string
+	}{
+		{
+			name:         "inside notification window",
+			ttl:          "2h",
+			age:          90 * time.Minute,
+			notifyBefore: time.Hour,
+			wantPatch:    true,
+			wantEvent:    "Warning DeletionScheduled pods default/test-pod is scheduled for delete at ",
+		},
+		{
+			name:         "action other than delete",
+			ttl:          "2h",
+			action:       "suspend",
+			age:          90 * time.Minute,
+			notifyBefore: time.Hour,
+			wantPatch:    true,
+			wantEvent:    "Warning DeletionScheduled pods default/test-pod is scheduled for suspend at ",
+		},
+		{
+			name:         "outside notification window",
+			ttl:          "24h",
+			age:          time.Hour,
+			notifyBefore: time.Hour,
+		},
+		{
+			name:         "already warned",
+			ttl:          "2h",
+			warnedAt:     current,
+			age:          90 * time.Minute,
+			notifyBefore: time.Hour,
+		},
+		{
+			name:         "deletion time moved",
+			ttl:          "2h",
+			warnedAt:     stale,
+			age:          90 * time.Minute,
+			notifyBefore: time.Hour,
+			wantPatch:    true,
+			wantEvent:    "Warning DeletionScheduled",
+		},
+		{
+			name:         "left notification window",
+			ttl:          "24h",
+			warnedAt:     stale,
+			age:          time.Hour,
+			notifyBefore: time.Hour,
+			wantPatch:    true,
+			wantCleared:  true,
+		},
+		{
+			name:         "no longer scheduled",
+			warnedAt:     stale,
+			age:          time.Hour,
+			notifyBefore: time.Hour,
+			wantPatch:    true,
+			wantCleared:  true,
+		},
+		{
+			name:         "notifications disabled",
+			ttl:          "2h",
+			age:          90 * time.Minute,
+			notifyBefore: 0,
+		},
+		{
+			name:         "dry run",
+			ttl:          "2h",
+			age:          90 * time.Minute,
+			notifyBefore: time.Hour,
+			dryRun:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			annotations := map[string]interface{}{}
+			if tt.ttl != "" {
+				annotations[annotationTTL] = tt.ttl
+			}
+			if tt.action != "" {
+				annotations[annotationAction] = tt.action
+			}
+			pod := newScheduledPod(annotations, tt.age)
+			if tt.warnedAt != nil {
+				annotations := pod.GetAnnotations()
+				annotations[annotationScheduledDeletion] = tt.warnedAt(pod.GetCreationTimestamp().Time)
+				pod.SetAnnotations(annotations)
+			}
+			dynamicClient := fake.NewSimpleDynamicClient(runtime.NewScheme(), pod)
+
+			var patch map[string]interface{}
+			dynamicClient.PrependReactor("patch", "pods", func(action ktesting.Action) (bool, runtime.Object, error) {
+				require.NoError(t, json.Unmarshal(action.(ktesting.PatchAction).GetPatch(), &patch))
+				return true, pod, nil
+			})
+			var deleteCalled bool
+			dynamicClient.PrependReactor("delete", "pods", func(_ ktesting.Action) (bool, runtime.Object, error) {
+				deleteCalled = true
+				return true, nil, nil
+			})
+
+			recorder := record.NewFakeRecorder(10)
+			j := &Janitor{
+				DynamicClient: dynamicClient,
+				Config: Config{
+					DryRun:       tt.dryRun,
+					NotifyBefore: tt.notifyBefore,
+				},
+				EventRecorder: recorder,
+			}
+
+			j.processItem(context.Background(), WorkItem{
+				Resource:  schema.GroupVersionResource{Version: "v1", Resource: "pods"},
+				Namespace: "default",
+				Name:      "test-pod",
+				Obj:       pod,
+			})
+
+			assert.False(t, deleteCalled, "Delete should not be called before expiry")
+			if tt.wantEvent == "" {
+				assert.Empty(t, recorder.Events)
+			} else {
+				require.Len(t, recorder.Events, 1)
+				assert.Contains(t, <-recorder.Events, tt.wantEvent)
+			}
+			if !tt.wantPatch {
+				assert.Nil(t, patch)
+				return
+			}
+
+			annotations = patch["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+			require.Contains(t, annotations, annotationScheduledDeletion)
+			if tt.wantCleared {
+				assert.Nil(t, annotations[annotationScheduledDeletion])
+			} else {
+				assert.Equal(t, current(pod.GetCreationTimestamp().Time), annotations[annotationScheduledDeletion])
+			}
+		})
+	}
+}
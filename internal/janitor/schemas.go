@@ -0,0 +1,43 @@
+package janitor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/rules"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/openapi"
+)
+
+// loadSchemas fetches the OpenAPI v3 schemas of every group version served
+// by the API server, for rules to be checked against. Group versions whose
+// schema cannot be fetched are skipped, so their rules are not checked.
+func loadSchemas(client openapi.Client) (*rules.Schemas, error) {
+	paths, err := client.Paths()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list OpenAPI schemas: %w", err)
+	}
+
+	names := make([]string, 0, len(paths))
+	for path := range paths {
+		// Skip documents that do not describe resources, such as version
+		if strings.HasPrefix(path, "api/") || strings.HasPrefix(path, "apis/") {
+			names = append(names, path)
+		}
+	}
+	sort.Strings(names)
+
+	schemas := rules.NewSchemas()
+	for _, path := range names {
+		data, err := paths[path].Schema(runtime.ContentTypeJSON)
+		if err == nil {
+			err = schemas.AddOpenAPIV3(data)
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("path", path).Warn("Failed to load OpenAPI schema, rules for its resources are not checked")
+		}
+	}
+	return schemas, nil
+}
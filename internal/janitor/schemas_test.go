@@ -0,0 +1,64 @@
+package janitor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/openapi"
+)
+
+type fakeOpenAPIClient map[string]openapi.GroupVersion
+
+func (c fakeOpenAPIClient) Paths() (map[string]openapi.GroupVersion, error) {
+	if c == nil {
+		return nil, errors.New("connection refused")
+	}
+	return c, nil
+}
+
+type fakeGroupVersion struct {
+	data string
+	err  error
+}
+
+func (gv fakeGroupVersion) Schema(string) ([]byte, error) {
+	return []byte(gv.data), gv.err
+}
+
+func (gv fakeGroupVersion) ServerRelativeURL() string {
+	return ""
+}
+
+func TestLoadSchemas(t *testing.T) {
+	kind := func(group, kind string) string {
+		return `{"components": {"schemas": {"` + group + `.` + kind + `": {
+			"type": "object",
+			"properties": {"metadata": {"type": "object", "properties": {"name": {"type": "string"}}}},
+			"x-kubernetes-group-version-kind": [{"group": "` + group + `", "version": "v1", "kind": "` + kind + `"}]
+		}}}}`
+	}
+
+	schemas, err := loadSchemas(fakeOpenAPIClient{
+		"api/v1":          fakeGroupVersion{data: kind("", "Pod")},
+		"apis/batch/v1":   fakeGroupVersion{data: kind("batch", "Job")},
+		"apis/broken/v1":  fakeGroupVersion{err: errors.New("not found")},
+		"apis/invalid/v1": fakeGroupVersion{data: "<html>"},
+		"version":         fakeGroupVersion{data: kind("", "Version")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Job", "Pod"}, schemas.Kinds())
+
+	_, err = rules.New([]rules.Rule{{
+		ID:         "typo",
+		Resources:  []string{"jobs"},
+		Expression: `object.metadata.nmae == "migrate"`,
+		TTL:        "1h",
+	}}, rules.WithSchemas(schemas))
+	assert.ErrorContains(t, err, `no field "nmae"`)
+
+	_, err = loadSchemas(fakeOpenAPIClient(nil))
+	assert.ErrorContains(t, err, "failed to list OpenAPI schemas")
+}
@@ -0,0 +1,208 @@
+package janitor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/metrics"
+	"github.com/blaxel-ai/kube-janitor-go/pkg/duration"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// DefaultMaxExtension caps snoozes by default, so that snoozing a resource
+// again and again cannot keep it forever
+const DefaultMaxExtension = 30 * 24 * time.Hour
+
+const (
+	annotationSnooze      = "janitor/snooze"
+	annotationExtendUntil = "janitor/extend-until"
+	// annotationSnoozedAt and annotationSnoozedValue are written by the janitor
+	// to record when it first saw the current janitor/snooze value
+	annotationSnoozedAt    = "janitor/snoozed-at"
+	annotationSnoozedValue = "janitor/snoozed-value"
+)
+
+// stampSnooze records when a janitor/snooze annotation was set, so the snooze
+// is measured from that moment rather than from the resource's creation. The
+// scheduled deletion warning is cleared at the same time so owners are warned
+// again about the new deletion time. It is only called for resources with a
+// schedule. In dry-run mode the stamp is only remembered, see recallSnooze.
+func (j *Janitor) stampSnooze(ctx context.Context, item WorkItem, logger *logrus.Entry) {
+	annotations := item.Obj.GetAnnotations()
+	snooze, ok := annotations[annotationSnooze]
+	if !ok || annotations[annotationSnoozedValue] == snooze {
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	patch := map[string]interface{}{
+		annotationSnoozedAt:    now,
+		annotationSnoozedValue: snooze,
+	}
+	if _, ok := annotations[annotationScheduledDeletion]; ok {
+		patch[annotationScheduledDeletion] = nil
+	}
+
+	if j.Config.DryRun {
+		j.dryRunStamps.remember(item.Obj.GetUID(), annotationSnooze, annotationStamp{value: snooze, at: now})
+		logger.WithField("snooze", snooze).Info("DRY RUN: Would record snooze time")
+	} else if err := j.patchAnnotations(ctx, item, patch); err != nil {
+		logger.WithError(err).Error("Failed to record snooze time")
+		metrics.Errors.WithLabelValues("patch_resource").Inc()
+	} else {
+		logger.WithField("snooze", snooze).Info("Resource snoozed")
+	}
+
+	// Reflect the patch locally so this pass already honours the snooze,
+	// even if recording it failed and has to be retried on the next pass
+	for key, value := range patch {
+		if value == nil {
+			delete(annotations, key)
+		} else {
+			annotations[key] = value.(string)
+		}
+	}
+	item.Obj.SetAnnotations(annotations)
+}
+
+// recallSnooze applies the snooze stamps remembered in dry-run mode, so that
+// dry runs measure snoozes like real runs instead of restarting them on
+// every pass
+func (j *Janitor) recallSnooze(item WorkItem) {
+	j.recallStamp(item, annotationSnooze, annotationSnoozedAt, annotationSnoozedValue)
+}
+
+// recallStamp applies the stamp of an annotation remembered in dry-run mode,
+// as long as the annotation still has the stamped value
+func (j *Janitor) recallStamp(item WorkItem, annotation, atAnnotation, valueAnnotation string) {
+	if !j.Config.DryRun {
+		return
+	}
+	stamp, ok := j.dryRunStamps.recall(item.Obj.GetUID(), annotation)
+	annotations := item.Obj.GetAnnotations()
+	if !ok || annotations[annotation] != stamp.value || annotations[valueAnnotation] == stamp.value {
+		return
+	}
+	annotations[atAnnotation] = stamp.at
+	annotations[valueAnnotation] = stamp.value
+	item.Obj.SetAnnotations(annotations)
+}
+
+// annotationStamp records when the janitor first saw a value of an
+// annotation, remembered in dry-run mode
+type annotationStamp struct {
+	value string
+	at    string
+	seen  bool
+}
+
+type stampKey struct {
+	uid        types.UID
+	annotation string
+}
+
+// annotationStamps are the stamps remembered in dry-run mode. Like
+// decisionCache, stamps of objects a run no longer saw are dropped by prune.
+type annotationStamps struct {
+	mu     sync.Mutex
+	stamps map[stampKey]annotationStamp
+}
+
+func (s *annotationStamps) remember(uid types.UID, annotation string, stamp annotationStamp) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stamps == nil {
+		s.stamps = make(map[stampKey]annotationStamp)
+	}
+	stamp.seen = true
+	s.stamps[stampKey{uid: uid, annotation: annotation}] = stamp
+}
+
+func (s *annotationStamps) recall(uid types.UID, annotation string) (annotationStamp, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := stampKey{uid: uid, annotation: annotation}
+	stamp, ok := s.stamps[key]
+	if ok {
+		stamp.seen = true
+		s.stamps[key] = stamp
+	}
+	return stamp, ok
+}
+
+// prune forgets the stamps of objects not seen since the last prune
+func (s *annotationStamps) prune() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, stamp := range s.stamps {
+		if !stamp.seen {
+			delete(s.stamps, key)
+			continue
+		}
+		stamp.seen = false
+		s.stamps[key] = stamp
+	}
+}
+
+// applySnooze pushes the deletion time back according to the janitor/snooze
+// and janitor/extend-until annotations, never beyond the allowed maximum
+// extension of the original deletion time
+func (j *Janitor) applySnooze(obj *unstructured.Unstructured, schedule *deletionSchedule, maxExtension duration.Duration) {
+	annotations := obj.GetAnnotations()
+	deleteAt := schedule.deleteAt
+
+	if snooze, ok := annotations[annotationSnooze]; ok {
+		if until, ok := snoozeUntil(obj, snooze); ok && until.After(deleteAt) {
+			deleteAt = until
+		}
+	}
+
+	if extendUntil, ok := annotations[annotationExtendUntil]; ok {
+		until, err := j.parseExpirationTime(obj, annotationExtendUntil)
+		if err != nil {
+			logrus.WithError(err).WithField("extendUntil", extendUntil).Warn("Invalid extend-until format")
+		} else if until.After(deleteAt) {
+			deleteAt = until
+		}
+	}
+
+	if maxExtension.IsZero() {
+		maxExtension = duration.Duration{Fixed: j.Config.MaxExtension}
+	}
+	if !maxExtension.IsZero() {
+		if limit := maxExtension.AddTo(schedule.deleteAt); deleteAt.After(limit) {
+			deleteAt = limit
+		}
+	}
+
+	if deleteAt.After(schedule.deleteAt) {
+		schedule.extendedFrom = schedule.deleteAt
+		schedule.deleteAt = deleteAt
+	}
+}
+
+// snoozeUntil returns the end of the snooze, measured from when the janitor first saw it
+func snoozeUntil(obj *unstructured.Unstructured, snooze string) (time.Time, bool) {
+	snoozeDuration, err := duration.Parse(snooze)
+	if err != nil {
+		logrus.WithError(err).WithField("snooze", snooze).Warn("Invalid snooze format")
+		return time.Time{}, false
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations[annotationSnoozedValue] != snooze {
+		// Not stamped yet, so the snooze starts now
+		return snoozeDuration.AddTo(time.Now()), true
+	}
+
+	snoozedAt, err := time.Parse(time.RFC3339, annotations[annotationSnoozedAt])
+	if err != nil {
+		logrus.WithError(err).WithField("snoozedAt", annotations[annotationSnoozedAt]).Warn("Invalid snoozed-at timestamp")
+		return time.Time{}, false
+	}
+
+	return snoozeDuration.AddTo(snoozedAt), true
+}
@@ -0,0 +1,283 @@
+package janitor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/rules"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestApplySnooze(t *testing.T) {
+	now := time.Now()
+	stamp := func(ago time.Duration) string {
+		return now.Add(-ago).UTC().Format(time.RFC3339)
+	}
+
+	tests := []struct {
+		name         string
+		annotations  map[string]interface{}
+		maxExtension time.Duration
+		wantDelete   bool
+	}{
+		{
+			name:        "expired without snooze",
+			annotations: map[string]interface{}{annotationTTL: "1h"},
+			wantDelete:  true,
+		},
+		{
+			name: "snoozed recently",
+			annotations: map[string]interface{}{
+				annotationTTL:          "1h",
+				annotationSnooze:       "48h",
+				annotationSnoozedAt:    stamp(time.Hour),
+				annotationSnoozedValue: "48h",
+			},
+			wantDelete: false,
+		},
+		{
+			name: "snooze elapsed",
+			annotations: map[string]interface{}{
+				annotationTTL:          "1h",
+				annotationSnooze:       "2d",
+				annotationSnoozedAt:    stamp(72 * time.Hour),
+				annotationSnoozedValue: "2d",
+			},
+			wantDelete: true,
+		},
+		{
+			name: "snooze not yet stamped starts now",
+			annotations: map[string]interface{}{
+				annotationTTL:    "1h",
+				annotationSnooze: "1h",
+			},
+			wantDelete: false,
+		},
+		{
+			name: "changed snooze value starts now",
+			annotations: map[string]interface{}{
+				annotationTTL:          "1h",
+				annotationSnooze:       "3d",
+				annotationSnoozedAt:    stamp(72 * time.Hour),
+				annotationSnoozedValue: "2d",
+			},
+			wantDelete: false,
+		},
+		{
+			name: "invalid snooze is ignored",
+			annotations: map[string]interface{}{
+				annotationTTL:    "1h",
+				annotationSnooze: "a while",
+			},
+			wantDelete: true,
+		},
+		{
+			name: "extend until in the future",
+			annotations: map[string]interface{}{
+				annotationTTL:         "1h",
+				annotationExtendUntil: now.Add(time.Hour).UTC().Format(time.RFC3339),
+			},
+			wantDelete: false,
+		},
+		{
+			name: "extend until in the past",
+			annotations: map[string]interface{}{
+				annotationTTL:         "1h",
+				annotationExtendUntil: stamp(time.Minute),
+			},
+			wantDelete: true,
+		},
+		{
+			name: "snooze capped by max extension",
+			annotations: map[string]interface{}{
+				annotationTTL:          "1h",
+				annotationSnooze:       "1w",
+				annotationSnoozedAt:    stamp(time.Minute),
+				annotationSnoozedValue: "1w",
+			},
+			maxExtension: 30 * time.Minute,
+			wantDelete:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := newScheduledPod(tt.annotations, 2*time.Hour)
+			j := &Janitor{Config: Config{MaxExtension: tt.maxExtension}}
+			gotDelete, _ := expiredNow(t, j, obj)
+			assert.Equal(t, tt.wantDelete, gotDelete)
+		})
+	}
+}
+
+func TestApplySnoozeRuleMaxExtension(t *testing.T) {
+	engine, err := rules.New([]rules.Rule{
+		{
+			ID:           "capped",
+			Resources:    []string{"pods"},
+			Expression:   "true",
+			TTL:          "1h",
+			MaxExtension: "1d",
+		},
+	})
+	require.NoError(t, err)
+
+	obj := newScheduledPod(map[string]interface{}{
+		annotationSnooze:       "1w",
+		annotationSnoozedAt:    time.Now().Add(-time.Minute).UTC().Format(time.RFC3339),
+		annotationSnoozedValue: "1w",
+	}, 2*time.Hour)
+
+	j := &Janitor{RuleEngine: engine, Config: Config{MaxExtension: time.Hour}}
+	schedule, err := j.deletionSchedule(context.Background(), obj)
+	require.NoError(t, err)
+	require.NotNil(t, schedule)
+	assert.WithinDuration(t, obj.GetCreationTimestamp().Add(25*time.Hour), schedule.deleteAt, time.Second,
+		"the rule's cap should take precedence over the global one")
+}
+
+func TestStampSnooze(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]interface{}
+		dryRun      bool
+		wantPatch   bool
+	}{
+		{
+			name: "new snooze",
+			annotations: map[string]interface{}{
+				annotationTTL:               "48h",
+				annotationSnooze:            "48h",
+				annotationScheduledDeletion: "2024-01-01T00:00:00Z",
+			},
+			wantPatch: true,
+		},
+		{
+			name: "already stamped",
+			annotations: map[string]interface{}{
+				annotationTTL:          "48h",
+				annotationSnooze:       "48h",
+				annotationSnoozedAt:    "2024-01-01T00:00:00Z",
+				annotationSnoozedValue: "48h",
+			},
+			wantPatch: false,
+		},
+		{
+			name:        "no snooze",
+			annotations: map[string]interface{}{annotationTTL: "48h"},
+			wantPatch:   false,
+		},
+		{
+			name:        "not scheduled",
+			annotations: map[string]interface{}{annotationSnooze: "48h"},
+			wantPatch:   false,
+		},
+		{
+			name:        "dry run",
+			annotations: map[string]interface{}{annotationTTL: "48h", annotationSnooze: "48h"},
+			dryRun:      true,
+			wantPatch:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newScheduledPod(tt.annotations, time.Hour)
+			dynamicClient := fake.NewSimpleDynamicClient(runtime.NewScheme(), pod)
+
+			var patch map[string]interface{}
+			dynamicClient.PrependReactor("patch", "pods", func(action ktesting.Action) (bool, runtime.Object, error) {
+				require.NoError(t, json.Unmarshal(action.(ktesting.PatchAction).GetPatch(), &patch))
+				return true, pod, nil
+			})
+
+			j := &Janitor{
+				DynamicClient: dynamicClient,
+				Config:        Config{DryRun: tt.dryRun},
+				EventRecorder: record.NewFakeRecorder(10),
+			}
+			j.processItem(context.Background(), WorkItem{
+				Resource:  schema.GroupVersionResource{Version: "v1", Resource: "pods"},
+				Namespace: "default",
+				Name:      "test-pod",
+				Obj:       pod,
+			})
+
+			if !tt.wantPatch {
+				assert.Nil(t, patch)
+				return
+			}
+
+			annotations := patch["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+			assert.Equal(t, "48h", annotations[annotationSnoozedValue])
+			assert.Contains(t, annotations, annotationSnoozedAt)
+			assert.Contains(t, annotations, annotationScheduledDeletion)
+			assert.Nil(t, annotations[annotationScheduledDeletion], "scheduled deletion warning should be cleared")
+			assert.Equal(t, "48h", pod.GetAnnotations()[annotationSnoozedValue])
+			assert.NotContains(t, pod.GetAnnotations(), annotationScheduledDeletion)
+		})
+	}
+}
+
+func TestDryRunSnoozeIsRemembered(t *testing.T) {
+	newPod := func() *unstructured.Unstructured {
+		pod := newScheduledPod(map[string]interface{}{annotationTTL: "1h", annotationSnooze: "2h"}, 2*time.Hour)
+		pod.SetUID("snoozed")
+		return pod
+	}
+	j := &Janitor{Config: Config{DryRun: true}}
+
+	first := newPod()
+	item := WorkItem{Obj: first}
+	j.stampSnooze(context.Background(), item, testLogger(item))
+	stampedAt := first.GetAnnotations()[annotationSnoozedAt]
+	require.NotEmpty(t, stampedAt)
+
+	// The next pass lists the object again, without the stamp
+	second := newPod()
+	j.recallSnooze(WorkItem{Obj: second})
+	assert.Equal(t, stampedAt, second.GetAnnotations()[annotationSnoozedAt])
+	assert.Equal(t, "2h", second.GetAnnotations()[annotationSnoozedValue])
+
+	// A changed snooze starts over
+	changed := newPod()
+	annotations := changed.GetAnnotations()
+	annotations[annotationSnooze] = "3h"
+	changed.SetAnnotations(annotations)
+	j.recallSnooze(WorkItem{Obj: changed})
+	assert.NotContains(t, changed.GetAnnotations(), annotationSnoozedAt)
+}
+
+func TestAnnotationStampsPrune(t *testing.T) {
+	var stamps annotationStamps
+	stamps.remember("1234", annotationSnooze, annotationStamp{value: "2h", at: "2024-01-15T10:00:00Z"})
+	stamps.remember("5678", annotationSnooze, annotationStamp{value: "2h", at: "2024-01-15T10:00:00Z"})
+
+	stamps.prune()
+	_, ok := stamps.recall("1234", annotationSnooze)
+	assert.True(t, ok)
+
+	stamps.prune()
+	_, ok = stamps.recall("1234", annotationSnooze)
+	assert.True(t, ok, "kept while it is seen")
+	_, ok = stamps.recall("5678", annotationSnooze)
+	assert.False(t, ok, "forgotten once a run no longer saw it")
+}
+
+func testLogger(item WorkItem) *logrus.Entry {
+	return logrus.WithFields(logrus.Fields{
+		"resource":  item.Resource.Resource,
+		"namespace": item.Namespace,
+		"name":      item.Name,
+	})
+}
@@ -0,0 +1,98 @@
+package janitor
+
+import (
+	"context"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// weekdayStamp names the annotations written by the janitor to record when
+// it first saw a weekday value of an annotation
+type weekdayStamp struct {
+	at    string
+	value string
+}
+
+// weekdayStamps are the stamps of the annotations that accept weekdays.
+// Weekdays are resolved from the stamp rather than from the resource's
+// creation, which would put them in the past on resources older than a week.
+var weekdayStamps = map[string]weekdayStamp{
+	annotationExpires:     {at: "janitor/expires-seen-at", value: "janitor/expires-seen-value"},
+	annotationExtendUntil: {at: "janitor/extend-until-seen-at", value: "janitor/extend-until-seen-value"},
+}
+
+// weekdaySeenAt returns when the janitor first saw the current value of an
+// annotation, or now if it did not stamp it yet
+func weekdaySeenAt(obj *unstructured.Unstructured, annotation string) time.Time {
+	annotations := obj.GetAnnotations()
+	stamp := weekdayStamps[annotation]
+	if value, ok := annotations[stamp.value]; ok && value == annotations[annotation] {
+		if seenAt, err := time.Parse(time.RFC3339, annotations[stamp.at]); err == nil {
+			return seenAt
+		}
+		logrus.WithField("seenAt", annotations[stamp.at]).Warn("Invalid weekday seen-at timestamp")
+	}
+	return time.Now()
+}
+
+// stampWeekdays records when weekday values of janitor/expires and
+// janitor/extend-until were set, and removes the stamps of values that are
+// no longer weekdays. It is only called for resources with a schedule. In
+// dry-run mode the stamps are only remembered, see recallWeekdays.
+func (j *Janitor) stampWeekdays(ctx context.Context, item WorkItem, logger *logrus.Entry) {
+	annotations := item.Obj.GetAnnotations()
+	now := time.Now().UTC().Format(time.RFC3339)
+	patch := map[string]interface{}{}
+	for annotation, stamp := range weekdayStamps {
+		value, ok := annotations[annotation]
+		if ok && j.expirationParser().IsRelative(value) {
+			if annotations[stamp.value] != value {
+				patch[stamp.at] = now
+				patch[stamp.value] = value
+			}
+			continue
+		}
+		_, stampedAt := annotations[stamp.at]
+		if _, stamped := annotations[stamp.value]; stamped || stampedAt {
+			patch[stamp.at] = nil
+			patch[stamp.value] = nil
+		}
+	}
+	if len(patch) == 0 {
+		return
+	}
+
+	if j.Config.DryRun {
+		for annotation, stamp := range weekdayStamps {
+			if value, ok := patch[stamp.value].(string); ok {
+				j.dryRunStamps.remember(item.Obj.GetUID(), annotation, annotationStamp{value: value, at: now})
+			}
+		}
+		logger.Info("DRY RUN: Would record weekday times")
+	} else if err := j.patchAnnotations(ctx, item, patch); err != nil {
+		logger.WithError(err).Error("Failed to record weekday times")
+		metrics.Errors.WithLabelValues("patch_resource").Inc()
+	} else {
+		logger.Debug("Weekday times recorded")
+	}
+
+	// Reflect the patch locally, like stampSnooze
+	for key, value := range patch {
+		if value == nil {
+			delete(annotations, key)
+		} else {
+			annotations[key] = value.(string)
+		}
+	}
+	item.Obj.SetAnnotations(annotations)
+}
+
+// recallWeekdays applies the weekday stamps remembered in dry-run mode
+func (j *Janitor) recallWeekdays(item WorkItem) {
+	for annotation, stamp := range weekdayStamps {
+		j.recallStamp(item, annotation, stamp.at, stamp.value)
+	}
+}
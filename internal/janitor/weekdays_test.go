@@ -0,0 +1,112 @@
+package janitor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestWeekdaysOnOldResources(t *testing.T) {
+	expiresStamp := weekdayStamps[annotationExpires]
+	daysAgo := func(days int) string { return time.Now().AddDate(0, 0, -days).UTC().Format(time.RFC3339) }
+
+	tests := []struct {
+		name        string
+		annotations map[string]interface{}
+		wantDeleted bool
+		wantStamp   interface{}
+	}{
+		{
+			name:        "expires on the next weekday after it was set",
+			annotations: map[string]interface{}{annotationExpires: "next friday"},
+			wantStamp:   "next friday",
+		},
+		{
+			name: "expires once the weekday after the stamp passed",
+			annotations: map[string]interface{}{
+				annotationExpires:  "next friday",
+				expiresStamp.at:    daysAgo(8),
+				expiresStamp.value: "next friday",
+			},
+			wantDeleted: true,
+		},
+		{
+			name:        "extends until the next weekday after it was set",
+			annotations: map[string]interface{}{annotationTTL: "1h", annotationExtendUntil: "next friday"},
+		},
+		{
+			name: "stamps of a value that is no longer a weekday are removed",
+			annotations: map[string]interface{}{
+				annotationExpires:  "2099-01-01",
+				expiresStamp.at:    daysAgo(8),
+				expiresStamp.value: "next friday",
+			},
+			wantStamp: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newScheduledPod(tt.annotations, 6*7*24*time.Hour)
+			client := fake.NewSimpleDynamicClient(runtime.NewScheme(), pod)
+
+			var patch map[string]interface{}
+			client.PrependReactor("patch", "pods", func(action ktesting.Action) (bool, runtime.Object, error) {
+				require.NoError(t, json.Unmarshal(action.(ktesting.PatchAction).GetPatch(), &patch))
+				return true, pod, nil
+			})
+			var deleteCalled bool
+			client.PrependReactor("delete", "pods", func(_ ktesting.Action) (bool, runtime.Object, error) {
+				deleteCalled = true
+				return true, nil, nil
+			})
+
+			j := &Janitor{DynamicClient: client, EventRecorder: record.NewFakeRecorder(10)}
+			j.processItem(context.Background(), WorkItem{
+				Resource:  schema.GroupVersionResource{Version: "v1", Resource: "pods"},
+				Namespace: "default",
+				Name:      "test-pod",
+				Obj:       pod,
+			})
+
+			assert.Equal(t, tt.wantDeleted, deleteCalled)
+			if _, ok := tt.annotations[annotationExpires]; !ok || tt.wantDeleted {
+				return
+			}
+			require.NotNil(t, patch)
+			annotations := patch["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+			require.Contains(t, annotations, expiresStamp.value)
+			assert.Equal(t, tt.wantStamp, annotations[expiresStamp.value])
+		})
+	}
+}
+
+func TestDryRunWeekdaysAreRemembered(t *testing.T) {
+	newPod := func() WorkItem {
+		pod := newScheduledPod(map[string]interface{}{annotationExpires: "friday"}, 6*7*24*time.Hour)
+		pod.SetUID("weekday")
+		return WorkItem{Obj: pod}
+	}
+	stamp := weekdayStamps[annotationExpires]
+	j := &Janitor{Config: Config{DryRun: true}}
+
+	first := newPod()
+	j.stampWeekdays(context.Background(), first, testLogger(first))
+	seenAt := first.Obj.GetAnnotations()[stamp.at]
+	require.NotEmpty(t, seenAt)
+
+	// The next pass lists the object again, without the stamp
+	second := newPod()
+	j.recallWeekdays(second)
+	assert.Equal(t, seenAt, second.Obj.GetAnnotations()[stamp.at])
+	assert.Equal(t, "friday", second.Obj.GetAnnotations()[stamp.value])
+}
@@ -29,6 +29,83 @@ var (
 		[]string{"resource", "namespace"},
 	)
 
+	// ResourcesDeferred is a counter for expired resources left in place because deletions
+	// were outside the deletion window
+	ResourcesDeferred = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kube_janitor_resources_deferred_total",
+			Help: "Total number of expired resources whose deletion was deferred to the deletion window",
+		},
+		[]string{"resource", "namespace"},
+	)
+
+	// ResourcesMarked is a counter for expired resources labeled for deletion, waiting
+	// for the confirmation period
+	ResourcesMarked = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kube_janitor_resources_marked_total",
+			Help: "Total number of expired resources marked for deletion after the confirmation period",
+		},
+		[]string{"resource", "namespace"},
+	)
+
+	// ActionsTaken is a counter for actions other than delete taken on expired resources
+	ActionsTaken = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kube_janitor_actions_total",
+			Help: "Total number of actions other than delete taken on expired resources",
+		},
+		[]string{"action", "resource", "namespace"},
+	)
+
+	// InvalidAnnotations is a counter for janitor annotations whose value cannot be parsed,
+	// counted once per resource version
+	InvalidAnnotations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kube_janitor_invalid_annotations_total",
+			Help: "Total number of invalid janitor annotations found on resources",
+		},
+		[]string{"resource", "annotation"},
+	)
+
+	// RuleEvaluations is a counter for rule expression evaluations
+	RuleEvaluations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kube_janitor_rule_evaluations_total",
+			Help: "Total number of times a rule expression was evaluated",
+		},
+		[]string{"rule"},
+	)
+
+	// RuleMatches is a counter for objects matched by a rule
+	RuleMatches = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kube_janitor_rule_matches_total",
+			Help: "Total number of objects matched by a rule",
+		},
+		[]string{"rule"},
+	)
+
+	// RuleErrors is a counter for rule expressions that failed to evaluate
+	RuleErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kube_janitor_rule_errors_total",
+			Help: "Total number of rule expression evaluation errors",
+		},
+		[]string{"rule"},
+	)
+
+	// RuleEvaluationDuration is a histogram for rule expression evaluation times.
+	// The average is rate(_sum) / rate(_count).
+	RuleEvaluationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kube_janitor_rule_evaluation_duration_seconds",
+			Help:    "Histogram of rule expression evaluation durations",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 4, 8),
+		},
+		[]string{"rule"},
+	)
+
 	// CleanupDuration is a histogram for cleanup run durations
 	CleanupDuration = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
@@ -46,33 +123,56 @@ var (
 		},
 		[]string{"type"},
 	)
+
+	// EmptyNamespaces is a gauge for the namespaces found empty by the last cleanup run
+	EmptyNamespaces = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "kube_janitor_empty_namespaces",
+			Help: "Number of namespaces holding only ignored objects in the last cleanup run",
+		},
+	)
 )
 
 func init() {
 	// Register metrics
 	prometheus.MustRegister(ResourcesDeleted)
 	prometheus.MustRegister(ResourcesEvaluated)
+	prometheus.MustRegister(ResourcesDeferred)
+	prometheus.MustRegister(ResourcesMarked)
+	prometheus.MustRegister(ActionsTaken)
+	prometheus.MustRegister(InvalidAnnotations)
+	prometheus.MustRegister(RuleEvaluations)
+	prometheus.MustRegister(RuleMatches)
+	prometheus.MustRegister(RuleErrors)
+	prometheus.MustRegister(RuleEvaluationDuration)
 	prometheus.MustRegister(CleanupDuration)
 	prometheus.MustRegister(Errors)
+	prometheus.MustRegister(EmptyNamespaces)
 }
 
 // Server represents the metrics server
 type Server struct {
 	port int
+	mux  *http.ServeMux
 }
 
 // NewServer creates a new metrics server
 func NewServer(port int) *Server {
 	return &Server{
 		port: port,
+		mux:  http.NewServeMux(),
 	}
 }
 
+// Handle registers an additional endpoint, before the server is started
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
 // Start starts the metrics server
 func (s *Server) Start() error {
-	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.Handler())
-	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
+	s.mux.Handle("/metrics", promhttp.Handler())
+	s.mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		if _, err := w.Write([]byte("ok")); err != nil {
 			logrus.Errorf("Failed to write health check response: %v", err)
@@ -84,7 +184,7 @@ func (s *Server) Start() error {
 
 	server := &http.Server{
 		Addr:              addr,
-		Handler:           mux,
+		Handler:           s.mux,
 		ReadTimeout:       10 * time.Second,
 		WriteTimeout:      10 * time.Second,
 		IdleTimeout:       60 * time.Second,
@@ -24,6 +24,12 @@ func TestMetricsRegistration(t *testing.T) {
 	// This is mainly to ensure the init() function runs without panic
 	assert.NotNil(t, ResourcesDeleted)
 	assert.NotNil(t, ResourcesEvaluated)
+	assert.NotNil(t, ResourcesDeferred)
+	assert.NotNil(t, InvalidAnnotations)
+	assert.NotNil(t, RuleEvaluations)
+	assert.NotNil(t, RuleMatches)
+	assert.NotNil(t, RuleErrors)
+	assert.NotNil(t, RuleEvaluationDuration)
 	assert.NotNil(t, CleanupDuration)
 	assert.NotNil(t, Errors)
 }
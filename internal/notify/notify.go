@@ -0,0 +1,191 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// FormatGeneric posts the deletions as a generic JSON document
+	FormatGeneric = "generic"
+	// FormatSlack posts the deletions as a Slack-compatible message
+	FormatSlack = "slack"
+)
+
+// Deletion describes a resource deleted, or that would have been deleted in dry-run mode
+type Deletion struct {
+	Group       string            `json:"group"`
+	Version     string            `json:"version"`
+	Resource    string            `json:"resource"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Name        string            `json:"name"`
+	Reason      string            `json:"reason"`
+	OwnerLabels map[string]string `json:"ownerLabels,omitempty"`
+	DryRun      bool              `json:"dryRun"`
+	Time        time.Time         `json:"time"`
+}
+
+// Notifier delivers a batch of deletions collected during a cleanup run
+type Notifier interface {
+	Notify(ctx context.Context, deletions []Deletion) error
+}
+
+// Formatter encodes a batch of deletions into a webhook request body
+type Formatter func(deletions []Deletion) ([]byte, error)
+
+// GenericFormatter encodes deletions as {"count": n, "deletions": [...]}
+func GenericFormatter(deletions []Deletion) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"count":     len(deletions),
+		"deletions": deletions,
+	})
+}
+
+// SlackFormatter encodes deletions as a Slack incoming webhook message. A
+// batch made only of dry-run deletions says what would have been deleted,
+// otherwise dry-run deletions are flagged one by one.
+func SlackFormatter(deletions []Deletion) ([]byte, error) {
+	dryRun := true
+	for _, d := range deletions {
+		dryRun = dryRun && d.DryRun
+	}
+
+	var b strings.Builder
+	if dryRun {
+		fmt.Fprintf(&b, "kube-janitor-go would delete %d resource(s):", len(deletions))
+	} else {
+		fmt.Fprintf(&b, "kube-janitor-go deleted %d resource(s):", len(deletions))
+	}
+	for _, d := range deletions {
+		b.WriteString("\n• ")
+		if d.DryRun && !dryRun {
+			b.WriteString("[dry run] ")
+		}
+		fmt.Fprintf(&b, "`%s %s` - %s", d.Resource, qualifiedName(d), d.Reason)
+		for _, key := range sortedKeys(d.OwnerLabels) {
+			fmt.Fprintf(&b, " %s=%s", key, d.OwnerLabels[key])
+		}
+	}
+
+	return json.Marshal(map[string]string{"text": b.String()})
+}
+
+// WebhookNotifier posts batches of deletions to an HTTP endpoint
+type WebhookNotifier struct {
+	URL        string
+	Formatter  Formatter
+	Client     *http.Client
+	MaxRetries int
+	Backoff    time.Duration
+}
+
+// NewWebhookNotifier creates a new WebhookNotifier posting to an absolute
+// http or https URL in the given payload format
+func NewWebhookNotifier(endpoint, format string) (*WebhookNotifier, error) {
+	u, err := url.ParseRequestURI(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook url '%s': must be an http or https URL", endpoint)
+	}
+
+	var formatter Formatter
+	switch format {
+	case "", FormatGeneric:
+		formatter = GenericFormatter
+	case FormatSlack:
+		formatter = SlackFormatter
+	default:
+		return nil, fmt.Errorf("unknown webhook format '%s': must be one of %s, %s", format, FormatGeneric, FormatSlack)
+	}
+
+	return &WebhookNotifier{
+		URL:        endpoint,
+		Formatter:  formatter,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		MaxRetries: 3,
+		Backoff:    time.Second,
+	}, nil
+}
+
+// Notify posts the deletions, retrying with exponential backoff on
+// connection errors, 429 and 5xx responses
+func (w *WebhookNotifier) Notify(ctx context.Context, deletions []Deletion) error {
+	if len(deletions) == 0 {
+		return nil
+	}
+
+	body, err := w.Formatter(deletions)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	backoff := w.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= w.MaxRetries {
+			return err
+		}
+
+		logrus.WithError(err).WithField("attempt", attempt+1).Debug("Webhook notification failed, retrying")
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// post sends a single request and reports whether a failure is worth retrying
+func (w *WebhookNotifier) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("failed to send webhook request: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+}
+
+func qualifiedName(d Deletion) string {
+	if d.Namespace == "" {
+		return d.Name
+	}
+	return d.Namespace + "/" + d.Name
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
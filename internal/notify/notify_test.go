@@ -0,0 +1,164 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testDeletions = []Deletion{
+	{
+		Version:     "v1",
+		Resource:    "pods",
+		Namespace:   "default",
+		Name:        "test-pod",
+		Reason:      "TTL expired",
+		OwnerLabels: map[string]string{"team": "platform"},
+		Time:        time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+	},
+	{
+		Group:    "apps",
+		Version:  "v1",
+		Resource: "deployments",
+		Name:     "pr-123",
+		Reason:   "Rule 'pr-deployments' matched",
+		DryRun:   true,
+		Time:     time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+	},
+}
+
+func newTestNotifier(t *testing.T, format, url string) *WebhookNotifier {
+	n, err := NewWebhookNotifier(url, format)
+	require.NoError(t, err)
+	n.Backoff = time.Millisecond
+	return n
+}
+
+func TestNewWebhookNotifier(t *testing.T) {
+	_, err := NewWebhookNotifier("http://example.com", "teams")
+	assert.Error(t, err)
+
+	for _, endpoint := range []string{"example.com/hook", "/hook", "ftp://example.com", "http://", "hooks.slack.com"} {
+		_, err = NewWebhookNotifier(endpoint, "")
+		assert.ErrorContains(t, err, "invalid webhook url", endpoint)
+	}
+
+	n, err := NewWebhookNotifier("http://example.com", "")
+	require.NoError(t, err)
+	assert.NotNil(t, n.Formatter)
+}
+
+func TestWebhookNotifierGeneric(t *testing.T) {
+	var payload struct {
+		Count     int        `json:"count"`
+		Deletions []Deletion `json:"deletions"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &payload))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	err := newTestNotifier(t, FormatGeneric, server.URL).Notify(context.Background(), testDeletions)
+	require.NoError(t, err)
+	assert.Equal(t, 2, payload.Count)
+	assert.Equal(t, testDeletions, payload.Deletions)
+}
+
+func TestWebhookNotifierSlack(t *testing.T) {
+	var payload map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	err := newTestNotifier(t, FormatSlack, server.URL).Notify(context.Background(), testDeletions)
+	require.NoError(t, err)
+	assert.Contains(t, payload["text"], "deleted 2 resource(s)")
+	assert.Contains(t, payload["text"], "`pods default/test-pod` - TTL expired team=platform")
+	assert.Contains(t, payload["text"], "[dry run] `deployments pr-123`")
+
+	// A dry run says what would be deleted
+	err = newTestNotifier(t, FormatSlack, server.URL).Notify(context.Background(), testDeletions[1:])
+	require.NoError(t, err)
+	assert.Equal(t, "kube-janitor-go would delete 1 resource(s):\n• `deployments pr-123` - Rule 'pr-deployments' matched", payload["text"])
+}
+
+func TestWebhookNotifierRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int32
+		status       int
+		wantErr      bool
+		wantRequests int32
+	}{
+		{
+			name:         "recovers after server errors",
+			failures:     2,
+			status:       http.StatusBadGateway,
+			wantRequests: 3,
+		},
+		{
+			name:         "gives up after max retries",
+			failures:     10,
+			status:       http.StatusServiceUnavailable,
+			wantErr:      true,
+			wantRequests: 4,
+		},
+		{
+			name:         "does not retry client errors",
+			failures:     10,
+			status:       http.StatusBadRequest,
+			wantErr:      true,
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if atomic.AddInt32(&requests, 1) <= tt.failures {
+					w.WriteHeader(tt.status)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			err := newTestNotifier(t, FormatGeneric, server.URL).Notify(context.Background(), testDeletions)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantRequests, atomic.LoadInt32(&requests))
+		})
+	}
+}
+
+func TestWebhookNotifierEmptyBatch(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	err := newTestNotifier(t, FormatGeneric, server.URL).Notify(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Zero(t, atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,270 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/archive"
+	"github.com/blaxel-ai/kube-janitor-go/internal/fieldmanager"
+	"github.com/blaxel-ai/kube-janitor-go/pkg/manifest"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// AnnotationRestoredFrom records the cleanup run a restored object was archived by
+	AnnotationRestoredFrom = "janitor/restored-from"
+	// AnnotationProtectedUntil keeps the janitor from deleting a restored object
+	// before the given time
+	AnnotationProtectedUntil = "janitor/protected-until"
+)
+
+// Status is the outcome of restoring a single object
+type Status string
+
+// Restore outcomes
+const (
+	StatusRestored Status = "restored"
+	StatusExists   Status = "exists"
+	StatusDryRun   Status = "dry-run"
+	StatusFailed   Status = "failed"
+)
+
+// Result describes what happened to an archived object
+type Result struct {
+	Entry  archive.Entry
+	Status Status
+	Err    error
+}
+
+// Filter selects archived objects by namespace and name
+type Filter struct {
+	Namespace string
+	Name      string
+}
+
+// Matches reports whether an archived object is selected. Filtering by
+// namespace also selects the namespace object itself.
+func (f Filter) Matches(entry archive.Entry) bool {
+	if f.Name != "" && entry.Name != f.Name {
+		return false
+	}
+	if f.Namespace == "" {
+		return true
+	}
+	if entry.Namespace == "" && entry.Kind == "Namespace" {
+		return entry.Name == f.Namespace
+	}
+	return entry.Namespace == f.Namespace
+}
+
+// Restorer re-creates archived objects
+type Restorer struct {
+	Client dynamic.Interface
+	Mapper meta.RESTMapper
+	// Grace protects restored objects from being deleted again for this long
+	Grace  time.Duration
+	DryRun bool
+}
+
+// Restore re-creates the given objects in dependency order: namespaces
+// first, then configuration, then workloads from controllers down to pods.
+// Owner references to objects restored in the same batch are updated to
+// their new UIDs; references to owners that no longer exist are removed so
+// the garbage collector does not delete the restored object again.
+func (r *Restorer) Restore(ctx context.Context, records []archive.Record) []Result {
+	sorted := make([]archive.Record, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, k int) bool {
+		return priority(sorted[i].Entry.Kind) < priority(sorted[k].Entry.Kind)
+	})
+
+	restoredUIDs := make(map[types.UID]types.UID)
+	results := make([]Result, 0, len(sorted))
+	for _, record := range sorted {
+		result := r.restore(ctx, record, restoredUIDs)
+		results = append(results, result)
+
+		logger := logrus.WithFields(logrus.Fields{
+			"resource":  record.Entry.Resource,
+			"namespace": record.Entry.Namespace,
+			"name":      record.Entry.Name,
+			"status":    result.Status,
+		})
+		if result.Err != nil {
+			logger.WithError(result.Err).Error("Failed to restore resource")
+		} else {
+			logger.Info("Resource restored")
+		}
+	}
+	return results
+}
+
+func (r *Restorer) restore(ctx context.Context, record archive.Record, restoredUIDs map[types.UID]types.UID) Result {
+	entry := record.Entry
+	result := Result{Entry: entry}
+	obj := r.prepare(record)
+
+	owners, err := r.liveOwners(ctx, obj, restoredUIDs)
+	if err != nil {
+		result.Status, result.Err = StatusFailed, err
+		return result
+	}
+	obj.SetOwnerReferences(owners)
+
+	if r.DryRun {
+		// Dependents keep their reference as if the owner had been restored
+		restoredUIDs[types.UID(entry.UID)] = types.UID(entry.UID)
+		result.Status = StatusDryRun
+		return result
+	}
+
+	client := r.resourceClient(entry.GroupVersionResource(), entry.Namespace)
+	created, err := client.Create(ctx, obj, metav1.CreateOptions{FieldManager: fieldmanager.Name})
+	if apierrors.IsAlreadyExists(err) {
+		result.Status = StatusExists
+		if existing, err := client.Get(ctx, entry.Name, metav1.GetOptions{}); err == nil {
+			restoredUIDs[types.UID(entry.UID)] = existing.GetUID()
+		}
+		return result
+	}
+	if err != nil {
+		result.Status, result.Err = StatusFailed, fmt.Errorf("failed to create %s %s: %w", entry.Resource, entry.Name, err)
+		return result
+	}
+
+	restoredUIDs[types.UID(entry.UID)] = created.GetUID()
+	result.Status = StatusRestored
+	return result
+}
+
+// prepare strips server-managed fields from an archived manifest and marks it as restored
+func (r *Restorer) prepare(record archive.Record) *unstructured.Unstructured {
+	obj := manifest.Strip(record.Object)
+	obj.SetNamespace(record.Entry.Namespace)
+
+	// The cluster IP may have been reallocated since the service was deleted
+	if obj.GetKind() == "Service" && obj.GetAPIVersion() == "v1" {
+		if clusterIP, _, _ := unstructured.NestedString(obj.Object, "spec", "clusterIP"); clusterIP != "None" {
+			unstructured.RemoveNestedField(obj.Object, "spec", "clusterIP")
+			unstructured.RemoveNestedField(obj.Object, "spec", "clusterIPs")
+		}
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	delete(annotations, "janitor/scheduled-deletion")
+	// Weekdays are resolved again from the time of the restore
+	for _, stamp := range []string{
+		"janitor/expires-seen-at", "janitor/expires-seen-value",
+		"janitor/extend-until-seen-at", "janitor/extend-until-seen-value",
+	} {
+		delete(annotations, stamp)
+	}
+	annotations[AnnotationRestoredFrom] = record.Entry.RunID
+	if r.Grace > 0 {
+		annotations[AnnotationProtectedUntil] = time.Now().Add(r.Grace).UTC().Format(time.RFC3339)
+	}
+	obj.SetAnnotations(annotations)
+
+	// A restored object has to be confirmed again before it is acted on
+	labels := obj.GetLabels()
+	delete(labels, "janitor/marked-at")
+	obj.SetLabels(labels)
+	return obj
+}
+
+// liveOwners returns the object's owner references that point to existing
+// objects, remapped to the new UIDs of owners restored in this batch
+func (r *Restorer) liveOwners(ctx context.Context, obj *unstructured.Unstructured, restoredUIDs map[types.UID]types.UID) ([]metav1.OwnerReference, error) {
+	var owners []metav1.OwnerReference
+	for _, ref := range obj.GetOwnerReferences() {
+		if uid, ok := restoredUIDs[ref.UID]; ok {
+			ref.UID = uid
+			owners = append(owners, ref)
+			continue
+		}
+
+		alive, err := r.ownerExists(ctx, obj.GetNamespace(), ref)
+		if err != nil {
+			return nil, err
+		}
+		if alive {
+			owners = append(owners, ref)
+			continue
+		}
+		logrus.WithFields(logrus.Fields{
+			"name":  obj.GetName(),
+			"owner": fmt.Sprintf("%s/%s", ref.Kind, ref.Name),
+		}).Info("Dropping reference to deleted owner")
+	}
+	return owners, nil
+}
+
+// ownerExists reports whether the referenced owner still exists with the same UID
+func (r *Restorer) ownerExists(ctx context.Context, namespace string, ref metav1.OwnerReference) (bool, error) {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return false, nil
+	}
+	mapping, err := r.Mapper.RESTMapping(gv.WithKind(ref.Kind).GroupKind(), gv.Version)
+	if meta.IsNoMatchError(err) {
+		// The owner's type is gone, so is the owner
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve owner kind %s: %w", ref.Kind, err)
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		namespace = ""
+	}
+
+	owner, err := r.resourceClient(mapping.Resource, namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get owner %s %s: %w", ref.Kind, ref.Name, err)
+	}
+	return owner.GetUID() == ref.UID, nil
+}
+
+func (r *Restorer) resourceClient(gvr schema.GroupVersionResource, namespace string) dynamic.ResourceInterface {
+	if namespace == "" {
+		return r.Client.Resource(gvr)
+	}
+	return r.Client.Resource(gvr).Namespace(namespace)
+}
+
+// priority orders kinds so that objects are created after what they depend on
+func priority(kind string) int {
+	switch kind {
+	case "Namespace":
+		return 0
+	case "CustomResourceDefinition", "StorageClass", "PriorityClass":
+		return 1
+	case "ServiceAccount", "ConfigMap", "Secret", "PersistentVolume", "PersistentVolumeClaim",
+		"Role", "ClusterRole", "RoleBinding", "ClusterRoleBinding", "LimitRange", "ResourceQuota":
+		return 2
+	case "Service":
+		return 3
+	case "Deployment", "StatefulSet", "DaemonSet", "CronJob":
+		return 4
+	case "ReplicaSet", "Job", "ReplicationController":
+		return 5
+	case "Pod":
+		return 6
+	default:
+		return 7
+	}
+}
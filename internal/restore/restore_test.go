@@ -0,0 +1,202 @@
+package restore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/archive"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func newRecord(group, version, resource, kind, namespace, name, uid string, owners ...metav1.OwnerReference) archive.Record {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(schema.GroupVersion{Group: group, Version: version}.String())
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetUID(types.UID(uid))
+	obj.SetResourceVersion("42")
+	obj.SetOwnerReferences(owners)
+
+	return archive.Record{
+		Entry: archive.Entry{
+			RunID:     "20240301T120000Z",
+			Group:     group,
+			Version:   version,
+			Resource:  resource,
+			Kind:      kind,
+			Namespace: namespace,
+			Name:      name,
+			UID:       uid,
+		},
+		Object: obj,
+	}
+}
+
+func ownerRef(apiVersion, kind, name, uid string) metav1.OwnerReference {
+	return metav1.OwnerReference{APIVersion: apiVersion, Kind: kind, Name: name, UID: types.UID(uid)}
+}
+
+func newMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"}, meta.RESTScopeNamespace)
+	return mapper
+}
+
+func TestFilterMatches(t *testing.T) {
+	pod := archive.Entry{Kind: "Pod", Namespace: "foo", Name: "bar"}
+	namespace := archive.Entry{Kind: "Namespace", Name: "foo"}
+
+	assert.True(t, Filter{}.Matches(pod))
+	assert.True(t, Filter{Namespace: "foo"}.Matches(pod))
+	assert.True(t, Filter{Namespace: "foo"}.Matches(namespace))
+	assert.True(t, Filter{Namespace: "foo", Name: "bar"}.Matches(pod))
+	assert.False(t, Filter{Namespace: "foo", Name: "baz"}.Matches(pod))
+	assert.False(t, Filter{Namespace: "other"}.Matches(pod))
+	assert.False(t, Filter{Namespace: "other"}.Matches(namespace))
+}
+
+func TestRestore(t *testing.T) {
+	liveOwner := &unstructured.Unstructured{}
+	liveOwner.SetAPIVersion("v1")
+	liveOwner.SetKind("ConfigMap")
+	liveOwner.SetNamespace("foo")
+	liveOwner.SetName("owner")
+	liveOwner.SetUID("live-uid")
+
+	existing := &unstructured.Unstructured{}
+	existing.SetAPIVersion("v1")
+	existing.SetKind("ConfigMap")
+	existing.SetNamespace("foo")
+	existing.SetName("existing")
+	existing.SetUID("existing-uid")
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), liveOwner, existing)
+	var created []string
+	client.PrependReactor("create", "*", func(action ktesting.Action) (bool, runtime.Object, error) {
+		obj := action.(ktesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		obj.SetUID(types.UID("new-" + obj.GetName()))
+		created = append(created, obj.GetKind())
+		return false, nil, nil
+	})
+
+	records := []archive.Record{
+		newRecord("", "v1", "pods", "Pod", "foo", "web-abc", "pod-uid",
+			ownerRef("apps/v1", "ReplicaSet", "web", "rs-uid")),
+		newRecord("apps", "v1", "replicasets", "ReplicaSet", "foo", "web", "rs-uid",
+			ownerRef("apps/v1", "Deployment", "web", "deployment-uid")),
+		newRecord("", "v1", "secrets", "Secret", "foo", "owned", "secret-uid",
+			ownerRef("v1", "ConfigMap", "owner", "live-uid"),
+			ownerRef("v1", "ConfigMap", "owner", "stale-uid")),
+		newRecord("", "v1", "configmaps", "ConfigMap", "foo", "existing", "old-existing-uid"),
+		newRecord("", "v1", "namespaces", "Namespace", "", "foo", "ns-uid"),
+	}
+
+	restorer := &Restorer{Client: client, Mapper: newMapper(), Grace: time.Hour}
+	results := restorer.Restore(context.Background(), records)
+	require.Len(t, results, len(records))
+
+	statuses := make(map[string]Status)
+	for _, result := range results {
+		assert.NoError(t, result.Err)
+		statuses[result.Entry.Name] = result.Status
+	}
+	assert.Equal(t, StatusExists, statuses["existing"])
+	assert.Equal(t, StatusRestored, statuses["web-abc"])
+	assert.Equal(t, []string{"Namespace", "Secret", "ConfigMap", "ReplicaSet", "Pod"}, created)
+
+	get := func(gvr schema.GroupVersionResource, namespace, name string) *unstructured.Unstructured {
+		obj, err := client.Resource(gvr).Namespace(namespace).Get(context.Background(), name, metav1.GetOptions{})
+		require.NoError(t, err)
+		return obj
+	}
+
+	// The pod now belongs to the restored replica set
+	pod := get(schema.GroupVersionResource{Version: "v1", Resource: "pods"}, "foo", "web-abc")
+	require.Len(t, pod.GetOwnerReferences(), 1)
+	assert.Equal(t, types.UID("new-web"), pod.GetOwnerReferences()[0].UID)
+	assert.Empty(t, pod.GetResourceVersion())
+	assert.Equal(t, "20240301T120000Z", pod.GetAnnotations()[AnnotationRestoredFrom])
+
+	protectedUntil, err := time.Parse(time.RFC3339, pod.GetAnnotations()[AnnotationProtectedUntil])
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), protectedUntil, time.Minute)
+
+	// The deployment is gone, so the replica set is no longer owned
+	rs := get(schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "replicasets"}, "foo", "web")
+	assert.Empty(t, rs.GetOwnerReferences())
+
+	// Only the reference matching the live owner's UID is kept
+	secret := get(schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, "foo", "owned")
+	require.Len(t, secret.GetOwnerReferences(), 1)
+	assert.Equal(t, types.UID("live-uid"), secret.GetOwnerReferences()[0].UID)
+}
+
+func TestRestoreDryRun(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	client.PrependReactor("create", "*", func(_ ktesting.Action) (bool, runtime.Object, error) {
+		t.Fatal("dry run must not create resources")
+		return true, nil, nil
+	})
+
+	records := []archive.Record{
+		newRecord("", "v1", "pods", "Pod", "foo", "web-abc", "pod-uid",
+			ownerRef("apps/v1", "ReplicaSet", "web", "rs-uid")),
+		newRecord("apps", "v1", "replicasets", "ReplicaSet", "foo", "web", "rs-uid"),
+	}
+
+	restorer := &Restorer{Client: client, Mapper: newMapper(), DryRun: true}
+	results := restorer.Restore(context.Background(), records)
+	require.Len(t, results, 2)
+	for _, result := range results {
+		assert.NoError(t, result.Err)
+		assert.Equal(t, StatusDryRun, result.Status)
+	}
+}
+
+func TestPrepareService(t *testing.T) {
+	record := newRecord("", "v1", "services", "Service", "foo", "web", "svc-uid")
+	require.NoError(t, unstructured.SetNestedField(record.Object.Object, "10.0.0.1", "spec", "clusterIP"))
+	require.NoError(t, unstructured.SetNestedStringSlice(record.Object.Object, []string{"10.0.0.1"}, "spec", "clusterIPs"))
+
+	obj := (&Restorer{}).prepare(record)
+	_, found, _ := unstructured.NestedString(obj.Object, "spec", "clusterIP")
+	assert.False(t, found)
+	assert.NotContains(t, obj.GetAnnotations(), AnnotationProtectedUntil)
+
+	headless := newRecord("", "v1", "services", "Service", "foo", "headless", "svc-uid")
+	require.NoError(t, unstructured.SetNestedField(headless.Object.Object, "None", "spec", "clusterIP"))
+	obj = (&Restorer{}).prepare(headless)
+	clusterIP, _, _ := unstructured.NestedString(obj.Object, "spec", "clusterIP")
+	assert.Equal(t, "None", clusterIP)
+}
+
+func TestPrepareDropsJanitorStamps(t *testing.T) {
+	record := newRecord("", "v1", "configmaps", "ConfigMap", "foo", "settings", "cm-uid")
+	record.Object.SetAnnotations(map[string]string{
+		"janitor/expires":            "next friday",
+		"janitor/expires-seen-at":    "2024-02-01T00:00:00Z",
+		"janitor/expires-seen-value": "next friday",
+		"janitor/scheduled-deletion": "2024-02-02T00:00:00Z",
+	})
+	record.Object.SetLabels(map[string]string{"app": "web", "janitor/marked-at": "1706745600"})
+
+	obj := (&Restorer{}).prepare(record)
+	assert.Equal(t, map[string]string{
+		"janitor/expires":      "next friday",
+		AnnotationRestoredFrom: "20240301T120000Z",
+	}, obj.GetAnnotations())
+	assert.Equal(t, map[string]string{"app": "web"}, obj.GetLabels())
+}
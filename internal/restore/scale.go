@@ -0,0 +1,82 @@
+package restore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/fieldmanager"
+	"github.com/blaxel-ai/kube-janitor-go/pkg/actions"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// AnnotationPreviousReplicas records the replica count of an object the
+// janitor scaled down
+const AnnotationPreviousReplicas = actions.AnnotationPreviousReplicas
+
+// ScaleUp restores the replica count of an object the janitor scaled down and
+// returns it. The object is protected for the grace period first, so that the
+// janitor does not scale it down again right away.
+func (r *Restorer) ScaleUp(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) (int64, error) {
+	client := r.resourceClient(gvr, namespace)
+	obj, err := client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get %s %s: %w", gvr.Resource, name, err)
+	}
+
+	value, ok := obj.GetAnnotations()[AnnotationPreviousReplicas]
+	if !ok {
+		return 0, fmt.Errorf("%s %s was not scaled down by the janitor", gvr.Resource, name)
+	}
+	replicas, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || replicas < 0 {
+		return 0, fmt.Errorf("invalid %s annotation '%s' on %s %s", AnnotationPreviousReplicas, value, gvr.Resource, name)
+	}
+	if r.DryRun {
+		return replicas, nil
+	}
+
+	patchOptions := metav1.PatchOptions{FieldManager: fieldmanager.Name}
+	if r.Grace > 0 {
+		if err := r.patchAnnotations(ctx, gvr, namespace, name, map[string]interface{}{
+			AnnotationProtectedUntil: time.Now().Add(r.Grace).UTC().Format(time.RFC3339),
+		}); err != nil {
+			return 0, err
+		}
+	}
+
+	scale, err := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"replicas": replicas}})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := client.Patch(ctx, name, types.MergePatchType, scale, patchOptions, "scale"); err != nil {
+		return 0, fmt.Errorf("failed to scale %s %s: %w", gvr.Resource, name, err)
+	}
+
+	// Only forgotten once scaled, so that a failed attempt can be retried
+	if err := r.patchAnnotations(ctx, gvr, namespace, name, map[string]interface{}{
+		AnnotationPreviousReplicas: nil,
+	}); err != nil {
+		return 0, err
+	}
+	return replicas, nil
+}
+
+func (r *Restorer) patchAnnotations(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string, annotations map[string]interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.resourceClient(gvr, namespace).Patch(ctx, name, types.MergePatchType, patch,
+		metav1.PatchOptions{FieldManager: fieldmanager.Name})
+	if err != nil {
+		return fmt.Errorf("failed to annotate %s %s: %w", gvr.Resource, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package restore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func TestScaleUp(t *testing.T) {
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+	tests := []struct {
+		name         string
+		annotations  map[string]string
+		dryRun       bool
+		wantReplicas int64
+		wantErr      string
+	}{
+		{
+			name:         "scaled down",
+			annotations:  map[string]string{AnnotationPreviousReplicas: "3"},
+			wantReplicas: 3,
+		},
+		{
+			name:         "dry run",
+			annotations:  map[string]string{AnnotationPreviousReplicas: "3"},
+			dryRun:       true,
+			wantReplicas: 3,
+		},
+		{
+			name:    "not scaled down",
+			wantErr: "deployments web was not scaled down by the janitor",
+		},
+		{
+			name:        "invalid annotation",
+			annotations: map[string]string{AnnotationPreviousReplicas: "three"},
+			wantErr:     "invalid janitor/previous-replicas annotation 'three'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deployment := &unstructured.Unstructured{}
+			deployment.SetAPIVersion("apps/v1")
+			deployment.SetKind("Deployment")
+			deployment.SetNamespace("foo")
+			deployment.SetName("web")
+			deployment.SetAnnotations(tt.annotations)
+
+			client := fake.NewSimpleDynamicClient(runtime.NewScheme(), deployment)
+			var scalePatch string
+			client.PrependReactor("patch", "deployments", func(action ktesting.Action) (bool, runtime.Object, error) {
+				if action.GetSubresource() != "scale" {
+					return false, nil, nil
+				}
+				scalePatch = string(action.(ktesting.PatchAction).GetPatch())
+				return true, deployment, nil
+			})
+
+			restorer := &Restorer{Client: client, Grace: time.Hour, DryRun: tt.dryRun}
+			replicas, err := restorer.ScaleUp(context.Background(), deployments, "foo", "web")
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantReplicas, replicas)
+
+			got, err := client.Resource(deployments).Namespace("foo").Get(context.Background(), "web", metav1.GetOptions{})
+			require.NoError(t, err)
+			if tt.dryRun {
+				assert.Empty(t, scalePatch)
+				assert.Equal(t, tt.annotations, got.GetAnnotations())
+				return
+			}
+			assert.JSONEq(t, `{"spec":{"replicas":3}}`, scalePatch)
+			assert.NotContains(t, got.GetAnnotations(), AnnotationPreviousReplicas)
+			assert.Contains(t, got.GetAnnotations(), AnnotationProtectedUntil)
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// builtinPolicy is a named rule for a common cleanup need. Its TTL is
+// measured from the status timestamp that tells when the object finished,
+// rather than from its creation.
+type builtinPolicy struct {
+	// ttl is the default TTL, used when the policy is enabled without one
+	ttl   string
+	rules []builtinRule
+}
+
+// builtinRule is one of the rules a policy expands to. The ID of each rule
+// after the first is suffixed with its suffix.
+type builtinRule struct {
+	suffix     string
+	resources  []string
+	expression string
+	ttlFrom    string
+}
+
+var builtinPolicies = map[string]builtinPolicy{
+	// Deleting a Job through the API orphans its Pods, so they are matched too
+	"completed-jobs": {
+		ttl: "1d",
+		rules: []builtinRule{
+			{
+				resources:  []string{"jobs"},
+				expression: `isCompleted(object)`,
+				ttlFrom:    "condition:Complete",
+			},
+			{
+				suffix:    "pods",
+				resources: []string{"pods"},
+				expression: `phase(object) == "Succeeded" && has(object.metadata.ownerReferences) &&
+					object.metadata.ownerReferences.exists(r, r.kind == "Job")`,
+				ttlFrom: "condition:Ready",
+			},
+		},
+	},
+	// Evicted Pods are failed Pods too
+	"failed-pods": {
+		ttl: "1d",
+		rules: []builtinRule{
+			{
+				resources:  []string{"pods"},
+				expression: `phase(object) == "Failed"`,
+				ttlFrom:    "condition:Ready",
+			},
+		},
+	},
+	// Deployments keep old ReplicaSets scaled to zero for rollbacks. The
+	// current one has the Deployment's revision and is left alone, as it is
+	// only scaled to zero with its Deployment.
+	"stale-replicasets": {
+		ttl: "7d",
+		rules: []builtinRule{
+			{
+				resources: []string{"replicasets"},
+				expression: `object.spec.replicas == 0 && object.status.replicas == 0 &&
+					has(object.metadata.ownerReferences) && object.metadata.ownerReferences.exists(r, r.kind == "Deployment") &&
+					hasAnnotation(object, "deployment.kubernetes.io/revision") &&
+					!(hasAnnotation(owner(object), "deployment.kubernetes.io/revision") &&
+						owner(object).metadata.annotations["deployment.kubernetes.io/revision"] ==
+							object.metadata.annotations["deployment.kubernetes.io/revision"])`,
+				ttlFrom: TimeFromLastUpdate,
+			},
+		},
+	},
+	// lastPhaseTransitionTime is only set from Kubernetes 1.29
+	"released-pvs": {
+		ttl: "7d",
+		rules: []builtinRule{
+			{
+				resources:  []string{"persistentvolumes"},
+				expression: `phase(object) == "Released"`,
+				ttlFrom:    "status:lastPhaseTransitionTime",
+			},
+		},
+	},
+}
+
+// BuiltinPolicies lists the names of the built-in policies
+func BuiltinPolicies() []string {
+	names := make([]string, 0, len(builtinPolicies))
+	for name := range builtinPolicies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseBuiltinPolicies turns a list of <name> or <name>=<ttl> entries, as
+// given on the command line, into rules enabling the built-in policies
+func ParseBuiltinPolicies(specs []string) ([]Rule, error) {
+	ruleSet := make([]Rule, 0, len(specs))
+	for _, spec := range specs {
+		name, ttl, _ := strings.Cut(strings.TrimSpace(spec), "=")
+		if _, ok := builtinPolicies[name]; !ok {
+			return nil, unknownBuiltinError(name)
+		}
+		ruleSet = append(ruleSet, Rule{ID: name, Builtin: name, TTL: ttl})
+	}
+	return ruleSet, nil
+}
+
+func unknownBuiltinError(name string) error {
+	return fmt.Errorf("unknown builtin policy '%s': must be one of %s", name, strings.Join(BuiltinPolicies(), ", "))
+}
+
+// ExpandBuiltins replaces the rules that enable a built-in policy by the
+// rules of the policy. Their ID defaults to the policy name, their TTL to the
+// policy's, and the other fields, such as selectors, apply to every rule of
+// the policy. The rules it returns no longer reference the policy, so
+// expanding them again leaves them unchanged.
+func ExpandBuiltins(ruleSet []Rule) ([]Rule, error) {
+	expanded := make([]Rule, 0, len(ruleSet))
+	for _, rule := range ruleSet {
+		if rule.Builtin == "" {
+			expanded = append(expanded, rule)
+			continue
+		}
+
+		policy, ok := builtinPolicies[rule.Builtin]
+		if !ok {
+			return nil, unknownBuiltinError(rule.Builtin)
+		}
+		if rule.ID == "" {
+			rule.ID = rule.Builtin
+		}
+		if len(rule.Resources) > 0 || rule.Expression != "" || rule.TTLExpression != "" {
+			return nil, fmt.Errorf("rule '%s' uses builtin policy '%s' and cannot set resources, expression or ttlExpression", rule.ID, rule.Builtin)
+		}
+		if rule.TTL == "" {
+			rule.TTL = policy.ttl
+		}
+
+		for _, part := range policy.rules {
+			partRule := rule
+			partRule.Builtin = ""
+			if part.suffix != "" {
+				partRule.ID += "-" + part.suffix
+			}
+			partRule.Resources = part.resources
+			partRule.Expression = part.expression
+			if partRule.TTLFrom == "" {
+				partRule.TTLFrom = part.ttlFrom
+			}
+			expanded = append(expanded, partRule)
+		}
+	}
+	return expanded, nil
+}
@@ -0,0 +1,219 @@
+package rules
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestBuiltinPolicies(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	finished := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	object := func(apiVersion, kind string, fields map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: fields}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetName("test")
+		obj.SetCreationTimestamp(metav1.NewTime(created))
+		return obj
+	}
+	condition := func(conditionType, status string) []interface{} {
+		return []interface{}{map[string]interface{}{
+			"type":               conditionType,
+			"status":             status,
+			"lastTransitionTime": finished.Format(time.RFC3339),
+		}}
+	}
+	ownedBy := func(obj *unstructured.Unstructured, kind string) *unstructured.Unstructured {
+		obj.Object["metadata"].(map[string]interface{})["ownerReferences"] = []interface{}{
+			map[string]interface{}{"kind": kind, "name": "owner", "controller": true},
+		}
+		return obj
+	}
+	revision := func(obj *unstructured.Unstructured, revision string) *unstructured.Unstructured {
+		obj.SetAnnotations(map[string]string{"deployment.kubernetes.io/revision": revision})
+		return obj
+	}
+	// The owner of every object is a Deployment at revision 2
+	lookup := func(_ string, ref metav1.OwnerReference) (*unstructured.Unstructured, error) {
+		return revision(object("apps/v1", ref.Kind, map[string]interface{}{}), "2"), nil
+	}
+
+	tests := []struct {
+		name      string
+		obj       *unstructured.Unstructured
+		wantRule  string
+		wantSince time.Time
+	}{
+		{
+			name:      "completed job",
+			obj:       object("batch/v1", "Job", map[string]interface{}{"status": map[string]interface{}{"conditions": condition("Complete", "True")}}),
+			wantRule:  "completed-jobs",
+			wantSince: finished,
+		},
+		{
+			name: "running job",
+			obj:  object("batch/v1", "Job", map[string]interface{}{"status": map[string]interface{}{}}),
+		},
+		{
+			name: "succeeded pod of a job",
+			obj: ownedBy(object("v1", "Pod", map[string]interface{}{"status": map[string]interface{}{
+				"phase":      "Succeeded",
+				"conditions": condition("Ready", "False"),
+			}}), "Job"),
+			wantRule:  "completed-jobs-pods",
+			wantSince: finished,
+		},
+		{
+			name: "succeeded pod without a job",
+			obj:  object("v1", "Pod", map[string]interface{}{"status": map[string]interface{}{"phase": "Succeeded"}}),
+		},
+		{
+			name: "evicted pod",
+			obj: object("v1", "Pod", map[string]interface{}{"status": map[string]interface{}{
+				"phase":      "Failed",
+				"reason":     "Evicted",
+				"conditions": condition("Ready", "False"),
+			}}),
+			wantRule:  "failed-pods",
+			wantSince: finished,
+		},
+		{
+			name: "running pod",
+			obj:  object("v1", "Pod", map[string]interface{}{"status": map[string]interface{}{"phase": "Running"}}),
+		},
+		{
+			name: "old replicaset",
+			obj: revision(ownedBy(object("apps/v1", "ReplicaSet", map[string]interface{}{
+				"spec":   map[string]interface{}{"replicas": int64(0)},
+				"status": map[string]interface{}{"replicas": int64(0)},
+			}), "Deployment"), "1"),
+			wantRule:  "stale-replicasets",
+			wantSince: created,
+		},
+		{
+			name: "current replicaset of a deployment scaled to zero",
+			obj: revision(ownedBy(object("apps/v1", "ReplicaSet", map[string]interface{}{
+				"spec":   map[string]interface{}{"replicas": int64(0)},
+				"status": map[string]interface{}{"replicas": int64(0)},
+			}), "Deployment"), "2"),
+		},
+		{
+			name: "active replicaset",
+			obj: ownedBy(object("apps/v1", "ReplicaSet", map[string]interface{}{
+				"spec":   map[string]interface{}{"replicas": int64(2)},
+				"status": map[string]interface{}{"replicas": int64(2)},
+			}), "Deployment"),
+		},
+		{
+			name: "released volume",
+			obj: object("v1", "PersistentVolume", map[string]interface{}{"status": map[string]interface{}{
+				"phase":                   "Released",
+				"lastPhaseTransitionTime": finished.Format(time.RFC3339),
+			}}),
+			wantRule:  "released-pvs",
+			wantSince: finished,
+		},
+		{
+			name: "bound volume",
+			obj:  object("v1", "PersistentVolume", map[string]interface{}{"status": map[string]interface{}{"phase": "Bound"}}),
+		},
+	}
+
+	ruleSet, err := ParseBuiltinPolicies(BuiltinPolicies())
+	require.NoError(t, err)
+	engine, err := New(ruleSet, WithOwnerLookup(lookup))
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := engine.Match(context.Background(), tt.obj)
+			require.NoError(t, err)
+			if tt.wantRule == "" {
+				assert.Nil(t, match)
+				return
+			}
+			require.NotNil(t, match)
+			assert.Equal(t, tt.wantRule, match.Rule.ID)
+			since := match.TimeSource.Resolve(tt.obj)
+			assert.True(t, tt.wantSince.Equal(since), "got %s, want %s", since, tt.wantSince)
+		})
+	}
+}
+
+func TestParseBuiltinPolicies(t *testing.T) {
+	ruleSet, err := ParseBuiltinPolicies([]string{"completed-jobs=2d", "failed-pods"})
+	require.NoError(t, err)
+	assert.Equal(t, []Rule{
+		{ID: "completed-jobs", Builtin: "completed-jobs", TTL: "2d"},
+		{ID: "failed-pods", Builtin: "failed-pods"},
+	}, ruleSet)
+
+	engine, err := New(ruleSet)
+	require.NoError(t, err)
+	ttls := map[string]string{}
+	for _, rule := range engine.rules {
+		ttls[rule.rule.ID] = rule.ttl.String()
+	}
+	assert.Equal(t, map[string]string{"completed-jobs": "2d", "completed-jobs-pods": "2d", "failed-pods": "1d"}, ttls)
+
+	expanded, err := ExpandBuiltins(ruleSet)
+	require.NoError(t, err)
+	again, err := ExpandBuiltins(expanded)
+	require.NoError(t, err)
+	assert.Equal(t, expanded, again)
+
+	_, err = ParseBuiltinPolicies([]string{"old-pods=1d"})
+	assert.EqualError(t, err, "unknown builtin policy 'old-pods': must be one of completed-jobs, failed-pods, released-pvs, stale-replicasets")
+}
+
+func TestBuiltinRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr string
+	}{
+		{
+			name: "selectors apply to every rule of the policy",
+			rule: Rule{ID: "ci-jobs", Builtin: "completed-jobs", Namespaces: []string{"ci"}, Schedule: "* 0-5 * * *"},
+		},
+		{
+			name:    "unknown policy",
+			rule:    Rule{Builtin: "old-pods"},
+			wantErr: "unknown builtin policy 'old-pods'",
+		},
+		{
+			name:    "expression",
+			rule:    Rule{Builtin: "failed-pods", Expression: "true"},
+			wantErr: "rule 'failed-pods' uses builtin policy 'failed-pods' and cannot set resources, expression or ttlExpression",
+		},
+		{
+			name:    "invalid ttl",
+			rule:    Rule{Builtin: "failed-pods", TTL: "soon"},
+			wantErr: "invalid TTL 'soon' in rule 'failed-pods'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := New([]Rule{tt.rule})
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, engine.rules, 2)
+			for _, rule := range engine.rules {
+				assert.Equal(t, []string{"ci"}, rule.rule.Namespaces)
+				assert.NotNil(t, rule.window)
+			}
+			assert.Equal(t, "ci-jobs-pods", engine.rules[1].rule.ID)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter"
+)
+
+const (
+	// DefaultCostLimit is the default cost an evaluation may reach before it is
+	// aborted. A pass over a map or list costs a few units per entry.
+	DefaultCostLimit uint64 = 1000000
+	// DefaultEvalTimeout is the default time an evaluation may take
+	DefaultEvalTimeout = 100 * time.Millisecond
+
+	// estimatedCostFactor is how much higher than the cost limit the worst-case
+	// estimated cost of an expression may be. Estimates assume every map and
+	// list is as large as an object can be, so a single pass over object.data
+	// is accepted but nested ones are not.
+	estimatedCostFactor = 100
+	// maxObjectSize bounds the size of anything in an object, as objects are
+	// limited by the default etcd request size
+	maxObjectSize = 1536 * 1024
+	// interruptCheckFrequency is how many comprehension iterations run between
+	// checks of the evaluation's context. The count is shared by nested
+	// comprehensions and the outer one only stops when its own iteration is
+	// checked, so anything but every iteration lets it run much longer.
+	interruptCheckFrequency = 1
+)
+
+// WithCostLimit aborts evaluations whose cost exceeds limit, and rejects rules
+// whose worst-case estimated cost exceeds it by far. Zero disables both.
+func WithCostLimit(limit uint64) Option {
+	return func(e *Engine) {
+		e.costLimit = limit
+	}
+}
+
+// WithEvalTimeout aborts evaluations that take longer than timeout. Zero only
+// stops them when the context passed to Match is done.
+func WithEvalTimeout(timeout time.Duration) Option {
+	return func(e *Engine) {
+		e.evalTimeout = timeout
+	}
+}
+
+// objectSizeEstimator bounds the size of every value by maxObjectSize, as
+// rules have no schema telling how large the fields of objects are
+type objectSizeEstimator struct{}
+
+func (objectSizeEstimator) EstimateSize(checker.AstNode) *checker.SizeEstimate {
+	return &checker.SizeEstimate{Min: 0, Max: maxObjectSize}
+}
+
+func (objectSizeEstimator) EstimateCallCost(string, string, *checker.AstNode, []checker.AstNode) *checker.CallEstimate {
+	return nil
+}
+
+// checkCost rejects expressions whose worst-case estimated cost exceeds
+// estimatedCostFactor times the cost limit
+func (e *Engine) checkCost(env *cel.Env, ast *cel.Ast) error {
+	if e.costLimit == 0 {
+		return nil
+	}
+
+	estimate, err := env.EstimateCost(ast, objectSizeEstimator{})
+	if err != nil {
+		return fmt.Errorf("failed to estimate cost: %w", err)
+	}
+	if limit := e.costLimit * estimatedCostFactor; estimate.Max > limit {
+		return fmt.Errorf("worst-case estimated cost %d exceeds the limit of %d", estimate.Max, limit)
+	}
+	return nil
+}
+
+// program creates the program of an expression with the engine's cost limit
+func (e *Engine) program(env *cel.Env, ast *cel.Ast) (cel.Program, error) {
+	opts := []cel.ProgramOption{cel.InterruptCheckFrequency(interruptCheckFrequency)}
+	if e.costLimit > 0 {
+		opts = append(opts, cel.CostLimit(e.costLimit))
+	}
+	return env.Program(ast, opts...)
+}
+
+// eval runs a program until it completes, exceeds the cost limit or times out
+func (e *Engine) eval(ctx context.Context, program cel.Program, input map[string]interface{}) (ref.Val, error) {
+	if e.evalTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.evalTimeout)
+		defer cancel()
+	}
+
+	out, _, err := program.ContextEval(ctx, input)
+	if err != nil && ctx.Err() != nil {
+		return nil, fmt.Errorf("%w: %w", errInterrupted, ctx.Err())
+	}
+	var cancelled interpreter.EvalCancelledError
+	if errors.As(err, &cancelled) {
+		return nil, fmt.Errorf("%w: %w", errInterrupted, err)
+	}
+	return out, err
+}
@@ -0,0 +1,128 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestEstimatedCost(t *testing.T) {
+	nested := `object.data.exists(k, object.data.exists(k2, k2 != k && object.data[k2] == object.data[k]))`
+
+	tests := []struct {
+		name     string
+		rule     Rule
+		opts     []Option
+		errorMsg string
+	}{
+		{
+			name: "field access",
+			rule: Rule{Expression: `object.metadata.name.startsWith("pr-")`},
+		},
+		{
+			name: "single pass over a map",
+			rule: Rule{Expression: `object.data.all(k, object.data[k].size() < 1024)`},
+		},
+		{
+			name:     "nested passes",
+			rule:     Rule{Expression: nested},
+			errorMsg: "expression for rule 'test-rule' is too expensive: worst-case estimated cost",
+		},
+		{
+			name:     "nested passes in ttlExpression",
+			rule:     Rule{Expression: "true", TTLExpression: nested + ` ? "1h" : "1d"`},
+			errorMsg: "invalid ttlExpression in rule 'test-rule': too expensive",
+		},
+		{
+			name: "no cost limit",
+			rule: Rule{Expression: nested},
+			opts: []Option{WithCostLimit(0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			rule.ID, rule.Resources, rule.TTL = "test-rule", []string{"configmaps"}, "1h"
+
+			_, err := New([]Rule{rule}, tt.opts...)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestEvaluationLimits(t *testing.T) {
+	configMap := func(entries int) *unstructured.Unstructured {
+		data := make(map[string]interface{}, entries)
+		for i := 0; i < entries; i++ {
+			data[fmt.Sprintf("key-%d", i)] = "value"
+		}
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"data":       data,
+		}}
+	}
+	rule := func(expression string) []Rule {
+		return []Rule{{ID: "test-rule", Resources: []string{"configmaps"}, Expression: expression, TTL: "1h"}}
+	}
+	nested := `object.data.all(k, object.data.all(k2, object.data[k2] == object.data[k]))`
+
+	t.Run("within the cost limit", func(t *testing.T) {
+		engine, err := New(rule(`object.data.all(k, object.data[k] == "value")`), WithCostLimit(200000))
+		require.NoError(t, err)
+
+		traces := engine.Trace(context.Background(), configMap(100))
+		require.NoError(t, traces[0].Err)
+		assert.True(t, traces[0].Matched)
+	})
+
+	t.Run("cost limit exceeded", func(t *testing.T) {
+		// String functions cost a fraction of the string's size
+		engine, err := New(rule(`object.data.blob.contains("needle")`), WithCostLimit(100000), WithEvalTimeout(0))
+		require.NoError(t, err)
+
+		obj := configMap(0)
+		obj.Object["data"] = map[string]interface{}{"blob": strings.Repeat("x", 4*1024*1024)}
+		traces := engine.Trace(context.Background(), obj)
+		require.Error(t, traces[0].Err)
+		assert.Contains(t, traces[0].Err.Error(), "cost limit exceeded")
+		assert.False(t, traces[0].Matched)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		engine, err := New(rule(nested), WithCostLimit(0), WithEvalTimeout(10*time.Millisecond))
+		require.NoError(t, err)
+
+		start := time.Now()
+		traces := engine.Trace(context.Background(), configMap(5000))
+		assert.Less(t, time.Since(start), time.Second)
+		require.Error(t, traces[0].Err)
+		assert.ErrorIs(t, traces[0].Err, context.DeadlineExceeded)
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		engine, err := New(rule(nested), WithCostLimit(0), WithEvalTimeout(0))
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		match, err := engine.Match(ctx, configMap(5000))
+		assert.Nil(t, match)
+		assert.ErrorIs(t, err, context.Canceled)
+		traces := engine.Trace(ctx, configMap(5000))
+		require.Error(t, traces[0].Err)
+		assert.ErrorIs(t, traces[0].Err, context.Canceled)
+	})
+}
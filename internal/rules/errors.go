@@ -0,0 +1,121 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Policies for objects a rule fails to evaluate
+const (
+	// OnErrorSkip treats the object as not matched, so the next rules decide
+	OnErrorSkip = "skip"
+	// OnErrorMatch treats the object as matched, with the rule's ttl
+	OnErrorMatch = "match"
+	// OnErrorFail stops the evaluation of the object, which no rule matches
+	// until the rule evaluates again
+	OnErrorFail = "fail"
+)
+
+var (
+	// errInterrupted marks evaluations aborted by the cost limit or the
+	// timeout, which say nothing about the object
+	errInterrupted = errors.New("evaluation interrupted")
+	// errSelector marks selectors that could not be checked, such as a
+	// namespaceSelector whose namespace labels are not available
+	errSelector = errors.New("failed to check selectors")
+)
+
+// matchesOnError reports whether the onError match policy applies to an
+// error: only errors of the expression itself make the rule match, others
+// are skipped
+func matchesOnError(err error) bool {
+	return !errors.Is(err, errInterrupted) && !errors.Is(err, errSelector)
+}
+
+// ErrorDecides reports whether the trace failed in a way that its rule's
+// onError policy turns into the outcome for the object, rather than skipping
+// to the next rules
+func (t RuleTrace) ErrorDecides() bool {
+	if t.Err == nil {
+		return false
+	}
+	switch t.Rule.OnError {
+	case OnErrorFail:
+		return true
+	case OnErrorMatch:
+		return matchesOnError(t.Err)
+	default:
+		return false
+	}
+}
+
+// errorLogInterval is how often each rule may log an evaluation error as a
+// warning. The errors in between are logged at debug level and counted.
+const errorLogInterval = time.Minute
+
+func validateOnError(policy string) error {
+	switch policy {
+	case "", OnErrorSkip, OnErrorMatch, OnErrorFail:
+		return nil
+	default:
+		return fmt.Errorf("must be one of %s, %s, %s", OnErrorSkip, OnErrorMatch, OnErrorFail)
+	}
+}
+
+// EvaluationError is returned by Match when a rule whose onError policy is
+// fail cannot be evaluated
+type EvaluationError struct {
+	Rule *Rule
+	Err  error
+}
+
+func (e *EvaluationError) Error() string {
+	return fmt.Sprintf("rule '%s' failed to evaluate: %v", e.Rule.ID, e.Err)
+}
+
+func (e *EvaluationError) Unwrap() error {
+	return e.Err
+}
+
+// logErrors logs the errors of a trace, as a warning at most once per
+// errorLogInterval and rule, so that broken rules do not flood the logs
+func (e *Engine) logErrors(trace RuleTrace, obj *unstructured.Unstructured) {
+	if trace.Err == nil && trace.TTLErr == nil {
+		return
+	}
+
+	logger := logrus.WithFields(logrus.Fields{
+		"rule":       trace.Rule.ID,
+		"apiVersion": obj.GetAPIVersion(),
+		"kind":       obj.GetKind(),
+		"namespace":  obj.GetNamespace(),
+		"name":       obj.GetName(),
+	})
+	level := logrus.DebugLevel
+	if suppressed, ok := e.stats.counters(trace.Rule.ID).sampleError(e.now()); ok {
+		level = logrus.WarnLevel
+		logger = logger.WithField("suppressed", suppressed)
+	}
+
+	if trace.Err != nil {
+		logger.WithError(trace.Err).WithField("onError", trace.Rule.OnError).Log(level, "Failed to evaluate rule expression")
+	}
+	if trace.TTLErr != nil {
+		logger.WithError(trace.TTLErr).Log(level, "Failed to evaluate rule ttlExpression, using its ttl")
+	}
+}
+
+// sampleError reports whether an error at now may be logged as a warning,
+// along with the number of errors that were not since the last warning
+func (c *ruleCounters) sampleError(now time.Time) (int64, bool) {
+	last := c.lastWarning.Load()
+	if now.UnixNano()-last < int64(errorLogInterval) || !c.lastWarning.CompareAndSwap(last, now.UnixNano()) {
+		c.suppressed.Add(1)
+		return 0, false
+	}
+	return c.suppressed.Swap(0), true
+}
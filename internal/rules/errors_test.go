@@ -0,0 +1,197 @@
+package rules
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestOnError(t *testing.T) {
+	pod := &unstructured.Unstructured{}
+	pod.SetAPIVersion("v1")
+	pod.SetKind("Pod")
+	pod.SetNamespace("default")
+	pod.SetName("web")
+
+	tests := []struct {
+		name     string
+		onError  string
+		wantRule string
+		wantTTL  string
+		wantErr  string
+	}{
+		{
+			name:     "default skips to the next rule",
+			wantRule: "fallback",
+			wantTTL:  "3h",
+		},
+		{
+			name:     "skip",
+			onError:  OnErrorSkip,
+			wantRule: "fallback",
+			wantTTL:  "3h",
+		},
+		{
+			name:     "match",
+			onError:  OnErrorMatch,
+			wantRule: "broken",
+			wantTTL:  "1h",
+		},
+		{
+			name:    "fail",
+			onError: OnErrorFail,
+			wantErr: "rule 'broken' failed to evaluate: no such key: spec",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := New([]Rule{
+				{ID: "broken", Resources: []string{"pods"}, Expression: `object.spec.nodeName == "a"`, TTL: "1h", OnError: tt.onError},
+				{ID: "fallback", Resources: []string{"pods"}, Expression: "true", TTL: "3h"},
+			})
+			require.NoError(t, err)
+
+			match, err := engine.Match(context.Background(), pod)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tt.wantErr, err.Error())
+				var evalErr *EvaluationError
+				require.ErrorAs(t, err, &evalErr)
+				assert.Equal(t, "broken", evalErr.Rule.ID)
+				assert.Nil(t, match)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, match)
+			assert.Equal(t, tt.wantRule, match.Rule.ID)
+			assert.Equal(t, tt.wantTTL, match.TTL.String())
+		})
+	}
+}
+
+func TestOnErrorMatchOnlyForExpressionErrors(t *testing.T) {
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "blob", "namespace": "default"},
+		"data":       map[string]interface{}{"blob": strings.Repeat("x", 4*1024*1024)},
+	}}
+	fallback := Rule{ID: "fallback", Resources: []string{"configmaps"}, Expression: "true", TTL: "3h"}
+
+	tests := []struct {
+		name     string
+		rule     Rule
+		wantRule string
+		wantErr  bool
+	}{
+		{
+			name: "selector error is skipped",
+			rule: Rule{
+				ID: "selected", Resources: []string{"configmaps"}, Expression: "true", TTL: "1h", OnError: OnErrorMatch,
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "dev"}},
+			},
+			wantRule: "fallback",
+		},
+		{
+			name: "cost limit is skipped",
+			rule: Rule{
+				ID: "expensive", Resources: []string{"configmaps"}, Expression: `object.data.blob.contains("needle")`,
+				TTL: "1h", OnError: OnErrorMatch,
+			},
+			wantRule: "fallback",
+		},
+		{
+			name: "selector error still fails",
+			rule: Rule{
+				ID: "selected", Resources: []string{"configmaps"}, Expression: "true", TTL: "1h", OnError: OnErrorFail,
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "dev"}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := New([]Rule{tt.rule, fallback}, WithCostLimit(100000), WithEvalTimeout(0))
+			require.NoError(t, err)
+
+			match, err := engine.Match(context.Background(), configMap)
+			if tt.wantErr {
+				var evalErr *EvaluationError
+				assert.ErrorAs(t, err, &evalErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, match)
+			assert.Equal(t, tt.wantRule, match.Rule.ID)
+		})
+	}
+}
+
+func TestInvalidOnError(t *testing.T) {
+	_, err := New([]Rule{{ID: "r", Resources: []string{"pods"}, Expression: "true", TTL: "1h", OnError: "ignore"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid onError 'ignore' in rule 'r': must be one of skip, match, fail")
+}
+
+func TestErrorLogSampling(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	std := logrus.StandardLogger()
+	out, level, hooks := std.Out, std.Level, std.Hooks
+	std.SetOutput(logger.Out)
+	std.SetLevel(logrus.DebugLevel)
+	std.ReplaceHooks(logrus.LevelHooks{})
+	std.AddHook(hook)
+	defer func() {
+		std.SetOutput(out)
+		std.SetLevel(level)
+		std.ReplaceHooks(hooks)
+	}()
+
+	engine, err := New([]Rule{
+		{ID: "broken", Resources: []string{"pods"}, Expression: `object.spec.nodeName == "a"`, TTL: "1h"},
+	})
+	require.NoError(t, err)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	engine.now = func() time.Time { return now }
+
+	pod := &unstructured.Unstructured{}
+	pod.SetAPIVersion("v1")
+	pod.SetKind("Pod")
+	pod.SetNamespace("default")
+	pod.SetName("web")
+
+	var levels []logrus.Level
+	evaluate := func() {
+		hook.Reset()
+		_, err := engine.Match(context.Background(), pod)
+		require.NoError(t, err)
+		require.Len(t, hook.AllEntries(), 1)
+		levels = append(levels, hook.LastEntry().Level)
+	}
+
+	evaluate()
+	entry := hook.LastEntry()
+	assert.Equal(t, "broken", entry.Data["rule"])
+	assert.Equal(t, "Pod", entry.Data["kind"])
+	assert.Equal(t, "default", entry.Data["namespace"])
+	assert.Equal(t, "web", entry.Data["name"])
+	assert.Equal(t, OnErrorSkip, entry.Data["onError"])
+
+	evaluate()
+	evaluate()
+	now = now.Add(errorLogInterval)
+	evaluate()
+	assert.Equal(t, []logrus.Level{logrus.WarnLevel, logrus.DebugLevel, logrus.DebugLevel, logrus.WarnLevel}, levels)
+	assert.Equal(t, int64(2), hook.LastEntry().Data["suppressed"])
+}
@@ -0,0 +1,132 @@
+package rules
+
+import (
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// OwnerLookup fetches the owner an owner reference points to, for the
+// owner() helper. It returns nil if the owner no longer exists.
+type OwnerLookup func(namespace string, ref metav1.OwnerReference) (*unstructured.Unstructured, error)
+
+// WithOwnerLookup sets how the engine fetches owners. owner() fails without it.
+func WithOwnerLookup(lookup OwnerLookup) Option {
+	return func(e *Engine) {
+		e.ownerLookup = lookup
+	}
+}
+
+// functions are the helpers rules can call on object, so that common checks
+// do not need has() guards on every level:
+//
+//	hasLabel(object, key)      whether the object has the label
+//	hasAnnotation(object, key) whether the object has the annotation
+//	ageOf(object)              time since the object was created
+//	isCompleted(object)        whether a Job has a true Complete condition
+//	phase(object)              status.phase of a Pod, or "" if it has none
+//	owner(object)              the controller owner, or {} if it has none or it is gone
+func (e *Engine) functions() []cel.EnvOption {
+	return []cel.EnvOption{
+		cel.Function("hasLabel",
+			cel.Overload("hasLabel_dyn_string", []*cel.Type{cel.DynType, cel.StringType}, cel.BoolType,
+				cel.BinaryBinding(func(obj, key ref.Val) ref.Val {
+					return hasKey("hasLabel", obj, key, "labels")
+				}))),
+		cel.Function("hasAnnotation",
+			cel.Overload("hasAnnotation_dyn_string", []*cel.Type{cel.DynType, cel.StringType}, cel.BoolType,
+				cel.BinaryBinding(func(obj, key ref.Val) ref.Val {
+					return hasKey("hasAnnotation", obj, key, "annotations")
+				}))),
+		cel.Function("ageOf",
+			cel.Overload("ageOf_dyn", []*cel.Type{cel.DynType}, cel.DurationType,
+				cel.UnaryBinding(func(val ref.Val) ref.Val {
+					obj, errVal := objectArg("ageOf", val)
+					if errVal != nil {
+						return errVal
+					}
+					created, _, _ := unstructured.NestedString(obj, "metadata", "creationTimestamp")
+					createdAt, err := time.Parse(time.RFC3339, created)
+					if err != nil {
+						return types.NewErr("ageOf: object has no valid creationTimestamp")
+					}
+					return types.Duration{Duration: e.now().Sub(createdAt)}
+				}))),
+		cel.Function("isCompleted",
+			cel.Overload("isCompleted_dyn", []*cel.Type{cel.DynType}, cel.BoolType,
+				cel.UnaryBinding(func(val ref.Val) ref.Val {
+					obj, errVal := objectArg("isCompleted", val)
+					if errVal != nil {
+						return errVal
+					}
+					conditions, _, _ := unstructured.NestedSlice(obj, "status", "conditions")
+					for _, c := range conditions {
+						condition, _ := c.(map[string]interface{})
+						if condition["type"] == "Complete" && condition["status"] == "True" {
+							return types.True
+						}
+					}
+					return types.False
+				}))),
+		cel.Function("phase",
+			cel.Overload("phase_dyn", []*cel.Type{cel.DynType}, cel.StringType,
+				cel.UnaryBinding(func(val ref.Val) ref.Val {
+					obj, errVal := objectArg("phase", val)
+					if errVal != nil {
+						return errVal
+					}
+					phase, _, _ := unstructured.NestedString(obj, "status", "phase")
+					return types.String(phase)
+				}))),
+		// owner fetches the owner from the API server on every call, so
+		// rules should only call it once cheaper checks passed
+		cel.Function("owner",
+			cel.Overload("owner_dyn", []*cel.Type{cel.DynType}, cel.MapType(cel.StringType, cel.DynType),
+				cel.UnaryBinding(func(val ref.Val) ref.Val {
+					obj, errVal := objectArg("owner", val)
+					if errVal != nil {
+						return errVal
+					}
+					if e.ownerLookup == nil {
+						return types.NewErr("owner: owners cannot be looked up")
+					}
+					controllee := &unstructured.Unstructured{Object: obj}
+					ownerRef := metav1.GetControllerOfNoCopy(controllee)
+					if ownerRef == nil {
+						return types.DefaultTypeAdapter.NativeToValue(map[string]interface{}{})
+					}
+					owner, err := e.ownerLookup(controllee.GetNamespace(), *ownerRef)
+					if err != nil {
+						return types.NewErr("owner: %s", err)
+					}
+					if owner == nil {
+						return types.DefaultTypeAdapter.NativeToValue(map[string]interface{}{})
+					}
+					return types.DefaultTypeAdapter.NativeToValue(owner.Object)
+				}))),
+	}
+}
+
+// objectArg returns the object a helper was called with
+func objectArg(function string, val ref.Val) (map[string]interface{}, ref.Val) {
+	obj, ok := val.Value().(map[string]interface{})
+	if !ok {
+		return nil, types.NewErr("%s: expected an object, got %s", function, val.Type().TypeName())
+	}
+	return obj, nil
+}
+
+// hasKey reports whether the labels or annotations of an object have a key
+func hasKey(function string, val, key ref.Val, field string) ref.Val {
+	obj, errVal := objectArg(function, val)
+	if errVal != nil {
+		return errVal
+	}
+	values, _, _ := unstructured.NestedMap(obj, "metadata", field)
+	_, ok := values[string(key.(types.String))]
+	return types.Bool(ok)
+}
@@ -0,0 +1,115 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestFunctions(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	job := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata": map[string]interface{}{
+			"name":              "migrate",
+			"creationTimestamp": "2024-01-15T09:00:00Z",
+			"labels":            map[string]interface{}{"app": "api"},
+			"annotations":       map[string]interface{}{"example.com/owner": "team-a"},
+		},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "SuccessCriteriaMet", "status": "True"},
+				map[string]interface{}{"type": "Complete", "status": "True"},
+			},
+		},
+	}}
+	failedJob := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Failed", "status": "True"},
+			},
+		},
+	}}
+	pod := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]interface{}{"name": "web"},
+		"status":     map[string]interface{}{"phase": "Succeeded"},
+	}}
+	ownedBy := func(owner string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("apps/v1")
+		obj.SetKind("ReplicaSet")
+		obj.SetNamespace("default")
+		controller := true
+		obj.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: owner, Controller: &controller}})
+		return obj
+	}
+	lookup := func(namespace string, ref metav1.OwnerReference) (*unstructured.Unstructured, error) {
+		switch ref.Name {
+		case "gone":
+			return nil, nil
+		case "broken":
+			return nil, errors.New("connection refused")
+		}
+		owner := &unstructured.Unstructured{}
+		owner.SetKind(ref.Kind)
+		owner.SetNamespace(namespace)
+		owner.SetName(ref.Name)
+		return owner, nil
+	}
+
+	tests := []struct {
+		name       string
+		expression string
+		obj        *unstructured.Unstructured
+		want       bool
+		wantErr    string
+	}{
+		{name: "hasLabel", expression: `hasLabel(object, "app")`, obj: job, want: true},
+		{name: "hasLabel missing", expression: `hasLabel(object, "team")`, obj: job},
+		{name: "hasLabel without labels", expression: `hasLabel(object, "app")`, obj: pod},
+		{name: "hasAnnotation", expression: `hasAnnotation(object, "example.com/owner")`, obj: job, want: true},
+		{name: "hasAnnotation without metadata", expression: `hasAnnotation(object, "example.com/owner")`, obj: failedJob},
+		{name: "ageOf", expression: `ageOf(object) == duration("3h")`, obj: job, want: true},
+		{name: "ageOf without creationTimestamp", expression: `ageOf(object) > duration("1h")`, obj: pod, wantErr: "ageOf: object has no valid creationTimestamp"},
+		{name: "isCompleted", expression: `isCompleted(object)`, obj: job, want: true},
+		{name: "isCompleted failed", expression: `isCompleted(object)`, obj: failedJob},
+		{name: "isCompleted without status", expression: `isCompleted(object)`, obj: pod},
+		{name: "phase", expression: `phase(object) == "Succeeded"`, obj: pod, want: true},
+		{name: "phase without status", expression: `phase(object) == ""`, obj: &unstructured.Unstructured{Object: map[string]interface{}{"kind": "Pod"}}, want: true},
+		{name: "owner", expression: `owner(object).metadata.name == "web" && owner(object).kind == "Deployment"`, obj: ownedBy("web"), want: true},
+		{name: "owner without owner references", expression: `owner(object) == {}`, obj: pod, want: true},
+		{name: "owner that is gone", expression: `owner(object) == {}`, obj: ownedBy("gone"), want: true},
+		{name: "owner lookup failure", expression: `owner(object) == {}`, obj: ownedBy("broken"), wantErr: "owner: connection refused"},
+		{name: "not an object", expression: `hasLabel({"a": "b"}, "a")`, obj: pod, wantErr: "hasLabel: expected an object"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := New([]Rule{{ID: "test-rule", Resources: []string{"*"}, Expression: tt.expression, TTL: "1h"}},
+				WithOwnerLookup(lookup))
+			require.NoError(t, err)
+			engine.now = func() time.Time { return now }
+
+			traces := engine.Trace(context.Background(), tt.obj)
+			if tt.wantErr != "" {
+				require.Error(t, traces[0].Err)
+				assert.Contains(t, traces[0].Err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, traces[0].Err)
+			assert.Equal(t, tt.want, traces[0].Matched)
+		})
+	}
+}
@@ -1,25 +1,55 @@
 package rules
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"regexp"
-	"strconv"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/blaxel-ai/kube-janitor-go/internal/window"
+	"github.com/blaxel-ai/kube-janitor-go/pkg/actions"
+	"github.com/blaxel-ai/kube-janitor-go/pkg/duration"
 	"github.com/google/cel-go/cel"
-	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/structpb"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/yaml"
 )
 
 // Rule represents a cleanup rule
 type Rule struct {
-	ID         string   `yaml:"id"`
-	Resources  []string `yaml:"resources"`
-	Expression string   `yaml:"expression"`
-	TTL        string   `yaml:"ttl"`
+	ID            string   `yaml:"id"`
+	Resources     []string `yaml:"resources"`
+	Expression    string   `yaml:"expression"`
+	TTL           string   `yaml:"ttl"`
+	TTLExpression string   `yaml:"ttlExpression,omitempty"`
+	MaxExtension  string   `yaml:"maxExtension,omitempty"`
+	TTLFrom       string   `yaml:"ttlFrom,omitempty"`
+	Schedule      string   `yaml:"schedule,omitempty"`
+	// OnError is one of the OnError* policies (default skip)
+	OnError string `yaml:"onError,omitempty"`
+	// Action names the action taken on expired objects (default delete), and
+	// ActionParams configure it
+	Action       string            `yaml:"action,omitempty"`
+	ActionParams map[string]string `yaml:"actionParams,omitempty"`
+	// Builtin names a built-in policy, which provides the resources,
+	// expression, ttlFrom and default ttl of the rule
+	Builtin string `yaml:"builtin,omitempty"`
+
+	// Selectors are checked before the expression, which only runs for the
+	// objects they select
+	Namespaces        []string              `yaml:"namespaces,omitempty"`
+	ExcludeNamespaces []string              `yaml:"excludeNamespaces,omitempty"`
+	LabelSelector     *metav1.LabelSelector `yaml:"labelSelector,omitempty"`
+	NamespaceSelector *metav1.LabelSelector `yaml:"namespaceSelector,omitempty"`
+
+	// Namespace restricts the rule to objects in this namespace. It is set for
+	// rules defined by namespaced JanitorRule resources, whose ID is then
+	// prefixed with "<namespace>/".
+	Namespace string `yaml:"-"`
 }
 
 // File represents a collection of rules from a YAML file
@@ -30,18 +60,79 @@ type File struct {
 // Engine is the rules evaluation engine
 type Engine struct {
 	rules []compiledRule
+	// location is used for timestamps without a zone
+	location *time.Location
+	// namespaceLabels looks up namespaces for namespace selectors
+	namespaceLabels NamespaceLabels
+	// ownerLookup fetches owners for owner()
+	ownerLookup OwnerLookup
+	stats       *Stats
+	// costLimit and evalTimeout bound each evaluation (zero means no bound)
+	costLimit   uint64
+	evalTimeout time.Duration
+	// schemas, when set, are used to check the field paths of rules
+	schemas *Schemas
+	// now is the clock of ageOf
+	now func() time.Time
+}
+
+// Option configures an Engine
+type Option func(*Engine)
+
+// WithDefaultTimezone interprets timestamps without a zone, such as those read
+// by annotation: and status: time sources, in the given location instead of UTC
+func WithDefaultTimezone(location *time.Location) Option {
+	return func(e *Engine) {
+		e.location = location
+	}
 }
 
 type compiledRule struct {
-	rule        Rule
-	program     cel.Program
-	ttlDuration time.Duration
+	rule         Rule
+	selector     *selector
+	program      cel.Program
+	ttlProgram   cel.Program
+	ttl          duration.Duration
+	maxExtension duration.Duration
+	timeSource   TimeSource
+	window       *window.Window
+	action       actions.Action
+}
+
+// Match is the result of a rule matching an object
+type Match struct {
+	Rule *Rule
+	TTL  duration.Duration
+	// Expires is set instead of TTL when the rule's ttlExpression returned a timestamp
+	Expires time.Time
+	// MaxExtension caps how far snooze annotations may push back the deletion (zero means no cap)
+	MaxExtension duration.Duration
+	// TimeSource is the point in time the TTL is measured from
+	TimeSource TimeSource
+	// Window restricts when matched objects may be deleted (nil means any time)
+	Window *window.Window
+	// Action is taken on matched objects once they expire
+	Action actions.Action
 }
 
 var idRegex = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
 
+// namespacedRuleActions are the actions namespaced rule resources may take.
+// The others could reach outside the namespace, such as a webhook, or change
+// objects in arbitrary ways, such as a patch.
+var namespacedRuleActions = []string{actions.Delete, actions.ScaleDown, actions.Suspend}
+
 // LoadFromFile loads rules from a YAML file
-func LoadFromFile(path string) (*Engine, error) {
+func LoadFromFile(path string, opts ...Option) (*Engine, error) {
+	rules, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(rules, opts...)
+}
+
+// ReadFile reads the rules from a YAML file without compiling them
+func ReadFile(path string) ([]Rule, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read rules file: %w", err)
@@ -51,71 +142,290 @@ func LoadFromFile(path string) (*Engine, error) {
 	if err := yaml.Unmarshal(data, &rulesFile); err != nil {
 		return nil, fmt.Errorf("failed to parse rules file: %w", err)
 	}
-
-	return New(rulesFile.Rules)
+	return rulesFile.Rules, nil
 }
 
 // New creates a new rules engine
-func New(rules []Rule) (*Engine, error) {
-	env, err := cel.NewEnv(
+func New(rules []Rule, opts ...Option) (*Engine, error) {
+	engine := &Engine{
+		rules:       make([]compiledRule, 0, len(rules)),
+		costLimit:   DefaultCostLimit,
+		evalTimeout: DefaultEvalTimeout,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(engine)
+	}
+	if engine.stats == nil {
+		engine.stats = NewStats()
+	}
+
+	env, err := cel.NewEnv(append([]cel.EnvOption{
 		cel.Variable("object", cel.MapType(cel.StringType, cel.DynType)),
 		cel.Variable("_context", cel.MapType(cel.StringType, cel.DynType)),
-	)
+	}, engine.functions()...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create CEL environment: %w", err)
 	}
 
-	engine := &Engine{
-		rules: make([]compiledRule, 0, len(rules)),
+	rules, err = ExpandBuiltins(rules)
+	if err != nil {
+		return nil, err
 	}
 
+	ids := make(map[string]bool, len(rules))
 	for _, rule := range rules {
-		// Validate rule ID
-		if !idRegex.MatchString(rule.ID) {
+		// Validate rule ID. The IDs of namespaced rules are prefixed with
+		// their namespace.
+		id := rule.ID
+		if rule.Namespace != "" {
+			id = strings.TrimPrefix(id, rule.Namespace+"/")
+		}
+		if !idRegex.MatchString(id) {
 			return nil, fmt.Errorf("invalid rule ID '%s': must be lowercase and match ^[a-z][a-z0-9-]*$", rule.ID)
 		}
+		if ids[rule.ID] {
+			return nil, fmt.Errorf("duplicate rule ID '%s'", rule.ID)
+		}
+		ids[rule.ID] = true
+
+		// Wildcards are handled by the selector, which skips the denied kinds
+		if denied := deniedResource(rule); denied != "" {
+			return nil, fmt.Errorf("invalid resource '%s' in rule '%s': namespaced rules may not apply to %s",
+				denied, rule.ID, strings.Join(namespacedRuleDeniedKinds, ", "))
+		}
 
 		// Parse TTL
-		ttlDuration, err := parseExtendedDuration(rule.TTL)
+		ttl, err := duration.Parse(rule.TTL)
 		if err != nil {
 			return nil, fmt.Errorf("invalid TTL '%s' in rule '%s': %w", rule.TTL, rule.ID, err)
 		}
 
+		var maxExtension duration.Duration
+		if rule.MaxExtension != "" {
+			maxExtension, err = duration.Parse(rule.MaxExtension)
+			if err != nil {
+				return nil, fmt.Errorf("invalid maxExtension '%s' in rule '%s': %w", rule.MaxExtension, rule.ID, err)
+			}
+		}
+
+		timeSource, err := ParseTimeSource(rule.TTLFrom)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttlFrom in rule '%s': %w", rule.ID, err)
+		}
+
+		var deletionWindow *window.Window
+		if rule.Schedule != "" {
+			deletionWindow, err = window.Parse(rule.Schedule)
+			if err != nil {
+				return nil, fmt.Errorf("invalid schedule in rule '%s': %w", rule.ID, err)
+			}
+		}
+
+		if err := validateOnError(rule.OnError); err != nil {
+			return nil, fmt.Errorf("invalid onError '%s' in rule '%s': %w", rule.OnError, rule.ID, err)
+		}
+		if rule.OnError == "" {
+			rule.OnError = OnErrorSkip
+		}
+		if rule.Action == "" {
+			rule.Action = actions.Delete
+		}
+		action, err := actions.New(rule.Action, rule.ActionParams)
+		if err != nil {
+			return nil, fmt.Errorf("invalid action '%s' in rule '%s': %w", rule.Action, rule.ID, err)
+		}
+		if rule.Namespace != "" && !slices.Contains(namespacedRuleActions, rule.Action) {
+			return nil, fmt.Errorf("invalid action '%s' in rule '%s': namespaced rules may only use %s",
+				rule.Action, rule.ID, strings.Join(namespacedRuleActions, ", "))
+		}
+
+		ruleSelector, err := newSelector(rule)
+		if err != nil {
+			return nil, fmt.Errorf("%w in rule '%s'", err, rule.ID)
+		}
+
 		// Compile expression
 		ast, issues := env.Compile(rule.Expression)
 		if issues != nil && issues.Err() != nil {
 			return nil, fmt.Errorf("failed to compile expression for rule '%s': %w", rule.ID, issues.Err())
 		}
 
-		program, err := env.Program(ast)
+		kinds := engine.kinds(rule)
+		if err := engine.checkFields(ast, kinds); err != nil {
+			return nil, fmt.Errorf("invalid expression for rule '%s': %w", rule.ID, err)
+		}
+		if err := engine.checkCost(env, ast); err != nil {
+			return nil, fmt.Errorf("expression for rule '%s' is too expensive: %w", rule.ID, err)
+		}
+
+		program, err := engine.program(env, ast)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create program for rule '%s': %w", rule.ID, err)
 		}
 
+		var ttlProgram cel.Program
+		if rule.TTLExpression != "" {
+			ttlProgram, err = engine.compileTTLExpression(env, rule.TTLExpression, kinds)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ttlExpression in rule '%s': %w", rule.ID, err)
+			}
+		}
+
 		engine.rules = append(engine.rules, compiledRule{
-			rule:        rule,
-			program:     program,
-			ttlDuration: ttlDuration,
+			rule:         rule,
+			selector:     ruleSelector,
+			program:      program,
+			ttlProgram:   ttlProgram,
+			ttl:          ttl,
+			maxExtension: maxExtension,
+			timeSource:   timeSource.In(engine.location),
+			window:       deletionWindow,
+			action:       action,
 		})
 	}
 
 	return engine, nil
 }
 
-// Evaluate evaluates all rules against an object and returns the first matching rule
-func (e *Engine) Evaluate(obj *unstructured.Unstructured) (*Rule, time.Duration) {
-	for _, compiledRule := range e.rules {
-		if matches := e.evaluateRule(compiledRule, obj); matches {
-			return &compiledRule.rule, compiledRule.ttlDuration
+// ttlExpressionTypes are the result types a ttlExpression may have. Strings
+// are parsed as extended durations such as "3d", null falls back to the TTL
+// and dyn is checked when the expression is evaluated.
+var ttlExpressionTypes = []*cel.Type{cel.DurationType, cel.TimestampType, cel.StringType, cel.NullType, cel.DynType}
+
+func (e *Engine) compileTTLExpression(env *cel.Env, expression string, kinds []string) (cel.Program, error) {
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("failed to compile: %w", issues.Err())
+	}
+
+	allowed := false
+	for _, t := range ttlExpressionTypes {
+		if ast.OutputType().IsExactType(t) {
+			allowed = true
+			break
 		}
 	}
+	if !allowed {
+		return nil, fmt.Errorf("must return a duration, timestamp or string, not %s", ast.OutputType())
+	}
+
+	if err := e.checkFields(ast, kinds); err != nil {
+		return nil, err
+	}
+	if err := e.checkCost(env, ast); err != nil {
+		return nil, fmt.Errorf("too expensive: %w", err)
+	}
+	return e.program(env, ast)
+}
+
+// Evaluate evaluates all rules against an object and returns the first matching rule,
+// with its TTL measured from the object's creation
+func (e *Engine) Evaluate(ctx context.Context, obj *unstructured.Unstructured) (*Rule, time.Duration) {
+	if m, err := e.Match(ctx, obj); err == nil && m != nil {
+		return m.Rule, m.TTL.From(obj.GetCreationTimestamp().Time)
+	}
 	return nil, 0
 }
 
-func (e *Engine) evaluateRule(rule compiledRule, obj *unstructured.Unstructured) bool {
+// Match evaluates all rules against an object and returns the first match, or
+// nil. Rules that fail to evaluate are handled according to their onError
+// policy, and an *EvaluationError is returned for those whose policy is fail.
+// Evaluations are aborted once ctx is done, in which case its error is
+// returned whatever the policy.
+func (e *Engine) Match(ctx context.Context, obj *unstructured.Unstructured) (*Match, error) {
+	for i := range e.rules {
+		compiledRule := &e.rules[i]
+		trace := e.evaluateRule(ctx, compiledRule, obj)
+		if trace.Err != nil {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			switch {
+			case !trace.ErrorDecides():
+				continue
+			case compiledRule.rule.OnError == OnErrorFail:
+				return nil, &EvaluationError{Rule: &compiledRule.rule, Err: trace.Err}
+			default:
+				trace.TTL = compiledRule.ttl
+			}
+		} else if !trace.Matched {
+			continue
+		}
+
+		return &Match{
+			Rule:         &compiledRule.rule,
+			TTL:          trace.TTL,
+			Expires:      trace.Expires,
+			MaxExtension: compiledRule.maxExtension,
+			TimeSource:   compiledRule.timeSource,
+			Window:       compiledRule.window,
+			Action:       compiledRule.action,
+		}, nil
+	}
+	return nil, nil
+}
+
+// RuleTrace records how a single rule evaluated against an object
+type RuleTrace struct {
+	Rule *Rule
+	// ResourceMatched is false when the rule does not apply to the object's kind,
+	// in which case its expression is not evaluated
+	ResourceMatched bool
+	// NotSelected tells which selector rejected the object, in which case its
+	// expression is not evaluated either
+	NotSelected string
+	// Result is the value the expression evaluated to
+	Result  string
+	Matched bool
+	Err     error
+	// Duration is how long the expression took to evaluate
+	Duration time.Duration
+	// evaluated is set once the expression ran, even if it failed
+	evaluated bool
+	// TTL and Expires are the matched rule's TTL, or the time its ttlExpression returned
+	TTL     duration.Duration
+	Expires time.Time
+	// TTLErr is set when the ttlExpression failed and TTL fell back to the rule's TTL
+	TTLErr error
+}
+
+// Trace evaluates every rule against an object, in order, without stopping at
+// the first match
+func (e *Engine) Trace(ctx context.Context, obj *unstructured.Unstructured) []RuleTrace {
+	traces := make([]RuleTrace, 0, len(e.rules))
+	for i := range e.rules {
+		traces = append(traces, e.traceRule(ctx, &e.rules[i], obj))
+	}
+	return traces
+}
+
+func (e *Engine) evaluateRule(ctx context.Context, rule *compiledRule, obj *unstructured.Unstructured) RuleTrace {
+	trace := e.traceRule(ctx, rule, obj)
+	if trace.evaluated {
+		e.stats.record(trace)
+	}
+	e.logErrors(trace, obj)
+	return trace
+}
+
+func (e *Engine) traceRule(ctx context.Context, rule *compiledRule, obj *unstructured.Unstructured) RuleTrace {
+	trace := RuleTrace{Rule: &rule.rule}
+
 	// Check if resource type matches
 	if !e.resourceMatches(rule.rule.Resources, obj.GetKind()) {
-		return false
+		return trace
+	}
+	trace.ResourceMatched = true
+
+	selected, reason, err := rule.selector.selects(obj, e.namespaceLabels)
+	if err != nil {
+		trace.Err = fmt.Errorf("%w: %w", errSelector, err)
+		return trace
+	}
+	if !selected {
+		trace.NotSelected = reason
+		return trace
 	}
 
 	// Prepare input for CEL evaluation
@@ -125,30 +435,97 @@ func (e *Engine) evaluateRule(rule compiledRule, obj *unstructured.Unstructured)
 	}
 
 	// Evaluate expression
-	out, _, err := rule.program.Eval(input)
+	start := time.Now()
+	out, err := e.eval(ctx, rule.program, input)
+	trace.Duration = time.Since(start)
+	trace.evaluated = true
 	if err != nil {
-		logrus.WithError(err).WithField("rule", rule.rule.ID).Debug("Failed to evaluate rule expression")
-		return false
+		trace.Err = err
+		return trace
 	}
+	trace.Result = fmt.Sprintf("%v", out.Value())
 
 	// Check if result is truthy
 	switch v := out.Value().(type) {
 	case bool:
-		return v
+		trace.Matched = v
 	case string:
-		return v != ""
+		trace.Matched = v != ""
 	case []interface{}:
-		return len(v) > 0
+		trace.Matched = len(v) > 0
 	case map[string]interface{}:
-		return len(v) > 0
+		trace.Matched = len(v) > 0
+	}
+
+	if trace.Matched {
+		trace.TTL = rule.ttl
+		if rule.ttlProgram != nil {
+			ttl, expires, err := e.evaluateTTL(ctx, rule.ttlProgram, input)
+			switch {
+			case err != nil:
+				trace.TTLErr = err
+			case !expires.IsZero():
+				trace.TTL, trace.Expires = duration.Duration{}, expires
+			case !ttl.IsZero():
+				trace.TTL = ttl
+			}
+		}
+	}
+	return trace
+}
+
+// evaluateTTL runs a ttlExpression and returns either a TTL or an expiration
+// time. Both are zero when the expression returned null.
+func (e *Engine) evaluateTTL(ctx context.Context, program cel.Program, input map[string]interface{}) (duration.Duration, time.Time, error) {
+	out, err := e.eval(ctx, program, input)
+	if err != nil {
+		return duration.Duration{}, time.Time{}, err
+	}
+
+	switch v := out.Value().(type) {
+	case time.Duration:
+		if v <= 0 {
+			return duration.Duration{}, time.Time{}, fmt.Errorf("duration %s must be positive", v)
+		}
+		return duration.Duration{Fixed: v}, time.Time{}, nil
+	case time.Time:
+		return duration.Duration{}, v, nil
+	case string:
+		ttl, err := duration.Parse(v)
+		return ttl, time.Time{}, err
+	case structpb.NullValue:
+		return duration.Duration{}, time.Time{}, nil
 	default:
-		return false
+		return duration.Duration{}, time.Time{}, fmt.Errorf("returned %s, not a duration, timestamp or string", out.Type())
+	}
+}
+
+// kinds lists the kinds with a schema that a rule applies to
+func (e *Engine) kinds(rule Rule) []string {
+	if e.schemas == nil {
+		return nil
+	}
+
+	var kinds []string
+	for _, kind := range e.schemas.Kinds() {
+		if e.resourceMatches(rule.Resources, kind) {
+			kinds = append(kinds, kind)
+		}
 	}
+	return kinds
+}
+
+// checkFields rejects field paths that none of the kinds have
+func (e *Engine) checkFields(ast *cel.Ast, kinds []string) error {
+	if e.schemas == nil || len(kinds) == 0 {
+		return nil
+	}
+	return e.schemas.check(ast, kinds)
 }
 
 func (e *Engine) resourceMatches(resources []string, kind string) bool {
 	for _, r := range resources {
-		if r == "*" || r == kind || r == pluralize(kind) {
+		if r == "*" || r == kind || strings.EqualFold(r, pluralize(kind)) {
 			return true
 		}
 	}
@@ -190,71 +567,3 @@ func pluralize(kind string) string {
 		return kind + "s"
 	}
 }
-
-// parseExtendedDuration parses duration strings with extended units:
-// - Standard Go units: h, m, s, ms, us, ns
-// - Extended units: d (days), w (weeks), month/months
-// Examples: "7d", "2w", "1month", "2w3d", "1month2w3d12h30m"
-func parseExtendedDuration(s string) (time.Duration, error) {
-	// First try standard Go duration parsing
-	if d, err := time.ParseDuration(s); err == nil {
-		return d, nil
-	}
-
-	// Extended parsing with regex
-	re := regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(months?|w|d|h|m|s|ms|us|µs|ns)`)
-	matches := re.FindAllStringSubmatch(s, -1)
-
-	if len(matches) == 0 {
-		return 0, fmt.Errorf("invalid duration format: %s", s)
-	}
-
-	var totalDuration time.Duration
-
-	for _, match := range matches {
-		value, err := strconv.ParseFloat(match[1], 64)
-		if err != nil {
-			return 0, fmt.Errorf("invalid number in duration: %s", match[1])
-		}
-
-		unit := match[2]
-		var unitDuration time.Duration
-
-		switch unit {
-		case "month", "months":
-			// Approximate month as 30 days
-			unitDuration = time.Duration(value * 30 * 24 * float64(time.Hour))
-		case "w":
-			unitDuration = time.Duration(value * 7 * 24 * float64(time.Hour))
-		case "d":
-			unitDuration = time.Duration(value * 24 * float64(time.Hour))
-		case "h":
-			unitDuration = time.Duration(value * float64(time.Hour))
-		case "m":
-			unitDuration = time.Duration(value * float64(time.Minute))
-		case "s":
-			unitDuration = time.Duration(value * float64(time.Second))
-		case "ms":
-			unitDuration = time.Duration(value * float64(time.Millisecond))
-		case "us", "µs":
-			unitDuration = time.Duration(value * float64(time.Microsecond))
-		case "ns":
-			unitDuration = time.Duration(value * float64(time.Nanosecond))
-		default:
-			return 0, fmt.Errorf("unknown time unit: %s", unit)
-		}
-
-		totalDuration += unitDuration
-	}
-
-	// Verify we consumed the entire string (ignoring whitespace)
-	consumed := ""
-	for _, match := range matches {
-		consumed += match[0]
-	}
-	if strings.ReplaceAll(s, " ", "") != strings.ReplaceAll(consumed, " ", "") {
-		return 0, fmt.Errorf("invalid duration format: %s", s)
-	}
-
-	return totalDuration, nil
-}
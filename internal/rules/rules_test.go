@@ -1,11 +1,14 @@
 package rules
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/blaxel-ai/kube-janitor-go/pkg/actions"
+	"github.com/blaxel-ai/kube-janitor-go/pkg/duration"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -43,6 +46,50 @@ func TestNewRulesEngine(t *testing.T) {
 			wantError: true,
 			errorMsg:  "invalid rule ID",
 		},
+		{
+			name: "rule ID with a leading slash",
+			rules: []Rule{
+				{
+					ID:         "/test-rule",
+					Resources:  []string{"pods"},
+					Expression: "true",
+					TTL:        "1h",
+				},
+			},
+			wantError: true,
+			errorMsg:  "invalid rule ID",
+		},
+		{
+			name: "namespaced rule ID",
+			rules: []Rule{
+				{
+					ID:         "team-a/test-rule",
+					Namespace:  "team-a",
+					Resources:  []string{"pods"},
+					Expression: "true",
+					TTL:        "1h",
+				},
+			},
+			wantError: false,
+		},
+		{
+			name: "duplicate rule ID",
+			rules: []Rule{
+				{ID: "test-rule", Resources: []string{"pods"}, Expression: "true", TTL: "1h"},
+				{ID: "test-rule", Resources: []string{"jobs"}, Expression: "true", TTL: "1h"},
+			},
+			wantError: true,
+			errorMsg:  "duplicate rule ID 'test-rule'",
+		},
+		{
+			name: "rule ID used by a builtin policy",
+			rules: []Rule{
+				{ID: "completed-jobs", Resources: []string{"jobs"}, Expression: "true", TTL: "1h"},
+				{ID: "completed-jobs", Builtin: "completed-jobs"},
+			},
+			wantError: true,
+			errorMsg:  "duplicate rule ID 'completed-jobs'",
+		},
 		{
 			name: "invalid TTL",
 			rules: []Rule{
@@ -56,6 +103,34 @@ func TestNewRulesEngine(t *testing.T) {
 			wantError: true,
 			errorMsg:  "invalid TTL",
 		},
+		{
+			name: "invalid maxExtension",
+			rules: []Rule{
+				{
+					ID:           "test-rule",
+					Resources:    []string{"pods"},
+					Expression:   "true",
+					TTL:          "1h",
+					MaxExtension: "forever",
+				},
+			},
+			wantError: true,
+			errorMsg:  "invalid maxExtension",
+		},
+		{
+			name: "invalid schedule",
+			rules: []Rule{
+				{
+					ID:         "test-rule",
+					Resources:  []string{"pods"},
+					Expression: "true",
+					TTL:        "1h",
+					Schedule:   "business hours",
+				},
+			},
+			wantError: true,
+			errorMsg:  "invalid schedule",
+		},
 		{
 			name: "invalid expression",
 			rules: []Rule{
@@ -196,7 +271,7 @@ func TestEvaluateRule(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			rule, duration := engine.Evaluate(tt.obj)
+			rule, duration := engine.Evaluate(context.Background(), tt.obj)
 			if tt.wantMatch {
 				require.NotNil(t, rule)
 				assert.Equal(t, tt.wantRuleID, rule.ID)
@@ -209,6 +284,48 @@ func TestEvaluateRule(t *testing.T) {
 	}
 }
 
+func TestTrace(t *testing.T) {
+	engine, err := New([]Rule{
+		{ID: "services-only", Resources: []string{"services"}, Expression: "true", TTL: "1h"},
+		{ID: "no-match", Resources: []string{"pods"}, Expression: `object.metadata.name == "other"`, TTL: "1h"},
+		{ID: "broken", Resources: []string{"pods"}, Expression: "object.spec.missing == 1", TTL: "1h"},
+		{ID: "first-match", Resources: []string{"pods"}, Expression: `object.metadata.name.startsWith("test")`, TTL: "2h"},
+		{ID: "second-match", Resources: []string{"*"}, Expression: "true", TTL: "3h"},
+	})
+	require.NoError(t, err)
+
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind":     "Pod",
+			"metadata": map[string]interface{}{"name": "test-pod"},
+			"spec":     map[string]interface{}{},
+		},
+	}
+
+	traces := engine.Trace(context.Background(), obj)
+	require.Len(t, traces, 5)
+
+	assert.Equal(t, "services-only", traces[0].Rule.ID)
+	assert.False(t, traces[0].ResourceMatched)
+	assert.False(t, traces[0].Matched)
+
+	assert.True(t, traces[1].ResourceMatched)
+	assert.Equal(t, "false", traces[1].Result)
+	assert.False(t, traces[1].Matched)
+
+	assert.Error(t, traces[2].Err)
+	assert.False(t, traces[2].Matched)
+
+	assert.Equal(t, "true", traces[3].Result)
+	assert.True(t, traces[3].Matched)
+	assert.True(t, traces[4].Matched, "rules after the first match are still evaluated")
+
+	match, err := engine.Match(context.Background(), obj)
+	require.NoError(t, err)
+	require.NotNil(t, match)
+	assert.Equal(t, "first-match", match.Rule.ID)
+}
+
 func TestResourceMatches(t *testing.T) {
 	engine := &Engine{}
 
@@ -242,6 +359,12 @@ func TestResourceMatches(t *testing.T) {
 			kind:      "Pod",
 			want:      false,
 		},
+		{
+			name:      "plural match of a kind without a special case",
+			resources: []string{"jobs"},
+			kind:      "Job",
+			want:      true,
+		},
 		{
 			name:      "multiple resources with match",
 			resources: []string{"services", "pods", "deployments"},
@@ -327,3 +450,212 @@ func TestLoadFromFile(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to parse rules file")
 }
+
+func TestTTLExpression(t *testing.T) {
+	pod := func(namespace string, labels map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"kind": "Pod",
+				"metadata": map[string]interface{}{
+					"name":      "test-pod",
+					"namespace": namespace,
+					"labels":    labels,
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		ttlExpression string
+		obj           *unstructured.Unstructured
+		wantTTL       duration.Duration
+		wantExpires   time.Time
+		wantTTLErr    bool
+	}{
+		{
+			name:          "string by namespace prefix",
+			ttlExpression: `object.metadata.namespace.startsWith("dev-") ? "1d" : "3d"`,
+			obj:           pod("dev-feature", nil),
+			wantTTL:       duration.MustParse("1d"),
+		},
+		{
+			name:          "string other branch",
+			ttlExpression: `object.metadata.namespace.startsWith("dev-") ? "1d" : "3d"`,
+			obj:           pod("staging-api", nil),
+			wantTTL:       duration.MustParse("3d"),
+		},
+		{
+			name:          "CEL duration",
+			ttlExpression: `duration("36h")`,
+			obj:           pod("default", nil),
+			wantTTL:       duration.Duration{Fixed: 36 * time.Hour},
+		},
+		{
+			name:          "timestamp",
+			ttlExpression: `timestamp("2026-11-01T18:00:00Z")`,
+			obj:           pod("default", nil),
+			wantExpires:   time.Date(2026, 11, 1, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			name:          "null falls back to the ttl",
+			ttlExpression: `"branch" in object.metadata.labels ? dyn("2h") : null`,
+			obj:           pod("default", map[string]interface{}{}),
+			wantTTL:       duration.MustParse("1w"),
+		},
+		{
+			name:          "label value",
+			ttlExpression: `"ttl" in object.metadata.labels ? object.metadata.labels["ttl"] : null`,
+			obj:           pod("default", map[string]interface{}{"ttl": "12h"}),
+			wantTTL:       duration.MustParse("12h"),
+		},
+		{
+			name:          "invalid string falls back to the ttl",
+			ttlExpression: `object.metadata.labels["ttl"]`,
+			obj:           pod("default", map[string]interface{}{"ttl": "forever"}),
+			wantTTL:       duration.MustParse("1w"),
+			wantTTLErr:    true,
+		},
+		{
+			name:          "evaluation error falls back to the ttl",
+			ttlExpression: `object.metadata.labels["ttl"]`,
+			obj:           pod("default", map[string]interface{}{}),
+			wantTTL:       duration.MustParse("1w"),
+			wantTTLErr:    true,
+		},
+		{
+			name:          "negative duration falls back to the ttl",
+			ttlExpression: `duration("-1h")`,
+			obj:           pod("default", nil),
+			wantTTL:       duration.MustParse("1w"),
+			wantTTLErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := New([]Rule{{
+				ID:            "computed",
+				Resources:     []string{"pods"},
+				Expression:    "true",
+				TTL:           "1w",
+				TTLExpression: tt.ttlExpression,
+			}})
+			require.NoError(t, err)
+
+			match, err := engine.Match(context.Background(), tt.obj)
+			require.NoError(t, err)
+			require.NotNil(t, match)
+			assert.Equal(t, tt.wantTTL, match.TTL)
+			assert.True(t, tt.wantExpires.Equal(match.Expires), "want %s, got %s", tt.wantExpires, match.Expires)
+
+			traces := engine.Trace(context.Background(), tt.obj)
+			require.Len(t, traces, 1)
+			assert.Equal(t, tt.wantTTLErr, traces[0].TTLErr != nil)
+		})
+	}
+}
+
+func TestTTLExpressionTypeCheck(t *testing.T) {
+	tests := []struct {
+		name          string
+		ttlExpression string
+		wantErr       string
+	}{
+		{name: "duration", ttlExpression: `duration("1h")`},
+		{name: "timestamp", ttlExpression: `timestamp("2026-11-01T18:00:00Z")`},
+		{name: "string", ttlExpression: `"3d"`},
+		{name: "dynamic", ttlExpression: `object.metadata.labels["ttl"]`},
+		{name: "bool", ttlExpression: `true`, wantErr: "must return a duration, timestamp or string"},
+		{name: "int", ttlExpression: `3600`, wantErr: "must return a duration, timestamp or string"},
+		{name: "syntax error", ttlExpression: `duration(`, wantErr: "failed to compile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New([]Rule{{
+				ID:            "computed",
+				Resources:     []string{"*"},
+				Expression:    "true",
+				TTL:           "1h",
+				TTLExpression: tt.ttlExpression,
+			}})
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "invalid ttlExpression in rule 'computed'")
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestRuleAction(t *testing.T) {
+	engine, err := New([]Rule{
+		{ID: "default", Resources: []string{"pods"}, Expression: "true", TTL: "1h"},
+		{ID: "idle", Resources: []string{"deployments"}, Expression: "true", TTL: "1h", Action: actions.ScaleDown},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, actions.Delete, engine.rules[0].rule.Action)
+	assert.Equal(t, actions.ScaleDown, engine.rules[1].rule.Action)
+	assert.NotNil(t, engine.rules[1].action)
+
+	tests := []struct {
+		name      string
+		namespace string
+		action    string
+		params    map[string]string
+		wantErr   string
+	}{
+		{
+			name:    "unknown action",
+			action:  "hibernate",
+			wantErr: "invalid action 'hibernate' in rule 'r': must be one of delete, patch, scale-down, suspend, webhook",
+		},
+		{
+			name:    "missing parameter",
+			action:  actions.Patch,
+			wantErr: "invalid action 'patch' in rule 'r': missing parameter 'patch'",
+		},
+		{
+			name:    "unknown parameter",
+			action:  actions.Suspend,
+			params:  map[string]string{"url": "http://example.com"},
+			wantErr: "invalid action 'suspend' in rule 'r': unknown parameter 'url'",
+		},
+		{
+			name:      "webhook in a namespaced rule",
+			namespace: "team-a",
+			action:    actions.Webhook,
+			params:    map[string]string{"url": "http://example.com"},
+			wantErr:   "invalid action 'webhook' in rule 'team-a/r': namespaced rules may only use delete, scale-down, suspend",
+		},
+		{
+			name:      "patch in a namespaced rule",
+			namespace: "team-a",
+			action:    actions.Patch,
+			params:    map[string]string{"patch": `{"metadata":{"labels":{"expired":"true"}}}`},
+			wantErr:   "invalid action 'patch' in rule 'team-a/r': namespaced rules may only use delete, scale-down, suspend",
+		},
+		{
+			name:      "scale down in a namespaced rule",
+			namespace: "team-a",
+			action:    actions.ScaleDown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := "r"
+			if tt.namespace != "" {
+				id = tt.namespace + "/r"
+			}
+			_, err := New([]Rule{{ID: id, Namespace: tt.namespace, Resources: []string{"pods"}, Expression: "true", TTL: "1h", Action: tt.action, ActionParams: tt.params}})
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/types"
+)
+
+// Schema is the part of an OpenAPI v3 schema that rules are checked against
+type Schema struct {
+	Type       string             `json:"type,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Ref        string             `json:"$ref,omitempty"`
+	AllOf      []*Schema          `json:"allOf,omitempty"`
+	// AdditionalProperties describes the values of maps such as labels
+	AdditionalProperties *Schema `json:"-"`
+	// AnyFields is set when fields that are not described are allowed, by
+	// additionalProperties: true or x-kubernetes-preserve-unknown-fields
+	AnyFields        bool `json:"-"`
+	GroupVersionKind []struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	} `json:"x-kubernetes-group-version-kind,omitempty"`
+}
+
+// UnmarshalJSON accepts additionalProperties as either a schema or a boolean
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	type plain Schema
+	var raw struct {
+		*plain
+		AdditionalProperties  json.RawMessage `json:"additionalProperties,omitempty"`
+		PreserveUnknownFields bool            `json:"x-kubernetes-preserve-unknown-fields,omitempty"`
+	}
+	raw.plain = (*plain)(s)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	s.AnyFields = raw.PreserveUnknownFields
+	switch string(raw.AdditionalProperties) {
+	case "", "false":
+	case "true":
+		s.AnyFields = true
+	default:
+		s.AdditionalProperties = &Schema{}
+		if err := json.Unmarshal(raw.AdditionalProperties, s.AdditionalProperties); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Schemas are the OpenAPI schemas of the kinds served by the API server. With
+// WithSchemas, the field paths used by rules are checked against the schemas
+// of the kinds they apply to, so that typos fail when rules are loaded
+// rather than on every evaluation.
+type Schemas struct {
+	definitions map[string]*Schema
+	// kinds maps kinds to the names of their definitions, one per version
+	kinds map[string][]string
+}
+
+// NewSchemas creates an empty set of schemas
+func NewSchemas() *Schemas {
+	return &Schemas{
+		definitions: make(map[string]*Schema),
+		kinds:       make(map[string][]string),
+	}
+}
+
+// AddOpenAPIV3 adds the schemas of an OpenAPI v3 document, such as the one
+// the API server serves for each group version under /openapi/v3
+func (s *Schemas) AddOpenAPIV3(data []byte) error {
+	var doc struct {
+		Components struct {
+			Schemas map[string]*Schema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		schema := doc.Components.Schemas[name]
+		if _, ok := s.definitions[name]; ok {
+			continue
+		}
+		s.definitions[name] = schema
+		for _, gvk := range schema.GroupVersionKind {
+			s.kinds[gvk.Kind] = append(s.kinds[gvk.Kind], name)
+		}
+	}
+	return nil
+}
+
+// Kinds lists the kinds that have a schema
+func (s *Schemas) Kinds() []string {
+	kinds := make([]string, 0, len(s.kinds))
+	for kind := range s.kinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// WithSchemas checks the field paths of rules against the schemas of the
+// kinds they apply to. Rules whose kinds have no schema are not checked.
+func WithSchemas(schemas *Schemas) Option {
+	return func(e *Engine) {
+		e.schemas = schemas
+	}
+}
+
+// resolve follows references until it reaches a schema that describes a value
+func (s *Schemas) resolve(schema *Schema) *Schema {
+	for i := 0; schema != nil && i < 32; i++ {
+		switch {
+		case schema.Ref != "":
+			schema = s.definitions[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		case len(schema.AllOf) == 1 && len(schema.Properties) == 0:
+			schema = schema.AllOf[0]
+		default:
+			return schema
+		}
+	}
+	return nil
+}
+
+// check verifies the field paths of a compiled expression against the
+// schemas of kinds. A path is only rejected when no kind has it, as the
+// expression may apply to several kinds.
+func (s *Schemas) check(checked *cel.Ast, kinds []string) error {
+	var roots []*Schema
+	for _, kind := range kinds {
+		for _, name := range s.kinds[kind] {
+			if root := s.resolve(s.definitions[name]); root != nil {
+				roots = append(roots, root)
+			}
+		}
+	}
+	if len(roots) == 0 {
+		return nil
+	}
+
+	c := &pathChecker{schemas: s, kinds: strings.Join(kinds, ", ")}
+	return c.walk(checked.NativeRep().Expr(), map[string][]*Schema{"object": roots})
+}
+
+// pathChecker walks an expression, tracking the schemas of the values that
+// field paths select from. A nil set of schemas means the value is not
+// described, so nothing below it is checked.
+type pathChecker struct {
+	schemas *Schemas
+	kinds   string
+}
+
+func (c *pathChecker) walk(e ast.Expr, scope map[string][]*Schema) error {
+	switch e.Kind() {
+	case ast.IdentKind, ast.SelectKind:
+		_, _, err := c.value(e, scope)
+		return err
+	case ast.CallKind:
+		call := e.AsCall()
+		if call.FunctionName() == "_[_]" {
+			_, _, err := c.value(e, scope)
+			return err
+		}
+		if call.IsMemberFunction() {
+			if err := c.walk(call.Target(), scope); err != nil {
+				return err
+			}
+		}
+		return c.walkAll(call.Args(), scope)
+	case ast.ListKind:
+		return c.walkAll(e.AsList().Elements(), scope)
+	case ast.MapKind:
+		for _, entry := range e.AsMap().Entries() {
+			if err := c.walkAll([]ast.Expr{entry.AsMapEntry().Key(), entry.AsMapEntry().Value()}, scope); err != nil {
+				return err
+			}
+		}
+	case ast.StructKind:
+		for _, field := range e.AsStruct().Fields() {
+			if err := c.walk(field.AsStructField().Value(), scope); err != nil {
+				return err
+			}
+		}
+	case ast.ComprehensionKind:
+		comprehension := e.AsComprehension()
+		iterRange, _, err := c.value(comprehension.IterRange(), scope)
+		if err != nil {
+			return err
+		}
+		if err := c.walk(comprehension.AccuInit(), scope); err != nil {
+			return err
+		}
+
+		inner := make(map[string][]*Schema, len(scope)+2)
+		for name, schemas := range scope {
+			inner[name] = schemas
+		}
+		// The first variable holds list elements, or map keys and list indexes
+		// when there is a second one, which holds the values
+		inner[comprehension.AccuVar()] = nil
+		if comprehension.HasIterVar2() {
+			inner[comprehension.IterVar()] = nil
+			inner[comprehension.IterVar2()] = c.elements(iterRange, true)
+		} else {
+			inner[comprehension.IterVar()] = c.elements(iterRange, false)
+		}
+		return c.walkAll([]ast.Expr{comprehension.LoopCondition(), comprehension.LoopStep(), comprehension.Result()}, inner)
+	}
+	return nil
+}
+
+func (c *pathChecker) walkAll(exprs []ast.Expr, scope map[string][]*Schema) error {
+	for _, e := range exprs {
+		if err := c.walk(e, scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value returns the schemas of the value an expression evaluates to, along
+// with its path for error messages
+func (c *pathChecker) value(e ast.Expr, scope map[string][]*Schema) ([]*Schema, string, error) {
+	switch e.Kind() {
+	case ast.IdentKind:
+		return scope[e.AsIdent()], e.AsIdent(), nil
+	case ast.SelectKind:
+		sel := e.AsSelect()
+		operand, path, err := c.value(sel.Operand(), scope)
+		if err != nil || operand == nil {
+			return nil, "", err
+		}
+		return c.field(operand, path, sel.FieldName())
+	case ast.CallKind:
+		call := e.AsCall()
+		if call.FunctionName() == "_[_]" && len(call.Args()) == 2 {
+			operand, path, err := c.value(call.Args()[0], scope)
+			if err != nil {
+				return nil, "", err
+			}
+			index := call.Args()[1]
+			if err := c.walk(index, scope); err != nil || operand == nil {
+				return nil, "", err
+			}
+			if index.Kind() == ast.LiteralKind {
+				if key, ok := index.AsLiteral().(types.String); ok {
+					return c.field(operand, path, string(key))
+				}
+			}
+			return c.elements(operand, true), path + "[...]", nil
+		}
+	}
+	return nil, "", c.walk(e, scope)
+}
+
+// field returns the schemas of a field of values described by operands. It
+// fails when none of them has the field.
+func (c *pathChecker) field(operands []*Schema, path, name string) ([]*Schema, string, error) {
+	path += "." + name
+	var fields []*Schema
+	var valueType string
+	for _, operand := range operands {
+		switch {
+		case operand.Properties[name] != nil:
+			fields = append(fields, c.schemas.resolve(operand.Properties[name]))
+		case operand.AdditionalProperties != nil:
+			fields = append(fields, c.schemas.resolve(operand.AdditionalProperties))
+		case len(operand.Properties) > 0 && !operand.AnyFields:
+			// Unknown field of an object
+		case operand.Type != "" && operand.Type != "object":
+			valueType = operand.Type
+		default:
+			// Not described, so anything goes below this field
+			return nil, path, nil
+		}
+	}
+
+	if len(fields) == 0 {
+		if valueType != "" {
+			return nil, "", fmt.Errorf("%s: %s has type %s, which has no fields", path, strings.TrimSuffix(path, "."+name), valueType)
+		}
+		return nil, "", fmt.Errorf("%s: no field %q in the schema of %s", path, name, c.kinds)
+	}
+	for _, f := range fields {
+		if f == nil {
+			return nil, path, nil
+		}
+	}
+	return fields, path, nil
+}
+
+// elements returns the schemas of the elements of lists described by
+// operands and, with mapValues, of the values of maps
+func (c *pathChecker) elements(operands []*Schema, mapValues bool) []*Schema {
+	var elements []*Schema
+	for _, operand := range operands {
+		var element *Schema
+		switch {
+		case operand.Items != nil:
+			element = c.schemas.resolve(operand.Items)
+		case operand.AdditionalProperties != nil && mapValues:
+			element = c.schemas.resolve(operand.AdditionalProperties)
+		}
+		if element == nil {
+			return nil
+		}
+		elements = append(elements, element)
+	}
+	return elements
+}
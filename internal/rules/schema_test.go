@@ -0,0 +1,268 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openAPIApps and openAPIBatch are trimmed versions of the documents served
+// under /openapi/v3/apis/apps/v1 and /openapi/v3/apis/batch/v1
+const (
+	openAPIApps = `{
+  "openapi": "3.0.0",
+  "components": {
+    "schemas": {
+      "io.k8s.api.apps.v1.Deployment": {
+        "type": "object",
+        "properties": {
+          "apiVersion": {"type": "string"},
+          "kind": {"type": "string"},
+          "metadata": {"default": {}, "allOf": [{"$ref": "#/components/schemas/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"}]},
+          "spec": {"default": {}, "allOf": [{"$ref": "#/components/schemas/io.k8s.api.apps.v1.DeploymentSpec"}]}
+        },
+        "x-kubernetes-group-version-kind": [{"group": "apps", "kind": "Deployment", "version": "v1"}]
+      },
+      "io.k8s.api.apps.v1.DeploymentSpec": {
+        "type": "object",
+        "properties": {
+          "replicas": {"type": "integer", "format": "int32"},
+          "template": {"default": {}, "allOf": [{"$ref": "#/components/schemas/io.k8s.api.core.v1.PodTemplateSpec"}]}
+        }
+      },
+      "io.k8s.api.core.v1.PodTemplateSpec": {
+        "type": "object",
+        "properties": {
+          "metadata": {"default": {}, "allOf": [{"$ref": "#/components/schemas/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"}]},
+          "spec": {"allOf": [{"$ref": "#/components/schemas/io.k8s.api.core.v1.PodSpec"}]}
+        }
+      },
+      "io.k8s.api.core.v1.PodSpec": {
+        "type": "object",
+        "properties": {
+          "containers": {"type": "array", "items": {"default": {}, "allOf": [{"$ref": "#/components/schemas/io.k8s.api.core.v1.Container"}]}}
+        }
+      },
+      "io.k8s.api.core.v1.Container": {
+        "type": "object",
+        "properties": {
+          "image": {"type": "string"},
+          "name": {"type": "string"},
+          "env": {"type": "array", "items": {"type": "object", "properties": {"name": {"type": "string"}, "value": {"type": "string"}}}}
+        }
+      },
+      "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "namespace": {"type": "string"},
+          "labels": {"type": "object", "additionalProperties": {"type": "string", "default": ""}},
+          "annotations": {"type": "object", "additionalProperties": {"type": "string", "default": ""}},
+          "creationTimestamp": {"allOf": [{"$ref": "#/components/schemas/io.k8s.apimachinery.pkg.apis.meta.v1.Time"}]}
+        }
+      },
+      "io.k8s.apimachinery.pkg.apis.meta.v1.Time": {"type": "string", "format": "date-time"}
+    }
+  }
+}`
+	openAPIBatch = `{
+  "openapi": "3.0.0",
+  "components": {
+    "schemas": {
+      "io.k8s.api.batch.v1.Job": {
+        "type": "object",
+        "properties": {
+          "metadata": {"allOf": [{"$ref": "#/components/schemas/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"}]},
+          "spec": {"type": "object", "properties": {"suspend": {"type": "boolean"}}},
+          "status": {"type": "object", "properties": {"succeeded": {"type": "integer"}}}
+        },
+        "x-kubernetes-group-version-kind": [{"group": "batch", "kind": "Job", "version": "v1"}]
+      },
+      "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {
+        "type": "object",
+        "properties": {"name": {"type": "string"}, "labels": {"type": "object", "additionalProperties": {"type": "string"}}}
+      },
+      "com.example.v1.Widget": {
+        "type": "object",
+        "properties": {
+          "metadata": {"type": "object"},
+          "spec": {"type": "object", "x-kubernetes-preserve-unknown-fields": true}
+        },
+        "x-kubernetes-group-version-kind": [{"group": "example.com", "kind": "Widget", "version": "v1"}]
+      }
+    }
+  }
+}`
+)
+
+func TestSchemaFieldPaths(t *testing.T) {
+	schemas := NewSchemas()
+	require.NoError(t, schemas.AddOpenAPIV3([]byte(openAPIApps)))
+	require.NoError(t, schemas.AddOpenAPIV3([]byte(openAPIBatch)))
+	assert.Equal(t, []string{"Deployment", "Job", "Widget"}, schemas.Kinds())
+
+	tests := []struct {
+		name       string
+		resources  []string
+		expression string
+		errorMsg   string
+	}{
+		{
+			name:       "known fields",
+			resources:  []string{"deployments"},
+			expression: `object.metadata.name.startsWith("pr-") && object.spec.replicas > 0`,
+		},
+		{
+			name:       "typo",
+			resources:  []string{"deployments"},
+			expression: `object.metdata.labels.app == "web"`,
+			errorMsg:   `object.metdata: no field "metdata" in the schema of Deployment`,
+		},
+		{
+			name:       "typo in has",
+			resources:  []string{"deployments"},
+			expression: `!has(object.spec.template.metadata.lables.app)`,
+			errorMsg:   `object.spec.template.metadata.lables: no field "lables"`,
+		},
+		{
+			name:       "map keys",
+			resources:  []string{"deployments"},
+			expression: `has(object.metadata.labels.app) && object.metadata.annotations["example.com/owner"] != ""`,
+		},
+		{
+			name:       "index with a literal",
+			resources:  []string{"deployments"},
+			expression: `object["spec"]["replica"] > 0`,
+			errorMsg:   `object.spec.replica: no field "replica"`,
+		},
+		{
+			name:       "comprehension over a list",
+			resources:  []string{"deployments"},
+			expression: `object.spec.template.spec.containers.exists(c, c.imag.endsWith(":latest"))`,
+			errorMsg:   `c.imag: no field "imag"`,
+		},
+		{
+			name:       "nested comprehensions",
+			resources:  []string{"deployments"},
+			expression: `object.spec.template.spec.containers.all(c, c.env.all(e, e.name != "" && e.value != ""))`,
+		},
+		{
+			name:       "comprehension over map keys",
+			resources:  []string{"deployments"},
+			expression: `object.metadata.labels.exists(k, k.startsWith("team"))`,
+		},
+		{
+			name:       "field of a scalar",
+			resources:  []string{"deployments"},
+			expression: `object.spec.replicas.value > 0`,
+			errorMsg:   "object.spec.replicas has type integer, which has no fields",
+		},
+		{
+			name:       "field of a list",
+			resources:  []string{"deployments"},
+			expression: `object.spec.template.spec.containers.image == "nginx"`,
+			errorMsg:   "object.spec.template.spec.containers has type array",
+		},
+		{
+			name:       "field of one of the kinds",
+			resources:  []string{"deployments", "jobs"},
+			expression: `has(object.status.succeeded) || object.spec.replicas > 0`,
+		},
+		{
+			name:       "field of none of the kinds",
+			resources:  []string{"deployments", "jobs"},
+			expression: `object.spec.paused`,
+			errorMsg:   `no field "paused" in the schema of Deployment, Job`,
+		},
+		{
+			name:       "all kinds",
+			resources:  []string{"*"},
+			expression: `object.metdata.name == ""`,
+			errorMsg:   `no field "metdata"`,
+		},
+		{
+			name:       "fields that are not described",
+			resources:  []string{"widgets"},
+			expression: `object.spec.anything.goes && object.metadata.whatever`,
+		},
+		{
+			name:       "kind without a schema",
+			resources:  []string{"pods"},
+			expression: `object.spce.containers.size() > 0`,
+		},
+		{
+			name:       "helper arguments",
+			resources:  []string{"jobs"},
+			expression: `isCompleted(object) && hasLabel(object, "app") && object.metadata.nam == ""`,
+			errorMsg:   `no field "nam"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New([]Rule{{
+				ID:         "test-rule",
+				Resources:  tt.resources,
+				Expression: tt.expression,
+				TTL:        "1h",
+			}}, WithSchemas(schemas), WithCostLimit(0))
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "invalid expression for rule 'test-rule'")
+				assert.Contains(t, err.Error(), tt.errorMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("ttlExpression", func(t *testing.T) {
+		_, err := New([]Rule{{
+			ID:            "test-rule",
+			Resources:     []string{"deployments"},
+			Expression:    "true",
+			TTL:           "1h",
+			TTLExpression: `object.metadata.labels.ttl`,
+		}}, WithSchemas(schemas))
+		assert.NoError(t, err)
+
+		_, err = New([]Rule{{
+			ID:            "test-rule",
+			Resources:     []string{"deployments"},
+			Expression:    "true",
+			TTL:           "1h",
+			TTLExpression: `object.metadata.label.ttl`,
+		}}, WithSchemas(schemas))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `invalid ttlExpression in rule 'test-rule': object.metadata.label: no field "label"`)
+	})
+
+	t.Run("without schemas", func(t *testing.T) {
+		_, err := New([]Rule{{
+			ID:         "test-rule",
+			Resources:  []string{"deployments"},
+			Expression: `object.metdata.labels.app == "web"`,
+			TTL:        "1h",
+		}})
+		assert.NoError(t, err)
+	})
+}
+
+func TestSchemaAdditionalProperties(t *testing.T) {
+	schemas := NewSchemas()
+	require.NoError(t, schemas.AddOpenAPIV3([]byte(`{"components": {"schemas": {
+		"a": {"type": "object", "additionalProperties": true},
+		"b": {"type": "object", "additionalProperties": false, "properties": {"x": {"type": "string"}}},
+		"c": {"type": "object", "additionalProperties": {"type": "integer"}}
+	}}}`)))
+
+	assert.True(t, schemas.definitions["a"].AnyFields)
+	assert.Nil(t, schemas.definitions["a"].AdditionalProperties)
+	assert.False(t, schemas.definitions["b"].AnyFields)
+	assert.Nil(t, schemas.definitions["b"].AdditionalProperties)
+	require.NotNil(t, schemas.definitions["c"].AdditionalProperties)
+	assert.Equal(t, "integer", schemas.definitions["c"].AdditionalProperties.Type)
+
+	assert.Error(t, schemas.AddOpenAPIV3([]byte(`not json`)))
+}
@@ -0,0 +1,150 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// NamespaceLabels returns the labels of a namespace, for namespace selectors
+type NamespaceLabels func(namespace string) (labels.Set, error)
+
+// WithNamespaceLabels sets how the engine looks up namespace labels. Rules
+// with a namespaceSelector never match without it.
+func WithNamespaceLabels(lookup NamespaceLabels) Option {
+	return func(e *Engine) {
+		e.namespaceLabels = lookup
+	}
+}
+
+// namespacedRuleDeniedKinds are the kinds namespaced rule resources never
+// apply to: they guard the namespace itself, so letting its users delete them
+// would let them lift their own restrictions
+var namespacedRuleDeniedKinds = []string{"Role", "RoleBinding", "ResourceQuota", "LimitRange", "NetworkPolicy"}
+
+func deniedToNamespacedRules(kind string) bool {
+	for _, denied := range namespacedRuleDeniedKinds {
+		if kind == denied {
+			return true
+		}
+	}
+	return false
+}
+
+// deniedResource returns the first resource of a namespaced rule that names
+// one of the denied kinds, or "" if there is none
+func deniedResource(rule Rule) string {
+	if rule.Namespace == "" {
+		return ""
+	}
+	for _, resource := range rule.Resources {
+		for _, kind := range namespacedRuleDeniedKinds {
+			if resource == kind || strings.EqualFold(resource, pluralize(kind)) {
+				return resource
+			}
+		}
+	}
+	return ""
+}
+
+// selector holds the filters a rule applies before its expression. They are
+// much cheaper than CEL, so objects they reject never reach the program.
+type selector struct {
+	// owner is the only namespace a namespaced rule resource applies to
+	owner             string
+	namespaces        map[string]bool
+	excludeNamespaces map[string]bool
+	// labels and namespaceLabels are nil when the rule has no such selector
+	labels          labels.Selector
+	namespaceLabels labels.Selector
+}
+
+func newSelector(rule Rule) (*selector, error) {
+	s := &selector{owner: rule.Namespace}
+	if len(rule.Namespaces) > 0 {
+		s.namespaces = make(map[string]bool, len(rule.Namespaces))
+		for _, ns := range rule.Namespaces {
+			s.namespaces[ns] = true
+		}
+	}
+	if len(rule.ExcludeNamespaces) > 0 {
+		s.excludeNamespaces = make(map[string]bool, len(rule.ExcludeNamespaces))
+		for _, ns := range rule.ExcludeNamespaces {
+			s.excludeNamespaces[ns] = true
+		}
+	}
+
+	var err error
+	if rule.LabelSelector != nil {
+		s.labels, err = metav1.LabelSelectorAsSelector(rule.LabelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid labelSelector: %w", err)
+		}
+	}
+	if rule.NamespaceSelector != nil {
+		s.namespaceLabels, err = metav1.LabelSelectorAsSelector(rule.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespaceSelector: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// selects reports whether the object passes the selectors. When it does not,
+// the reason tells which selector rejected it.
+//
+// Namespace filters apply to the namespace of namespaced objects and to the
+// name of Namespace objects. Other cluster-scoped objects have no namespace,
+// so they never pass namespaces or namespaceSelector.
+func (s *selector) selects(obj *unstructured.Unstructured, lookup NamespaceLabels) (bool, string, error) {
+	namespace := obj.GetNamespace()
+	isNamespace := obj.GetKind() == "Namespace" && obj.GetAPIVersion() == "v1"
+	if isNamespace {
+		namespace = obj.GetName()
+	}
+
+	if s.owner != "" && obj.GetNamespace() != s.owner {
+		return false, fmt.Sprintf("rule only applies to namespace %s", s.owner), nil
+	}
+	if s.owner != "" && deniedToNamespacedRules(obj.GetKind()) {
+		return false, fmt.Sprintf("namespaced rules do not apply to %s objects", obj.GetKind()), nil
+	}
+	if s.excludeNamespaces[namespace] {
+		return false, fmt.Sprintf("namespace %s is excluded", namespace), nil
+	}
+	if s.namespaces != nil && !s.namespaces[namespace] {
+		if namespace == "" {
+			return false, "cluster-scoped object has no namespace", nil
+		}
+		return false, fmt.Sprintf("namespace %s is not selected", namespace), nil
+	}
+	if s.labels != nil && !s.labels.Matches(labels.Set(obj.GetLabels())) {
+		return false, fmt.Sprintf("labels do not match %s", s.labels), nil
+	}
+
+	if s.namespaceLabels != nil {
+		var namespaceLabels labels.Set
+		switch {
+		case isNamespace:
+			namespaceLabels = obj.GetLabels()
+		case namespace == "":
+			return false, "cluster-scoped object has no namespace", nil
+		case lookup == nil:
+			return false, "", fmt.Errorf("namespaceSelector needs namespace labels, which are not available")
+		default:
+			var err error
+			namespaceLabels, err = lookup(namespace)
+			if err != nil {
+				return false, "", fmt.Errorf("failed to get labels of namespace %s: %w", namespace, err)
+			}
+		}
+		if !s.namespaceLabels.Matches(namespaceLabels) {
+			return false, fmt.Sprintf("namespace %s labels do not match %s", namespace, s.namespaceLabels), nil
+		}
+	}
+
+	return true, "", nil
+}
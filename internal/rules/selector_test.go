@@ -0,0 +1,263 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestSelectors(t *testing.T) {
+	namespaceLabels := map[string]labels.Set{
+		"dev-api":  {"env": "dev"},
+		"prod-api": {"env": "prod"},
+	}
+	lookup := func(namespace string) (labels.Set, error) {
+		l, ok := namespaceLabels[namespace]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return l, nil
+	}
+
+	newObj := func(apiVersion, kind, namespace, name string, objLabels map[string]string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		obj.SetLabels(objLabels)
+		return obj
+	}
+	pod := func(namespace string, objLabels map[string]string) *unstructured.Unstructured {
+		return newObj("v1", "Pod", namespace, "test-pod", objLabels)
+	}
+
+	tests := []struct {
+		name            string
+		rule            Rule
+		obj             *unstructured.Unstructured
+		want            bool
+		wantNotSelected string
+		wantErr         bool
+	}{
+		{
+			name: "namespace listed",
+			rule: Rule{Namespaces: []string{"dev-api", "staging-api"}},
+			obj:  pod("dev-api", nil),
+			want: true,
+		},
+		{
+			name:            "namespace not listed",
+			rule:            Rule{Namespaces: []string{"staging-api"}},
+			obj:             pod("dev-api", nil),
+			wantNotSelected: "namespace dev-api is not selected",
+		},
+		{
+			name:            "namespace excluded",
+			rule:            Rule{ExcludeNamespaces: []string{"dev-api"}},
+			obj:             pod("dev-api", nil),
+			wantNotSelected: "namespace dev-api is excluded",
+		},
+		{
+			name:            "exclude wins over include",
+			rule:            Rule{Namespaces: []string{"dev-api"}, ExcludeNamespaces: []string{"dev-api"}},
+			obj:             pod("dev-api", nil),
+			wantNotSelected: "namespace dev-api is excluded",
+		},
+		{
+			name: "label selector match",
+			rule: Rule{LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "preview"}}},
+			obj:  pod("dev-api", map[string]string{"app": "preview", "team": "a"}),
+			want: true,
+		},
+		{
+			name: "label selector expression",
+			rule: Rule{LabelSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "keep", Operator: metav1.LabelSelectorOpDoesNotExist},
+			}}},
+			obj:             pod("dev-api", map[string]string{"keep": "true"}),
+			wantNotSelected: "labels do not match !keep",
+		},
+		{
+			name: "namespace selector match",
+			rule: Rule{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "dev"}}},
+			obj:  pod("dev-api", nil),
+			want: true,
+		},
+		{
+			name:            "namespace selector mismatch",
+			rule:            Rule{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "dev"}}},
+			obj:             pod("prod-api", nil),
+			wantNotSelected: "namespace prod-api labels do not match env=dev",
+		},
+		{
+			name:    "namespace lookup failure",
+			rule:    Rule{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "dev"}}},
+			obj:     pod("unknown", nil),
+			wantErr: true,
+		},
+		{
+			name: "namespace object uses its own labels",
+			rule: Rule{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "dev"}}},
+			obj:  newObj("v1", "Namespace", "", "preview", map[string]string{"env": "dev"}),
+			want: true,
+		},
+		{
+			name: "namespace object matches its own name",
+			rule: Rule{Namespaces: []string{"preview"}},
+			obj:  newObj("v1", "Namespace", "", "preview", nil),
+			want: true,
+		},
+		{
+			name:            "cluster-scoped object with namespaces",
+			rule:            Rule{Namespaces: []string{"dev-api"}},
+			obj:             newObj("v1", "PersistentVolume", "", "pv-1", nil),
+			wantNotSelected: "cluster-scoped object has no namespace",
+		},
+		{
+			name: "cluster-scoped object with excluded namespaces",
+			rule: Rule{ExcludeNamespaces: []string{"dev-api"}},
+			obj:  newObj("v1", "PersistentVolume", "", "pv-1", nil),
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			rule.ID = "selected"
+			rule.Resources = []string{"*"}
+			rule.Expression = "true"
+			rule.TTL = "1h"
+
+			engine, err := New([]Rule{rule}, WithNamespaceLabels(lookup))
+			require.NoError(t, err)
+
+			traces := engine.Trace(context.Background(), tt.obj)
+			require.Len(t, traces, 1)
+			assert.Equal(t, tt.want, traces[0].Matched)
+			assert.Equal(t, tt.wantNotSelected, traces[0].NotSelected)
+			assert.Equal(t, tt.wantErr, traces[0].Err != nil)
+			if !tt.want {
+				assert.Empty(t, traces[0].Result, "the expression must not run for unselected objects")
+			}
+		})
+	}
+}
+
+func TestSelectorsSkipExpression(t *testing.T) {
+	// The expression fails on any pod, so no error proves it never ran
+	engine, err := New([]Rule{
+		{
+			ID:                "dev-only",
+			Resources:         []string{"pods"},
+			ExcludeNamespaces: []string{"kube-system"},
+			Expression:        "object.spec.missing == 1",
+			TTL:               "1h",
+		},
+	})
+	require.NoError(t, err)
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "Pod",
+		"metadata": map[string]interface{}{"name": "coredns", "namespace": "kube-system"},
+		"spec":     map[string]interface{}{},
+	}}
+	traces := engine.Trace(context.Background(), obj)
+	require.Len(t, traces, 1)
+	assert.NoError(t, traces[0].Err)
+	assert.Equal(t, "namespace kube-system is excluded", traces[0].NotSelected)
+}
+
+func TestNamespaceSelectorWithoutLookup(t *testing.T) {
+	engine, err := New([]Rule{{
+		ID:                "dev",
+		Resources:         []string{"pods"},
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "dev"}},
+		Expression:        "true",
+		TTL:               "1h",
+	}})
+	require.NoError(t, err)
+
+	obj := &unstructured.Unstructured{}
+	obj.SetKind("Pod")
+	obj.SetNamespace("dev-api")
+	match, err := engine.Match(context.Background(), obj)
+	require.NoError(t, err)
+	assert.Nil(t, match)
+}
+
+func TestInvalidSelector(t *testing.T) {
+	_, err := New([]Rule{{
+		ID:        "broken",
+		Resources: []string{"*"},
+		LabelSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "app", Operator: "Sometimes"},
+		}},
+		Expression: "true",
+		TTL:        "1h",
+	}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid labelSelector")
+	assert.Contains(t, err.Error(), "rule 'broken'")
+}
+
+func TestLoadSelectorsFromYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	content := `rules:
+  - id: previews
+    resources: ["deployments"]
+    namespaces: ["dev-api"]
+    excludeNamespaces: ["kube-system"]
+    labelSelector:
+      matchLabels:
+        app: preview
+    namespaceSelector:
+      matchExpressions:
+        - key: env
+          operator: In
+          values: ["dev", "staging"]
+    expression: "true"
+    ttl: 1d`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	engine, err := LoadFromFile(path)
+	require.NoError(t, err)
+	require.Len(t, engine.rules, 1)
+
+	rule := engine.rules[0].rule
+	assert.Equal(t, []string{"dev-api"}, rule.Namespaces)
+	assert.Equal(t, []string{"kube-system"}, rule.ExcludeNamespaces)
+	assert.Equal(t, map[string]string{"app": "preview"}, rule.LabelSelector.MatchLabels)
+	assert.Equal(t, "env in (dev,staging)", engine.rules[0].selector.namespaceLabels.String())
+}
+
+func TestNamespacedRuleDeniedKinds(t *testing.T) {
+	for _, resource := range []string{"roles", "RoleBinding", "resourcequotas", "limitranges", "networkpolicies"} {
+		_, err := New([]Rule{{ID: "team-a/cleanup", Namespace: "team-a", Resources: []string{"pods", resource}, Expression: "true", TTL: "1h"}})
+		assert.ErrorContains(t, err, "namespaced rules may not apply to", resource)
+	}
+
+	_, err := New([]Rule{{ID: "cleanup", Resources: []string{"roles"}, Expression: "true", TTL: "1h"}})
+	assert.NoError(t, err, "cluster rules may apply to any kind")
+
+	engine, err := New([]Rule{{ID: "team-a/everything", Namespace: "team-a", Resources: []string{"*"}, Expression: "true", TTL: "1h"}})
+	require.NoError(t, err)
+
+	for kind, wantMatch := range map[string]bool{"ConfigMap": true, "Role": false, "NetworkPolicy": false} {
+		obj := &unstructured.Unstructured{}
+		obj.SetKind(kind)
+		obj.SetNamespace("team-a")
+		match, err := engine.Match(context.Background(), obj)
+		require.NoError(t, err)
+		assert.Equal(t, wantMatch, match != nil, kind)
+	}
+}
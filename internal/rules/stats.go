@@ -0,0 +1,143 @@
+package rules
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/metrics"
+)
+
+// Stats counts how often each rule is evaluated, matches and fails. It is
+// keyed by rule ID, so that sharing it with WithStats keeps the counts when
+// an engine is rebuilt.
+type Stats struct {
+	mu    sync.RWMutex
+	rules map[string]*ruleCounters
+}
+
+type ruleCounters struct {
+	evaluations atomic.Int64
+	matches     atomic.Int64
+	errors      atomic.Int64
+	// latency is the total time spent evaluating the expression, in nanoseconds
+	latency atomic.Int64
+	// lastWarning is when an error was last logged as a warning, in Unix
+	// nanoseconds, and suppressed the number of errors logged at debug level since
+	lastWarning atomic.Int64
+	suppressed  atomic.Int64
+}
+
+// NewStats creates empty rule stats
+func NewStats() *Stats {
+	return &Stats{rules: make(map[string]*ruleCounters)}
+}
+
+// WithStats records rule evaluations in stats rather than in the engine's own
+func WithStats(stats *Stats) Option {
+	return func(e *Engine) {
+		e.stats = stats
+	}
+}
+
+func (s *Stats) counters(id string) *ruleCounters {
+	s.mu.RLock()
+	c, ok := s.rules[id]
+	s.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok = s.rules[id]; !ok {
+		c = &ruleCounters{}
+		s.rules[id] = c
+	}
+	return c
+}
+
+// record counts a trace whose expression was evaluated, in the stats and in
+// the kube_janitor_rule_* metrics
+func (s *Stats) record(trace RuleTrace) {
+	id := trace.Rule.ID
+	c := s.counters(id)
+	c.evaluations.Add(1)
+	c.latency.Add(int64(trace.Duration))
+	metrics.RuleEvaluations.WithLabelValues(id).Inc()
+	metrics.RuleEvaluationDuration.WithLabelValues(id).Observe(trace.Duration.Seconds())
+
+	if trace.Err != nil || trace.TTLErr != nil {
+		c.errors.Add(1)
+		metrics.RuleErrors.WithLabelValues(id).Inc()
+	}
+	if trace.Matched {
+		c.matches.Add(1)
+		metrics.RuleMatches.WithLabelValues(id).Inc()
+	}
+}
+
+// PruneStats drops the counts and the kube_janitor_rule_* series of the rules
+// that are not part of the engine, such as rules removed before a rebuild
+func (e *Engine) PruneStats() {
+	keep := make(map[string]bool, len(e.rules))
+	for _, rule := range e.rules {
+		keep[rule.rule.ID] = true
+	}
+
+	e.stats.mu.Lock()
+	defer e.stats.mu.Unlock()
+	for id := range e.stats.rules {
+		if keep[id] {
+			continue
+		}
+		delete(e.stats.rules, id)
+		metrics.RuleEvaluations.DeleteLabelValues(id)
+		metrics.RuleEvaluationDuration.DeleteLabelValues(id)
+		metrics.RuleErrors.DeleteLabelValues(id)
+		metrics.RuleMatches.DeleteLabelValues(id)
+	}
+}
+
+// RuleStats are the counts of a single rule
+type RuleStats struct {
+	Evaluations    int64
+	Matches        int64
+	Errors         int64
+	AverageLatency time.Duration
+}
+
+// Get returns the counts of a rule, which are zero if it was never evaluated
+func (s *Stats) Get(id string) RuleStats {
+	s.mu.RLock()
+	c, ok := s.rules[id]
+	s.mu.RUnlock()
+	if !ok {
+		return RuleStats{}
+	}
+
+	stats := RuleStats{
+		Evaluations: c.evaluations.Load(),
+		Matches:     c.matches.Load(),
+		Errors:      c.errors.Load(),
+	}
+	if stats.Evaluations > 0 {
+		stats.AverageLatency = time.Duration(c.latency.Load() / stats.Evaluations)
+	}
+	return stats
+}
+
+// RuleReport describes a rule of the engine along with its stats
+type RuleReport struct {
+	Rule  Rule
+	Stats RuleStats
+}
+
+// Report lists the engine's rules in evaluation order, with their stats
+func (e *Engine) Report() []RuleReport {
+	reports := make([]RuleReport, 0, len(e.rules))
+	for _, rule := range e.rules {
+		reports = append(reports, RuleReport{Rule: rule.rule, Stats: e.stats.Get(rule.rule.ID)})
+	}
+	return reports
+}
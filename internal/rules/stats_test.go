@@ -0,0 +1,103 @@
+package rules
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestStats(t *testing.T) {
+	ruleSet := []Rule{
+		{
+			ID:         "pr-pods",
+			Resources:  []string{"pods"},
+			Expression: `object.metadata.name.startsWith("pr-")`,
+			TTL:        "1h",
+		},
+		{
+			ID:         "bad-field",
+			Resources:  []string{"pods"},
+			Expression: `object.spec.missing == "x"`,
+			TTL:        "1h",
+		},
+		{
+			ID:         "dev-only",
+			Resources:  []string{"pods"},
+			Namespaces: []string{"dev"},
+			Expression: "true",
+			TTL:        "1h",
+		},
+		{
+			ID:         "deployments",
+			Resources:  []string{"deployments"},
+			Expression: "true",
+			TTL:        "1h",
+		},
+	}
+
+	pod := func(name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("Pod")
+		obj.SetNamespace("default")
+		obj.SetName(name)
+		obj.Object["spec"] = map[string]interface{}{}
+		return obj
+	}
+
+	stats := NewStats()
+	engine, err := New(ruleSet, WithStats(stats))
+	require.NoError(t, err)
+
+	match, err := engine.Match(context.Background(), pod("pr-1"))
+	require.NoError(t, err)
+	assert.NotNil(t, match)
+	match, err = engine.Match(context.Background(), pod("main"))
+	require.NoError(t, err)
+	assert.Nil(t, match)
+
+	got := stats.Get("pr-pods")
+	assert.Equal(t, int64(2), got.Evaluations)
+	assert.Equal(t, int64(1), got.Matches)
+	assert.Equal(t, int64(0), got.Errors)
+	assert.Positive(t, got.AverageLatency)
+
+	// Only evaluated when pr-pods did not match
+	got = stats.Get("bad-field")
+	assert.Equal(t, int64(1), got.Evaluations)
+	assert.Equal(t, int64(1), got.Errors)
+	assert.Equal(t, int64(0), got.Matches)
+
+	// Rules whose selectors or resources reject the object are not evaluated
+	assert.Equal(t, RuleStats{}, stats.Get("dev-only"))
+	assert.Equal(t, RuleStats{}, stats.Get("deployments"))
+
+	// Tracing, as explain does, is not counted
+	engine.Trace(context.Background(), pod("pr-2"))
+	assert.Equal(t, int64(2), stats.Get("pr-pods").Evaluations)
+
+	// Stats shared with a rebuilt engine keep their counts
+	rebuilt, err := New(ruleSet, WithStats(stats))
+	require.NoError(t, err)
+	rebuilt.Match(context.Background(), pod("pr-3"))
+	assert.Equal(t, int64(3), stats.Get("pr-pods").Evaluations)
+
+	reports := rebuilt.Report()
+	require.Len(t, reports, len(ruleSet))
+	for i, report := range reports {
+		assert.Equal(t, ruleSet[i].ID, report.Rule.ID)
+	}
+	assert.Equal(t, int64(2), reports[0].Stats.Matches)
+
+	// Rules dropped by a rebuild lose their counts and metrics
+	pruned, err := New(ruleSet[:1], WithStats(stats))
+	require.NoError(t, err)
+	pruned.PruneStats()
+	assert.Equal(t, int64(3), stats.Get("pr-pods").Evaluations)
+	assert.Equal(t, RuleStats{}, stats.Get("bad-field"))
+	assert.False(t, metrics.RuleEvaluations.DeleteLabelValues("bad-field"), "series already deleted")
+}
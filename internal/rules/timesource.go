@@ -0,0 +1,152 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/expires"
+	"github.com/blaxel-ai/kube-janitor-go/internal/fieldmanager"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// TimeFromCreation measures TTLs from the creation timestamp (the default)
+	TimeFromCreation = "creation"
+	// TimeFromLastUpdate measures TTLs from the newest managedFields entry
+	// that changed the object itself, ignoring status subresource updates
+	TimeFromLastUpdate = "lastUpdate"
+	// TimeFromManagedFields measures TTLs from the newest managedFields entry,
+	// including status updates made by controllers
+	TimeFromManagedFields = "managedFields"
+
+	timeFromAnnotationPrefix = "annotation:"
+	timeFromStatusPrefix     = "status:"
+	timeFromConditionPrefix  = "condition:"
+)
+
+// TimeSource selects the point in time a TTL is measured from. Anything other
+// than the creation time turns the TTL into an idle timeout.
+type TimeSource struct {
+	kind string
+	key  string
+	// location is used for annotation and status timestamps without a zone
+	location *time.Location
+}
+
+// ParseTimeSource parses creation, lastUpdate, managedFields,
+// annotation:<key>, status:<field.path> or condition:<type>. An empty string
+// means creation.
+func ParseTimeSource(s string) (TimeSource, error) {
+	switch {
+	case s == "" || s == TimeFromCreation:
+		return TimeSource{kind: TimeFromCreation}, nil
+	case s == TimeFromLastUpdate || s == TimeFromManagedFields:
+		return TimeSource{kind: s}, nil
+	case strings.HasPrefix(s, timeFromAnnotationPrefix) && len(s) > len(timeFromAnnotationPrefix):
+		return TimeSource{kind: timeFromAnnotationPrefix, key: strings.TrimPrefix(s, timeFromAnnotationPrefix)}, nil
+	case strings.HasPrefix(s, timeFromStatusPrefix) && len(s) > len(timeFromStatusPrefix):
+		return TimeSource{kind: timeFromStatusPrefix, key: strings.TrimPrefix(s, timeFromStatusPrefix)}, nil
+	case strings.HasPrefix(s, timeFromConditionPrefix) && len(s) > len(timeFromConditionPrefix):
+		return TimeSource{kind: timeFromConditionPrefix, key: strings.TrimPrefix(s, timeFromConditionPrefix)}, nil
+	default:
+		return TimeSource{}, fmt.Errorf("invalid time source '%s': must be one of %s, %s, %s, %s<key>, %s<field>, %s<type>",
+			s, TimeFromCreation, TimeFromLastUpdate, TimeFromManagedFields, timeFromAnnotationPrefix, timeFromStatusPrefix, timeFromConditionPrefix)
+	}
+}
+
+// String returns the time source in the form accepted by ParseTimeSource
+func (ts TimeSource) String() string {
+	switch ts.kind {
+	case "":
+		return TimeFromCreation
+	case timeFromAnnotationPrefix, timeFromStatusPrefix, timeFromConditionPrefix:
+		return ts.kind + ts.key
+	default:
+		return ts.kind
+	}
+}
+
+// In returns the time source with annotation and status timestamps that
+// have no zone interpreted in the given location
+func (ts TimeSource) In(location *time.Location) TimeSource {
+	ts.location = location
+	return ts
+}
+
+// IsCreation reports whether TTLs are measured from the creation timestamp
+func (ts TimeSource) IsCreation() bool {
+	return ts.kind == "" || ts.kind == TimeFromCreation
+}
+
+// Resolve returns the time to measure the TTL from. It falls back to the
+// creation timestamp when the source has no usable value on the object.
+func (ts TimeSource) Resolve(obj *unstructured.Unstructured) time.Time {
+	created := obj.GetCreationTimestamp().Time
+
+	var (
+		t   time.Time
+		err error
+	)
+	parser := expires.Parser{Location: ts.location}
+	switch ts.kind {
+	case TimeFromLastUpdate:
+		t = newestManagedFieldsTime(obj, false)
+	case TimeFromManagedFields:
+		t = newestManagedFieldsTime(obj, true)
+	case timeFromAnnotationPrefix:
+		if value, ok := obj.GetAnnotations()[ts.key]; ok {
+			t, err = parser.Parse(value, created)
+		}
+	case timeFromStatusPrefix:
+		path := append([]string{"status"}, strings.Split(ts.key, ".")...)
+		if value, ok, _ := unstructured.NestedString(obj.Object, path...); ok {
+			t, err = parser.Parse(value, created)
+		}
+	case timeFromConditionPrefix:
+		if value, ok := conditionTransitionTime(obj, ts.key); ok {
+			t, err = parser.Parse(value, created)
+		}
+	}
+
+	if err != nil {
+		logrus.WithError(err).WithField("timeSource", ts.String()).Warn("Invalid timestamp for TTL time source")
+	}
+	if t.IsZero() || t.Before(created) {
+		return created
+	}
+	return t
+}
+
+// conditionTransitionTime returns the lastTransitionTime of the status
+// condition of the given type
+func conditionTransitionTime(obj *unstructured.Unstructured, conditionType string) (string, bool) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, _ := c.(map[string]interface{})
+		if condition["type"] == conditionType {
+			value, ok := condition["lastTransitionTime"].(string)
+			return value, ok
+		}
+	}
+	return "", false
+}
+
+// newestManagedFieldsTime returns the newest managedFields timestamp not
+// written by the janitor itself
+func newestManagedFieldsTime(obj *unstructured.Unstructured, includeStatus bool) time.Time {
+	var newest time.Time
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager == fieldmanager.Name || entry.Time == nil {
+			continue
+		}
+		if !includeStatus && entry.Subresource == "status" {
+			continue
+		}
+		if entry.Time.After(newest) {
+			newest = entry.Time.Time
+		}
+	}
+	return newest
+}
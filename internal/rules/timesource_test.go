@@ -0,0 +1,157 @@
+package rules
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/internal/fieldmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseTimeSource(t *testing.T) {
+	tests := []struct {
+		input     string
+		want      string
+		wantError bool
+	}{
+		{input: "", want: "creation"},
+		{input: "creation", want: "creation"},
+		{input: "lastUpdate", want: "lastUpdate"},
+		{input: "managedFields", want: "managedFields"},
+		{input: "annotation:example.com/last-used", want: "annotation:example.com/last-used"},
+		{input: "status:completionTime", want: "status:completionTime"},
+		{input: "condition:Ready", want: "condition:Ready"},
+		{input: "annotation:", wantError: true},
+		{input: "status:", wantError: true},
+		{input: "condition:", wantError: true},
+		{input: "lastupdate", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseTimeSource(tt.input)
+			if tt.wantError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.String())
+		})
+	}
+}
+
+func TestTimeSourceResolve(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	specUpdate := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+	statusUpdate := time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC)
+	janitorUpdate := time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)
+
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":              "test",
+				"creationTimestamp": created.Format(time.RFC3339),
+				"annotations": map[string]interface{}{
+					"example.com/last-used": "2024-01-03T00:00:00Z",
+					"example.com/invalid":   "yesterday",
+					"example.com/too-early": "2023-01-01T00:00:00Z",
+				},
+				"managedFields": []interface{}{
+					map[string]interface{}{
+						"manager":   "kubectl",
+						"operation": "Update",
+						"time":      specUpdate.Format(time.RFC3339),
+					},
+					map[string]interface{}{
+						"manager":     "kube-controller-manager",
+						"operation":   "Update",
+						"subresource": "status",
+						"time":        statusUpdate.Format(time.RFC3339),
+					},
+					map[string]interface{}{
+						"manager":   fieldmanager.Name,
+						"operation": "Update",
+						"time":      janitorUpdate.Format(time.RFC3339),
+					},
+				},
+			},
+			"status": map[string]interface{}{
+				"completionTime": "2024-01-04T00:00:00Z",
+				"conditions": []interface{}{
+					map[string]interface{}{
+						"type":               "Complete",
+						"status":             "True",
+						"lastTransitionTime": "2024-01-02T00:00:00Z",
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		source string
+		want   time.Time
+	}{
+		{source: "creation", want: created},
+		{source: "lastUpdate", want: specUpdate},
+		{source: "managedFields", want: statusUpdate},
+		{source: "annotation:example.com/last-used", want: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{source: "annotation:example.com/missing", want: created},
+		{source: "annotation:example.com/invalid", want: created},
+		{source: "annotation:example.com/too-early", want: created},
+		{source: "status:completionTime", want: time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{source: "status:startTime", want: created},
+		{source: "condition:Complete", want: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{source: "condition:Failed", want: created},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			source, err := ParseTimeSource(tt.source)
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(source.Resolve(obj)), "got %s, want %s", source.Resolve(obj), tt.want)
+		})
+	}
+}
+
+func TestEvaluateRuleTimeSource(t *testing.T) {
+	_, err := New([]Rule{{ID: "idle", Resources: []string{"*"}, Expression: "true", TTL: "1h", TTLFrom: "idle"}})
+	assert.ErrorContains(t, err, "invalid ttlFrom")
+
+	engine, err := New([]Rule{{ID: "idle", Resources: []string{"*"}, Expression: "true", TTL: "1h", TTLFrom: "lastUpdate"}})
+	require.NoError(t, err)
+
+	match, err := engine.Match(context.Background(), &unstructured.Unstructured{Object: map[string]interface{}{"kind": "Pod"}})
+	require.NoError(t, err)
+	require.NotNil(t, match)
+	assert.Equal(t, "lastUpdate", match.TimeSource.String())
+}
+
+func TestTimeSourceDefaultTimezone(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+
+	engine, err := New([]Rule{
+		{ID: "last-used", Resources: []string{"*"}, Expression: "true", TTL: "1h", TTLFrom: "annotation:example.com/last-used"},
+	}, WithDefaultTimezone(paris))
+	require.NoError(t, err)
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Pod",
+		"metadata": map[string]interface{}{
+			"creationTimestamp": "2024-01-01T00:00:00Z",
+			"annotations": map[string]interface{}{
+				"example.com/last-used": "2024-01-03 12:00",
+			},
+		},
+	}}
+
+	match, err := engine.Match(context.Background(), obj)
+	require.NoError(t, err)
+	require.NotNil(t, match)
+	want := time.Date(2024, 1, 3, 12, 0, 0, 0, paris)
+	assert.True(t, want.Equal(match.TimeSource.Resolve(obj)), "got %s, want %s", match.TimeSource.Resolve(obj), want)
+}
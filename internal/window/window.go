@@ -0,0 +1,216 @@
+package window
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Window is a set of cron expressions describing when deletions are allowed.
+// A point in time is inside the window if its minute matches any expression.
+type Window struct {
+	spec  string
+	exprs []expression
+}
+
+type expression struct {
+	location *time.Location
+	minute   uint64
+	hour     uint64
+	dom      uint64
+	month    uint64
+	dow      uint64
+	// domStar and dowStar record unrestricted day fields, which changes how
+	// day-of-month and day-of-week combine (see matches)
+	domStar bool
+	dowStar bool
+}
+
+type field struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Day of week accepts 7 as an alias for Sunday
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// Parse parses one or more five-field cron expressions separated by ";".
+// Each expression may be prefixed with CRON_TZ=<zone> or TZ=<zone>;
+// expressions without a zone are evaluated in UTC.
+//
+// Example: "CRON_TZ=Europe/Paris * 0-7,19-23 * * mon-fri; CRON_TZ=Europe/Paris * * * * sat,sun"
+func Parse(spec string) (*Window, error) {
+	w := &Window{spec: spec}
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		expr, err := parseExpression(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression '%s': %w", part, err)
+		}
+		w.exprs = append(w.exprs, expr)
+	}
+
+	if len(w.exprs) == 0 {
+		return nil, fmt.Errorf("empty deletion window")
+	}
+	return w, nil
+}
+
+// Contains reports whether the given time is inside the window
+func (w *Window) Contains(t time.Time) bool {
+	for _, expr := range w.exprs {
+		if expr.matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the expression the window was parsed from
+func (w *Window) String() string {
+	return w.spec
+}
+
+func parseExpression(s string) (expression, error) {
+	expr := expression{location: time.UTC}
+
+	fields := strings.Fields(s)
+	if len(fields) > 0 {
+		for _, prefix := range []string{"CRON_TZ=", "TZ="} {
+			if !strings.HasPrefix(fields[0], prefix) {
+				continue
+			}
+			location, err := time.LoadLocation(strings.TrimPrefix(fields[0], prefix))
+			if err != nil {
+				return expression{}, fmt.Errorf("invalid timezone: %w", err)
+			}
+			expr.location = location
+			fields = fields[1:]
+			break
+		}
+	}
+
+	if len(fields) != 5 {
+		return expression{}, fmt.Errorf("expected 5 fields (minute hour day-of-month month day-of-week), got %d", len(fields))
+	}
+
+	var err error
+	if expr.minute, err = parseField(fields[0], minuteField); err != nil {
+		return expression{}, err
+	}
+	if expr.hour, err = parseField(fields[1], hourField); err != nil {
+		return expression{}, err
+	}
+	if expr.dom, err = parseField(fields[2], domField); err != nil {
+		return expression{}, err
+	}
+	if expr.month, err = parseField(fields[3], monthField); err != nil {
+		return expression{}, err
+	}
+	if expr.dow, err = parseField(fields[4], dowField); err != nil {
+		return expression{}, err
+	}
+	if expr.dow&(1<<7) != 0 {
+		expr.dow |= 1
+	}
+	expr.domStar = fields[2] == "*"
+	expr.dowStar = fields[4] == "*"
+
+	return expr, nil
+}
+
+// parseField parses a comma separated list of values, ranges and steps into a bit set
+func parseField(s string, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field: %s", f.name, part)
+			}
+			rangePart, step = part[:i], n
+		}
+
+		var low, high int
+		switch {
+		case rangePart == "*":
+			low, high = f.min, f.max
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if low, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if high, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range in %s field: %s", f.name, rangePart)
+			}
+		default:
+			value, err := f.value(rangePart)
+			if err != nil {
+				return 0, err
+			}
+			low, high = value, value
+			if step > 1 {
+				high = f.max
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s: %s (must be %d-%d)", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (e expression) matches(t time.Time) bool {
+	t = t.In(e.location)
+	if e.minute&(1<<uint(t.Minute())) == 0 ||
+		e.hour&(1<<uint(t.Hour())) == 0 ||
+		e.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	domMatch := e.dom&(1<<uint(t.Day())) != 0
+	dowMatch := e.dow&(1<<uint(t.Weekday())) != 0
+
+	// As in standard cron, when both day fields are restricted a day matches
+	// if either of them does
+	if !e.domStar && !e.dowStar {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
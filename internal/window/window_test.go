@@ -0,0 +1,127 @@
+package window
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      string
+		wantError bool
+	}{
+		{name: "every minute", spec: "* * * * *"},
+		{name: "ranges and lists", spec: "0-30/5 0-7,19-23 * * 1-5"},
+		{name: "names", spec: "* * * jan-mar sat,sun"},
+		{name: "timezone", spec: "CRON_TZ=Europe/Paris * 9-17 * * *"},
+		{name: "multiple expressions", spec: "* 0-7 * * mon-fri; * * * * sat,sun"},
+		{name: "sunday as 7", spec: "* * * * 7"},
+		{name: "empty", spec: " ; ", wantError: true},
+		{name: "too few fields", spec: "* * * *", wantError: true},
+		{name: "out of range", spec: "* 24 * * *", wantError: true},
+		{name: "inverted range", spec: "* 10-5 * * *", wantError: true},
+		{name: "invalid step", spec: "*/0 * * * *", wantError: true},
+		{name: "unknown name", spec: "* * * * funday", wantError: true},
+		{name: "unknown timezone", spec: "TZ=Mars/Olympus * * * * *", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := Parse(tt.spec)
+			if tt.wantError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.spec, w.String())
+		})
+	}
+}
+
+func TestContains(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+
+	// Outside business hours in Paris: weekday nights and weekends
+	offHours := "CRON_TZ=Europe/Paris * 0-8,18-23 * * mon-fri; CRON_TZ=Europe/Paris * * * * sat,sun"
+
+	tests := []struct {
+		name string
+		spec string
+		time time.Time
+		want bool
+	}{
+		{
+			name: "weekday business hours",
+			spec: offHours,
+			time: time.Date(2024, 3, 13, 14, 0, 0, 0, paris), // Wednesday
+			want: false,
+		},
+		{
+			name: "weekday evening",
+			spec: offHours,
+			time: time.Date(2024, 3, 13, 19, 30, 0, 0, paris),
+			want: true,
+		},
+		{
+			name: "weekend afternoon",
+			spec: offHours,
+			time: time.Date(2024, 3, 16, 14, 0, 0, 0, paris), // Saturday
+			want: true,
+		},
+		{
+			name: "timezone is applied",
+			spec: offHours,
+			time: time.Date(2024, 3, 13, 17, 30, 0, 0, time.UTC), // 18:30 in Paris
+			want: true,
+		},
+		{
+			name: "UTC by default",
+			spec: "* 9-17 * * *",
+			time: time.Date(2024, 3, 13, 18, 30, 0, 0, paris), // 17:30 UTC
+			want: true,
+		},
+		{
+			name: "step",
+			spec: "*/15 * * * *",
+			time: time.Date(2024, 3, 13, 10, 45, 0, 0, time.UTC),
+			want: true,
+		},
+		{
+			name: "step miss",
+			spec: "*/15 * * * *",
+			time: time.Date(2024, 3, 13, 10, 46, 0, 0, time.UTC),
+			want: false,
+		},
+		{
+			name: "day of month or day of week",
+			spec: "* * 1 * sun",
+			time: time.Date(2024, 3, 17, 10, 0, 0, 0, time.UTC), // Sunday the 17th
+			want: true,
+		},
+		{
+			name: "sunday as 7",
+			spec: "* * * * 7",
+			time: time.Date(2024, 3, 17, 10, 0, 0, 0, time.UTC),
+			want: true,
+		},
+		{
+			name: "month",
+			spec: "* * * dec *",
+			time: time.Date(2024, 3, 17, 10, 0, 0, 0, time.UTC),
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := Parse(tt.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, w.Contains(tt.time))
+		})
+	}
+}
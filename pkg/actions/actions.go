@@ -0,0 +1,194 @@
+// Package actions implements what the janitor does to expired objects.
+// Besides the built-in actions, downstream code can register its own with
+// Register, for rules to select by name.
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// Names of the built-in actions
+const (
+	// Delete deletes the object (default)
+	Delete = "delete"
+	// Patch applies a JSON merge patch to the object, e.g. to add a label
+	Patch = "patch"
+	// Suspend suspends a Job or CronJob
+	Suspend = "suspend"
+	// Webhook posts the object to an external endpoint
+	Webhook = "webhook"
+	// ScaleDown scales the object to zero replicas through its scale
+	// subresource, keeping it for later
+	ScaleDown = "scale-down"
+)
+
+// Action is taken on objects once they expire. Actions are taken on every
+// cleanup run for as long as the object stays expired, so they should report
+// an unchanged result for objects they already acted on.
+type Action interface {
+	Run(ctx context.Context, env Env, target Target) (Result, error)
+}
+
+// Env is what actions may use to act on objects
+type Env struct {
+	Client dynamic.Interface
+	// FieldManager is set on every write
+	FieldManager string
+	// DryRun asks actions to only report what they would do
+	DryRun bool
+}
+
+// Target is an expired object
+type Target struct {
+	Resource  schema.GroupVersionResource
+	Namespace string
+	Name      string
+	Object    *unstructured.Unstructured
+	// Reason tells why the object expired
+	Reason string
+}
+
+// String names the object in messages, e.g. "deployments team-a/web"
+func (t Target) String() string {
+	return fmt.Sprintf("%s %s/%s", t.Resource.Resource, t.Namespace, t.Name)
+}
+
+func (t Target) client(env Env) dynamic.ResourceInterface {
+	if t.Namespace == "" {
+		return env.Client.Resource(t.Resource)
+	}
+	return env.Client.Resource(t.Resource).Namespace(t.Namespace)
+}
+
+// patch applies a JSON merge patch to the object or one of its subresources
+func (t Target) patch(ctx context.Context, env Env, patch interface{}, subresources ...string) error {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	_, err = t.client(env).Patch(ctx, t.Name, types.MergePatchType, data,
+		metav1.PatchOptions{FieldManager: env.FieldManager}, subresources...)
+	return err
+}
+
+// Result describes what an action did
+type Result struct {
+	// Changed is false when the object needed no change, in which case
+	// nothing is reported
+	Changed bool
+	// Event is the reason of the event reporting the change
+	Event string
+	// Message describes the change, the reason the object expired is
+	// appended to it
+	Message string
+}
+
+// Factory creates an action from the actionParams of a rule
+type Factory func(params map[string]string) (Action, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{
+		Delete:    noParams(NewDelete),
+		Patch:     newPatchFromParams,
+		Suspend:   noParams(NewSuspend),
+		Webhook:   newWebhookFromParams,
+		ScaleDown: noParams(NewScaleDown),
+	}
+)
+
+// Register makes an action available to rules under the given name. It is
+// meant to be called from init functions and panics if the name is taken.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("action '%s' is already registered", name))
+	}
+	registry[name] = factory
+}
+
+// New creates the named action, delete if the name is empty
+func New(name string, params map[string]string) (Action, error) {
+	if name == "" {
+		name = Delete
+	}
+
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("must be one of %s", strings.Join(Names(), ", "))
+	}
+	return factory(params)
+}
+
+// Names lists the registered actions
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// noParams adapts the constructor of an action without parameters
+func noParams(newAction func() Action) Factory {
+	return func(params map[string]string) (Action, error) {
+		if err := checkParams(params); err != nil {
+			return nil, err
+		}
+		return newAction(), nil
+	}
+}
+
+// checkParams rejects the parameters an action does not know, which are
+// likely typos
+func checkParams(params map[string]string, known ...string) error {
+	for name := range params {
+		if !contains(known, name) {
+			return fmt.Errorf("unknown parameter '%s'", name)
+		}
+	}
+	return nil
+}
+
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
+
+type deleteAction struct{}
+
+// NewDelete returns the action deleting objects
+func NewDelete() Action {
+	return deleteAction{}
+}
+
+func (deleteAction) Run(ctx context.Context, env Env, target Target) (Result, error) {
+	if env.DryRun {
+		return Result{Changed: true, Event: "DryRunDeletion", Message: "DRY RUN: Would delete " + target.String()}, nil
+	}
+	if err := target.client(env).Delete(ctx, target.Name, metav1.DeleteOptions{}); err != nil {
+		return Result{}, err
+	}
+	return Result{Changed: true, Event: "ResourceDeleted", Message: "Deleted " + target.String()}, nil
+}
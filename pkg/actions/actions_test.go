@@ -0,0 +1,112 @@
+package actions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+var podsGVR = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+func newPod(labels map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]interface{}{
+			"name":      "web",
+			"namespace": "default",
+			"uid":       "1234",
+			"labels":    labels,
+		},
+	}}
+}
+
+func podTarget(obj *unstructured.Unstructured) Target {
+	return Target{Resource: podsGVR, Namespace: "default", Name: "web", Object: obj, Reason: "TTL expired"}
+}
+
+type nopAction struct{}
+
+func (nopAction) Run(context.Context, Env, Target) (Result, error) { return Result{}, nil }
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  string
+		params  map[string]string
+		wantErr string
+	}{
+		{name: "default", action: ""},
+		{name: "delete", action: Delete},
+		{name: "scale-down", action: ScaleDown},
+		{name: "suspend", action: Suspend},
+		{name: "patch", action: Patch, params: map[string]string{"patch": `{"metadata":{"labels":{"expired":"true"}}}`}},
+		{name: "webhook", action: Webhook, params: map[string]string{"url": "https://example.com/expired"}},
+		{name: "unknown", action: "hibernate", wantErr: "must be one of delete, patch, scale-down, suspend, webhook"},
+		{name: "unknown parameter", action: Delete, params: map[string]string{"force": "true"}, wantErr: "unknown parameter 'force'"},
+		{name: "missing patch", action: Patch, wantErr: "missing parameter 'patch'"},
+		{name: "invalid patch", action: Patch, params: map[string]string{"patch": `["op"]`}, wantErr: "the patch must be a JSON object"},
+		{name: "missing url", action: Webhook, wantErr: "missing parameter 'url'"},
+		{name: "invalid url scheme", action: Webhook, params: map[string]string{"url": "ftp://example.com"}, wantErr: "must be http or https"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := New(tt.action, tt.params)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, action)
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("test-nop", func(map[string]string) (Action, error) { return nopAction{}, nil })
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, "test-nop")
+		registryMu.Unlock()
+	})
+
+	assert.Contains(t, Names(), "test-nop")
+	action, err := New("test-nop", nil)
+	require.NoError(t, err)
+	assert.Equal(t, nopAction{}, action)
+
+	assert.Panics(t, func() {
+		Register(Delete, func(map[string]string) (Action, error) { return nopAction{}, nil })
+	})
+}
+
+func TestDelete(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		pod := newPod(nil)
+		client := fake.NewSimpleDynamicClient(runtime.NewScheme(), pod)
+
+		result, err := NewDelete().Run(context.Background(), Env{Client: client, DryRun: dryRun}, podTarget(pod))
+		require.NoError(t, err)
+		assert.True(t, result.Changed)
+
+		_, err = client.Resource(podsGVR).Namespace("default").Get(context.Background(), "web", metav1.GetOptions{})
+		if dryRun {
+			assert.Equal(t, "DryRunDeletion", result.Event)
+			assert.Equal(t, "DRY RUN: Would delete pods default/web", result.Message)
+			assert.NoError(t, err)
+		} else {
+			assert.Equal(t, "ResourceDeleted", result.Event)
+			assert.Equal(t, "Deleted pods default/web", result.Message)
+			assert.True(t, apierrors.IsNotFound(err))
+		}
+	}
+}
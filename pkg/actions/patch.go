@@ -0,0 +1,99 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type patchAction struct {
+	patch []byte
+}
+
+// NewPatch returns an action applying a JSON merge patch to objects
+func NewPatch(patch []byte) (Action, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(patch, &fields); err != nil {
+		return nil, fmt.Errorf("the patch must be a JSON object: %w", err)
+	}
+	return patchAction{patch: patch}, nil
+}
+
+func newPatchFromParams(params map[string]string) (Action, error) {
+	if err := checkParams(params, "patch"); err != nil {
+		return nil, err
+	}
+	patch, ok := params["patch"]
+	if !ok {
+		return nil, errors.New("missing parameter 'patch'")
+	}
+	return NewPatch([]byte(patch))
+}
+
+func (a patchAction) Run(ctx context.Context, env Env, target Target) (Result, error) {
+	changed, err := patchChanges(target.Object, a.patch)
+	if err != nil {
+		return Result{}, err
+	}
+	if !changed {
+		return Result{}, nil
+	}
+	if env.DryRun {
+		return Result{Changed: true, Event: "DryRunPatch", Message: "DRY RUN: Would patch " + target.String()}, nil
+	}
+	if err := target.patch(ctx, env, json.RawMessage(a.patch)); err != nil {
+		return Result{}, err
+	}
+	return Result{Changed: true, Event: "ResourcePatched", Message: "Patched " + target.String()}, nil
+}
+
+// patchChanges reports whether a merge patch would change the object
+func patchChanges(obj *unstructured.Unstructured, patch []byte) (bool, error) {
+	original, err := obj.MarshalJSON()
+	if err != nil {
+		return false, err
+	}
+	patched, err := jsonpatch.MergePatch(original, patch)
+	if err != nil {
+		return false, fmt.Errorf("failed to apply patch: %w", err)
+	}
+
+	var before, after interface{}
+	if err := json.Unmarshal(original, &before); err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(patched, &after); err != nil {
+		return false, err
+	}
+	return !reflect.DeepEqual(before, after), nil
+}
+
+type suspendAction struct{}
+
+// NewSuspend returns the action suspending Jobs and CronJobs
+func NewSuspend() Action {
+	return suspendAction{}
+}
+
+func (suspendAction) Run(ctx context.Context, env Env, target Target) (Result, error) {
+	if target.Resource.Group != "batch" || (target.Resource.Resource != "jobs" && target.Resource.Resource != "cronjobs") {
+		return Result{}, fmt.Errorf("only jobs and cronjobs can be suspended")
+	}
+	if suspended, _, _ := unstructured.NestedBool(target.Object.Object, "spec", "suspend"); suspended {
+		return Result{}, nil
+	}
+	if env.DryRun {
+		return Result{Changed: true, Event: "DryRunSuspend", Message: "DRY RUN: Would suspend " + target.String()}, nil
+	}
+
+	patch := map[string]interface{}{"spec": map[string]interface{}{"suspend": true}}
+	if err := target.patch(ctx, env, patch); err != nil {
+		return Result{}, err
+	}
+	return Result{Changed: true, Event: "ResourceSuspended", Message: "Suspended " + target.String()}, nil
+}
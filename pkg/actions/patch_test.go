@@ -0,0 +1,97 @@
+package actions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func TestPatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		labels      map[string]interface{}
+		dryRun      bool
+		wantChanged bool
+		wantEvent   string
+		wantLabel   string
+	}{
+		{name: "patched", wantChanged: true, wantEvent: "ResourcePatched", wantLabel: "true"},
+		{name: "dry run", dryRun: true, wantChanged: true, wantEvent: "DryRunPatch"},
+		{name: "already patched", labels: map[string]interface{}{"expired": "true"}, wantLabel: "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newPod(tt.labels)
+			client := fake.NewSimpleDynamicClient(runtime.NewScheme(), pod)
+
+			action, err := NewPatch([]byte(`{"metadata":{"labels":{"expired":"true"}}}`))
+			require.NoError(t, err)
+			result, err := action.Run(context.Background(), Env{Client: client, DryRun: tt.dryRun}, podTarget(pod))
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantChanged, result.Changed)
+			assert.Equal(t, tt.wantEvent, result.Event)
+
+			got, err := client.Resource(podsGVR).Namespace("default").Get(context.Background(), "web", metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantLabel, got.GetLabels()["expired"])
+		})
+	}
+}
+
+func TestSuspend(t *testing.T) {
+	jobs := schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}
+
+	tests := []struct {
+		name        string
+		resource    schema.GroupVersionResource
+		suspended   bool
+		dryRun      bool
+		wantChanged bool
+		wantEvent   string
+		wantPatch   bool
+		wantErr     string
+	}{
+		{name: "suspended", resource: jobs, wantChanged: true, wantEvent: "ResourceSuspended", wantPatch: true},
+		{name: "dry run", resource: jobs, dryRun: true, wantChanged: true, wantEvent: "DryRunSuspend"},
+		{name: "already suspended", resource: jobs, suspended: true},
+		{name: "not a job", resource: podsGVR, wantErr: "only jobs and cronjobs can be suspended"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "batch/v1",
+				"kind":       "Job",
+				"metadata":   map[string]interface{}{"name": "web", "namespace": "default"},
+				"spec":       map[string]interface{}{"suspend": tt.suspended},
+			}}
+			client := fake.NewSimpleDynamicClient(runtime.NewScheme(), job)
+			var patched bool
+			client.PrependReactor("patch", "jobs", func(action ktesting.Action) (bool, runtime.Object, error) {
+				assert.JSONEq(t, `{"spec":{"suspend":true}}`, string(action.(ktesting.PatchAction).GetPatch()))
+				patched = true
+				return true, job, nil
+			})
+
+			target := Target{Resource: tt.resource, Namespace: "default", Name: "web", Object: job}
+			result, err := NewSuspend().Run(context.Background(), Env{Client: client, DryRun: tt.dryRun}, target)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantChanged, result.Changed)
+			assert.Equal(t, tt.wantEvent, result.Event)
+			assert.Equal(t, tt.wantPatch, patched)
+		})
+	}
+}
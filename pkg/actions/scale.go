@@ -0,0 +1,63 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// AnnotationPreviousReplicas records the replica count of a scaled down
+// object, for the scale-up command to restore
+const AnnotationPreviousReplicas = "janitor/previous-replicas"
+
+type scaleDownAction struct{}
+
+// NewScaleDown returns the action scaling objects to zero replicas. Objects
+// already at zero are left alone, so that they are only scaled down once.
+func NewScaleDown() Action {
+	return scaleDownAction{}
+}
+
+func (scaleDownAction) Run(ctx context.Context, env Env, target Target) (Result, error) {
+	scale, err := target.client(env).Get(ctx, target.Name, metav1.GetOptions{}, "scale")
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to get scale: %w", err)
+	}
+	replicas, _, err := unstructured.NestedInt64(scale.Object, "spec", "replicas")
+	if err != nil {
+		return Result{}, fmt.Errorf("invalid scale: %w", err)
+	}
+	if replicas == 0 {
+		return Result{}, nil
+	}
+	if env.DryRun {
+		return Result{
+			Changed: true,
+			Event:   "DryRunScaleDown",
+			Message: fmt.Sprintf("DRY RUN: Would scale down %s from %d replicas", target, replicas),
+		}, nil
+	}
+
+	// Record the replica count first, so that it is never lost
+	if err := target.patch(ctx, env, map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{AnnotationPreviousReplicas: strconv.FormatInt(replicas, 10)},
+		},
+	}); err != nil {
+		return Result{}, fmt.Errorf("failed to record replicas: %w", err)
+	}
+	if err := target.patch(ctx, env, map[string]interface{}{
+		"spec": map[string]interface{}{"replicas": 0},
+	}, "scale"); err != nil {
+		return Result{}, fmt.Errorf("failed to scale: %w", err)
+	}
+
+	return Result{
+		Changed: true,
+		Event:   "ResourceScaledDown",
+		Message: fmt.Sprintf("Scaled down %s from %d replicas", target, replicas),
+	}, nil
+}
@@ -0,0 +1,108 @@
+package actions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func TestScaleDown(t *testing.T) {
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+	tests := []struct {
+		name         string
+		replicas     int64
+		noScale      bool
+		dryRun       bool
+		wantChanged  bool
+		wantScaled   bool
+		wantMessage  string
+		wantPrevious string
+		wantErr      string
+	}{
+		{
+			name:         "scaled down",
+			replicas:     2,
+			wantChanged:  true,
+			wantScaled:   true,
+			wantMessage:  "Scaled down deployments default/web from 2 replicas",
+			wantPrevious: "2",
+		},
+		{
+			name:        "dry run",
+			replicas:    2,
+			dryRun:      true,
+			wantChanged: true,
+			wantMessage: "DRY RUN: Would scale down deployments default/web from 2 replicas",
+		},
+		{
+			name:     "already scaled down",
+			replicas: 0,
+		},
+		{
+			name:    "no scale subresource",
+			noScale: true,
+			wantErr: "failed to get scale",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]interface{}{"name": "web", "namespace": "default"},
+			}}
+
+			client := fake.NewSimpleDynamicClient(runtime.NewScheme(), deployment)
+			client.PrependReactor("get", "deployments", func(action ktesting.Action) (bool, runtime.Object, error) {
+				if action.GetSubresource() != "scale" {
+					return false, nil, nil
+				}
+				if tt.noScale {
+					return true, nil, apierrors.NewNotFound(schema.GroupResource{Group: "apps", Resource: "deployments/scale"}, "web")
+				}
+				return true, &unstructured.Unstructured{Object: map[string]interface{}{
+					"apiVersion": "autoscaling/v1",
+					"kind":       "Scale",
+					"spec":       map[string]interface{}{"replicas": tt.replicas},
+				}}, nil
+			})
+			var scaled bool
+			client.PrependReactor("patch", "deployments", func(action ktesting.Action) (bool, runtime.Object, error) {
+				if action.GetSubresource() != "scale" {
+					return false, nil, nil
+				}
+				assert.JSONEq(t, `{"spec":{"replicas":0}}`, string(action.(ktesting.PatchAction).GetPatch()))
+				scaled = true
+				return true, deployment, nil
+			})
+
+			target := Target{Resource: deployments, Namespace: "default", Name: "web", Object: deployment}
+			result, err := NewScaleDown().Run(context.Background(), Env{Client: client, DryRun: tt.dryRun}, target)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantChanged, result.Changed)
+			assert.Equal(t, tt.wantMessage, result.Message)
+			assert.Equal(t, tt.wantScaled, scaled)
+
+			got, err := client.Resource(deployments).Namespace("default").Get(context.Background(), "web", metav1.GetOptions{})
+			require.NoError(t, err)
+			previous, ok := got.GetAnnotations()[AnnotationPreviousReplicas]
+			assert.Equal(t, tt.wantPrevious != "", ok, "previous replicas annotation")
+			assert.Equal(t, tt.wantPrevious, previous)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/blaxel-ai/kube-janitor-go/pkg/manifest"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// AnnotationWebhookCalled records when the webhook action was called for an
+// object, so that it is called once
+const AnnotationWebhookCalled = "janitor/webhook-called"
+
+type webhookAction struct {
+	url    string
+	client *http.Client
+}
+
+// WebhookPayload is posted by the webhook action. Object has no status or
+// server-managed metadata, and never holds the data of a Secret.
+type WebhookPayload struct {
+	Group     string                 `json:"group"`
+	Version   string                 `json:"version"`
+	Resource  string                 `json:"resource"`
+	Namespace string                 `json:"namespace,omitempty"`
+	Name      string                 `json:"name"`
+	UID       string                 `json:"uid"`
+	Reason    string                 `json:"reason"`
+	Object    map[string]interface{} `json:"object"`
+}
+
+// NewWebhook returns an action posting objects to an HTTP endpoint. The
+// object is annotated once the endpoint accepted it, so that it is posted
+// again only if annotating it fails.
+func NewWebhook(endpoint string) (Action, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid url '%s': must be http or https", endpoint)
+	}
+	return webhookAction{url: endpoint, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+func newWebhookFromParams(params map[string]string) (Action, error) {
+	if err := checkParams(params, "url"); err != nil {
+		return nil, err
+	}
+	endpoint, ok := params["url"]
+	if !ok {
+		return nil, errors.New("missing parameter 'url'")
+	}
+	return NewWebhook(endpoint)
+}
+
+func (a webhookAction) Run(ctx context.Context, env Env, target Target) (Result, error) {
+	if _, called := target.Object.GetAnnotations()[AnnotationWebhookCalled]; called {
+		return Result{}, nil
+	}
+	if env.DryRun {
+		return Result{Changed: true, Event: "DryRunWebhook", Message: "DRY RUN: Would call webhook for " + target.String()}, nil
+	}
+
+	if err := a.post(ctx, target); err != nil {
+		return Result{}, err
+	}
+	if err := target.patch(ctx, env, map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{AnnotationWebhookCalled: time.Now().UTC().Format(time.RFC3339)},
+		},
+	}); err != nil {
+		return Result{}, fmt.Errorf("failed to record webhook call: %w", err)
+	}
+	return Result{Changed: true, Event: "WebhookCalled", Message: "Called webhook for " + target.String()}, nil
+}
+
+func (a webhookAction) post(ctx context.Context, target Target) error {
+	body, err := json.Marshal(WebhookPayload{
+		Group:     target.Resource.Group,
+		Version:   target.Resource.Version,
+		Resource:  target.Resource.Resource,
+		Namespace: target.Namespace,
+		Name:      target.Name,
+		UID:       string(target.Object.GetUID()),
+		Reason:    target.Reason,
+		Object:    payloadObject(target.Object).Object,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook request: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// payloadObject strips the object as archives do and drops the data of
+// Secrets, including the copy kubectl apply keeps in an annotation
+func payloadObject(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	stripped := manifest.Strip(obj)
+	if stripped.GetKind() != "Secret" || stripped.GetAPIVersion() != "v1" {
+		return stripped
+	}
+
+	unstructured.RemoveNestedField(stripped.Object, "data")
+	unstructured.RemoveNestedField(stripped.Object, "stringData")
+	unstructured.RemoveNestedField(stripped.Object, "metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration")
+	return stripped
+}
@@ -0,0 +1,110 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func TestWebhook(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		called       bool
+		dryRun       bool
+		wantChanged  bool
+		wantEvent    string
+		wantRequests int
+		wantErr      string
+	}{
+		{name: "called", status: http.StatusOK, wantChanged: true, wantEvent: "WebhookCalled", wantRequests: 1},
+		{name: "dry run", status: http.StatusOK, dryRun: true, wantChanged: true, wantEvent: "DryRunWebhook"},
+		{name: "already called", status: http.StatusOK, called: true},
+		{name: "rejected", status: http.StatusInternalServerError, wantRequests: 1, wantErr: "webhook returned status 500"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				var payload WebhookPayload
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+				assert.Equal(t, "pods", payload.Resource)
+				assert.Equal(t, "default", payload.Namespace)
+				assert.Equal(t, "web", payload.Name)
+				assert.Equal(t, "1234", payload.UID)
+				assert.Equal(t, "TTL expired", payload.Reason)
+				assert.NotContains(t, payload.Object, "status")
+				assert.NotContains(t, payload.Object["metadata"], "managedFields")
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			pod := newPod(nil)
+			if tt.called {
+				pod.SetAnnotations(map[string]string{AnnotationWebhookCalled: "2024-01-01T00:00:00Z"})
+			}
+			client := fake.NewSimpleDynamicClient(runtime.NewScheme(), pod)
+
+			action, err := NewWebhook(server.URL)
+			require.NoError(t, err)
+			result, err := action.Run(context.Background(), Env{Client: client, DryRun: tt.dryRun}, podTarget(pod))
+			assert.Equal(t, tt.wantRequests, requests)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantChanged, result.Changed)
+			assert.Equal(t, tt.wantEvent, result.Event)
+
+			got, err := client.Resource(podsGVR).Namespace("default").Get(context.Background(), "web", metav1.GetOptions{})
+			require.NoError(t, err)
+			_, annotated := got.GetAnnotations()[AnnotationWebhookCalled]
+			assert.Equal(t, tt.called || tt.wantRequests > 0, annotated)
+		})
+	}
+}
+
+func TestWebhookPayloadObject(t *testing.T) {
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":      "credentials",
+			"namespace": "default",
+			"uid":       "1234",
+			"annotations": map[string]interface{}{
+				"kubectl.kubernetes.io/last-applied-configuration": `{"data":{"password":"aHVudGVyMg=="}}`,
+				"team": "a",
+			},
+		},
+		"type":       "Opaque",
+		"data":       map[string]interface{}{"password": "aHVudGVyMg=="},
+		"stringData": map[string]interface{}{"token": "secret"},
+	}}
+
+	got := payloadObject(secret).Object
+	assert.NotContains(t, got, "data")
+	assert.NotContains(t, got, "stringData")
+	assert.Equal(t, "Opaque", got["type"])
+	metadata := got["metadata"].(map[string]interface{})
+	assert.NotContains(t, metadata, "uid")
+	assert.Equal(t, map[string]interface{}{"team": "a"}, metadata["annotations"])
+	assert.Contains(t, secret.Object, "data", "the object itself is not modified")
+
+	configMap := secret.DeepCopy()
+	configMap.SetKind("ConfigMap")
+	assert.Contains(t, payloadObject(configMap).Object, "data")
+}
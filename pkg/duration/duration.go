@@ -0,0 +1,267 @@
+// Package duration parses durations with the extended units used in janitor
+// TTLs, such as "7d", "2w3d" or "1mo", and applies them with calendar-aware
+// months and years.
+package duration
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Duration is a positive span of time. Years and months have a calendar
+// length that depends on the time they are added to; everything else is
+// a fixed length.
+type Duration struct {
+	Years  int
+	Months int
+	// Fixed holds the weeks, days and shorter units
+	Fixed time.Duration
+}
+
+// Limits keep AddTo within the range of time.Time
+const (
+	maxYears  = 10000
+	maxMonths = 12 * maxYears
+)
+
+type unit struct {
+	symbol string
+	// names are the long forms of the unit, singular and plural
+	names []string
+	// rank orders the units from the largest, and identifies the unit of aliases
+	rank   int
+	length time.Duration
+	// calendar units are years and months, which have no fixed length
+	calendar bool
+}
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+)
+
+var (
+	unitYear  = unit{symbol: "y", names: []string{"year", "years"}, rank: 0, calendar: true}
+	unitMonth = unit{symbol: "mo", names: []string{"month", "months"}, rank: 1, calendar: true}
+
+	// fixedUnits are the units String uses for the fixed part, largest first
+	fixedUnits = []unit{
+		{symbol: "w", names: []string{"week", "weeks"}, rank: 2, length: week},
+		{symbol: "d", names: []string{"day", "days"}, rank: 3, length: day},
+		{symbol: "h", names: []string{"hour", "hours"}, rank: 4, length: time.Hour},
+		{symbol: "m", names: []string{"minute", "minutes"}, rank: 5, length: time.Minute},
+		{symbol: "s", names: []string{"second", "seconds"}, rank: 6, length: time.Second},
+		{symbol: "ms", names: []string{"millisecond", "milliseconds"}, rank: 7, length: time.Millisecond},
+		{symbol: "us", names: []string{"microsecond", "microseconds"}, rank: 8, length: time.Microsecond},
+		{symbol: "ns", names: []string{"nanosecond", "nanoseconds"}, rank: 9, length: time.Nanosecond},
+	}
+
+	units = map[string]unit{
+		"µs": fixedUnits[6],
+		"μs": fixedUnits[6],
+	}
+)
+
+func init() {
+	for _, u := range append([]unit{unitYear, unitMonth}, fixedUnits...) {
+		units[u.symbol] = u
+		for _, name := range u.names {
+			units[name] = u
+		}
+	}
+}
+
+// Parse parses a sequence of terms such as "1y2mo", "2w 3d" or "1.5d".
+//
+// Each term is a non-negative decimal number followed by a unit, optionally
+// after spaces: y (years), mo (months), w (weeks), d (days), h, m, s, ms, us
+// and ns. Every unit also has a long form, singular or plural, such as "day"
+// or "days" for d. Terms may be separated by spaces and each unit may appear
+// once, in any order. Years and months must be whole numbers.
+//
+// The result must be positive: "0s" and negative durations are rejected.
+func Parse(s string) (Duration, error) {
+	var d Duration
+	input := strings.TrimSpace(s)
+	if input == "" {
+		return d, fmt.Errorf("invalid duration format: empty duration")
+	}
+	if input[0] == '-' {
+		return d, fmt.Errorf("invalid duration format: %s: negative durations are not allowed", s)
+	}
+
+	seen := make(map[int]bool)
+	for input != "" {
+		whole, fraction, scale, rest, err := parseNumber(input)
+		if err != nil {
+			return Duration{}, fmt.Errorf("invalid duration format: %s: %w", s, err)
+		}
+
+		symbol, rest := leadingLetters(strings.TrimLeft(rest, " "))
+		if symbol == "" {
+			return Duration{}, fmt.Errorf("invalid duration format: %s: missing unit", s)
+		}
+		u, ok := units[symbol]
+		if !ok {
+			return Duration{}, fmt.Errorf("invalid duration format: %s: unknown unit '%s'", s, symbol)
+		}
+		if seen[u.rank] {
+			return Duration{}, fmt.Errorf("invalid duration format: %s: unit '%s' appears more than once", s, symbol)
+		}
+		seen[u.rank] = true
+
+		if u.calendar {
+			if scale > 1 {
+				return Duration{}, fmt.Errorf("invalid duration format: %s: years and months must be whole numbers", s)
+			}
+			if err := addCalendar(&d, u, whole); err != nil {
+				return Duration{}, fmt.Errorf("invalid duration format: %s: %w", s, err)
+			}
+		} else if err := addFixed(&d, u, whole, fraction, scale); err != nil {
+			return Duration{}, fmt.Errorf("invalid duration format: %s: %w", s, err)
+		}
+
+		input = strings.TrimLeft(rest, " ")
+	}
+
+	if d.IsZero() {
+		return Duration{}, fmt.Errorf("invalid duration format: %s: duration must be positive", s)
+	}
+	return d, nil
+}
+
+// MustParse is like Parse but panics on error, for use with constants
+func MustParse(s string) Duration {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+var errRange = errors.New("duration out of range")
+
+// parseNumber reads a decimal number with an optional fraction. The fraction
+// is returned as fraction/scale, with digits beyond int64 precision dropped.
+func parseNumber(s string) (whole, fraction, scale int64, rest string, err error) {
+	i := 0
+	for ; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+		if whole > (1<<63-1-9)/10 {
+			return 0, 0, 0, "", errRange
+		}
+		whole = whole*10 + int64(s[i]-'0')
+	}
+	if i == 0 {
+		return 0, 0, 0, "", fmt.Errorf("expected a number at '%s'", s)
+	}
+
+	scale = 1
+	if i < len(s) && s[i] == '.' {
+		i++
+		start := i
+		for ; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+			if scale < (1<<63-1)/10 {
+				fraction = fraction*10 + int64(s[i]-'0')
+				scale *= 10
+			}
+		}
+		if i == start {
+			return 0, 0, 0, "", fmt.Errorf("expected digits after the decimal point")
+		}
+	}
+	return whole, fraction, scale, s[i:], nil
+}
+
+// leadingLetters splits s after its leading run of letters
+func leadingLetters(s string) (string, string) {
+	i := 0
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !unicode.IsLetter(r) {
+			break
+		}
+		i += size
+	}
+	return s[:i], s[i:]
+}
+
+func addCalendar(d *Duration, u unit, value int64) error {
+	if u.rank == unitYear.rank {
+		if value > maxYears {
+			return errRange
+		}
+		d.Years = int(value)
+		return nil
+	}
+	if value > maxMonths {
+		return errRange
+	}
+	d.Months = int(value)
+	return nil
+}
+
+func addFixed(d *Duration, u unit, whole, fraction, scale int64) error {
+	const maxDuration = time.Duration(1<<63 - 1)
+
+	if whole > int64(maxDuration/u.length) {
+		return errRange
+	}
+	v := time.Duration(whole) * u.length
+	if fraction > 0 {
+		v += time.Duration(float64(fraction) * (float64(u.length) / float64(scale)))
+		if v < 0 {
+			return errRange
+		}
+	}
+	if v > maxDuration-d.Fixed {
+		return errRange
+	}
+	d.Fixed += v
+	return nil
+}
+
+// IsZero reports whether the duration is empty, as the zero value is
+func (d Duration) IsZero() bool {
+	return d.Years == 0 && d.Months == 0 && d.Fixed == 0
+}
+
+// AddTo returns t plus the duration. Years and months are added first and
+// normalized as time.AddDate does, so one month after January 31 is March 2
+// or 3.
+func (d Duration) AddTo(t time.Time) time.Time {
+	return t.AddDate(d.Years, d.Months, 0).Add(d.Fixed)
+}
+
+// From returns the length of the duration when it starts at t
+func (d Duration) From(t time.Time) time.Duration {
+	return d.AddTo(t).Sub(t)
+}
+
+// String formats the duration in the extended form accepted by Parse, using
+// the largest units first, e.g. "1y2mo", "1w3d12h" or "1m30s"
+func (d Duration) String() string {
+	var b strings.Builder
+	if d.Years > 0 {
+		fmt.Fprintf(&b, "%d%s", d.Years, unitYear.symbol)
+	}
+	if d.Months > 0 {
+		fmt.Fprintf(&b, "%d%s", d.Months, unitMonth.symbol)
+	}
+
+	remaining := d.Fixed
+	for _, u := range fixedUnits {
+		if n := remaining / u.length; n > 0 {
+			fmt.Fprintf(&b, "%d%s", n, u.symbol)
+			remaining -= n * u.length
+		}
+	}
+
+	if b.Len() == 0 {
+		return "0s"
+	}
+	return b.String()
+}
@@ -0,0 +1,222 @@
+package duration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Duration
+		wantErr string
+	}{
+		// Standard Go durations
+		{name: "standard hours", input: "24h", want: Duration{Fixed: 24 * time.Hour}},
+		{name: "standard minutes", input: "30m", want: Duration{Fixed: 30 * time.Minute}},
+		{name: "standard combined", input: "1h30m", want: Duration{Fixed: 90 * time.Minute}},
+		{name: "fractional hours", input: "1.5h", want: Duration{Fixed: 90 * time.Minute}},
+		{name: "very small duration", input: "1ms", want: Duration{Fixed: time.Millisecond}},
+		{name: "microseconds with µ", input: "100µs", want: Duration{Fixed: 100 * time.Microsecond}},
+		{name: "microseconds with us", input: "100us", want: Duration{Fixed: 100 * time.Microsecond}},
+		{name: "nanoseconds", input: "1s5ns", want: Duration{Fixed: time.Second + 5}},
+		// Days and weeks
+		{name: "single day", input: "1d", want: Duration{Fixed: day}},
+		{name: "multiple days", input: "7d", want: Duration{Fixed: 7 * day}},
+		{name: "fractional days", input: "1.5d", want: Duration{Fixed: 36 * time.Hour}},
+		{name: "single week", input: "1w", want: Duration{Fixed: week}},
+		{name: "fractional weeks", input: "0.5w", want: Duration{Fixed: 84 * time.Hour}},
+		{name: "weeks and days", input: "2w3d", want: Duration{Fixed: 17 * day}},
+		{name: "with spaces", input: " 2w 3d  12h ", want: Duration{Fixed: 17*day + 12*time.Hour}},
+		{name: "space before unit", input: "1 month", want: Duration{Months: 1}},
+		{name: "spaces before units", input: "2 w 3 d", want: Duration{Fixed: 17 * day}},
+		{name: "smaller unit first", input: "30m1h", want: Duration{Fixed: 90 * time.Minute}},
+		// Calendar units
+		{name: "single month", input: "1mo", want: Duration{Months: 1}},
+		{name: "month long form", input: "1month", want: Duration{Months: 1}},
+		{name: "months plural", input: "3months", want: Duration{Months: 3}},
+		{name: "years", input: "2y", want: Duration{Years: 2}},
+		{name: "year long form", input: "1year6months", want: Duration{Years: 1, Months: 6}},
+		// Long forms
+		{name: "week long form", input: "1week", want: Duration{Fixed: week}},
+		{name: "days plural", input: "3 days", want: Duration{Fixed: 3 * day}},
+		{name: "day long form", input: "1day", want: Duration{Fixed: day}},
+		{name: "hours and minutes", input: "2 hours 30 minutes", want: Duration{Fixed: 150 * time.Minute}},
+		{name: "second long form", input: "1second", want: Duration{Fixed: time.Second}},
+		{
+			name:  "shorter long forms",
+			input: "1 millisecond 2 microseconds 3 nanoseconds",
+			want:  Duration{Fixed: time.Millisecond + 2*time.Microsecond + 3},
+		},
+		{
+			name:  "long forms of every unit",
+			input: "1 year 2 months 1 week 2 days 3 hours 4 minutes 5 seconds",
+			want:  Duration{Years: 1, Months: 2, Fixed: 9*day + 3*time.Hour + 4*time.Minute + 5*time.Second},
+		},
+		{
+			name:  "complex combination",
+			input: "1month2w3d12h30m",
+			want:  Duration{Months: 1, Fixed: 17*day + 12*time.Hour + 30*time.Minute},
+		},
+		// Errors
+		{name: "empty", input: "", wantErr: "empty duration"},
+		{name: "invalid format", input: "invalid", wantErr: "expected a number"},
+		{name: "invalid unit", input: "5x", wantErr: "unknown unit 'x'"},
+		{name: "mixed invalid", input: "2w3x", wantErr: "unknown unit 'x'"},
+		{name: "missing unit", input: "1h30", wantErr: "missing unit"},
+		{name: "number without unit", input: "3 2h", wantErr: "missing unit"},
+		{name: "unknown long unit", input: "3 fortnights", wantErr: "unknown unit 'fortnights'"},
+		{name: "capitalized unit", input: "3Days", wantErr: "unknown unit 'Days'"},
+		{name: "zero", input: "0s", wantErr: "must be positive"},
+		{name: "bare zero", input: "0", wantErr: "missing unit"},
+		{name: "zero days", input: "0d", wantErr: "must be positive"},
+		{name: "negative", input: "-1h", wantErr: "negative durations are not allowed"},
+		{name: "repeated unit", input: "1d1d", wantErr: "unit 'd' appears more than once"},
+		{name: "repeated unit alias", input: "1mo1month", wantErr: "unit 'month' appears more than once"},
+		{name: "repeated fixed unit alias", input: "1 day 2d", wantErr: "unit 'd' appears more than once"},
+		{name: "fractional month", input: "1.5mo", wantErr: "whole numbers"},
+		{name: "trailing decimal point", input: "1.d", wantErr: "digits after the decimal point"},
+		{name: "too many years", input: "20000y", wantErr: "out of range"},
+		{name: "fixed overflow", input: "100000000w", wantErr: "out of range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "invalid duration format")
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAddTo(t *testing.T) {
+	tests := []struct {
+		input string
+		from  time.Time
+		want  time.Time
+	}{
+		{
+			input: "1mo",
+			from:  time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC),
+			want:  time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			input: "1mo",
+			from:  time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+			want:  time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			input: "1y",
+			from:  time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+			want:  time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			input: "1mo2d",
+			from:  time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+			want:  time.Date(2024, 2, 17, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			input: "1w3d12h",
+			from:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			want:  time.Date(2024, 1, 11, 12, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			d := MustParse(tt.input)
+			assert.Equal(t, tt.want, d.AddTo(tt.from))
+			assert.Equal(t, tt.want.Sub(tt.from), d.From(tt.from))
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		duration Duration
+		want     string
+	}{
+		{duration: Duration{}, want: "0s"},
+		{duration: Duration{Fixed: time.Hour}, want: "1h"},
+		{duration: Duration{Fixed: 36 * time.Hour}, want: "1d12h"},
+		{duration: Duration{Fixed: 17*day + 12*time.Hour + 30*time.Minute}, want: "2w3d12h30m"},
+		{duration: Duration{Fixed: 90 * time.Second}, want: "1m30s"},
+		{duration: Duration{Fixed: 1500 * time.Microsecond}, want: "1ms500us"},
+		{duration: Duration{Years: 1, Months: 2, Fixed: day}, want: "1y2mo1d"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.duration.String())
+		})
+	}
+}
+
+// TestRealWorld checks TTLs as they are used in annotations
+func TestRealWorld(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		annotation  string
+		ageInHours  float64
+		shouldMatch bool
+	}{
+		{name: "7 day TTL, 5 day old resource", annotation: "7d", ageInHours: 120, shouldMatch: false},
+		{name: "7 day TTL, 8 day old resource", annotation: "7d", ageInHours: 192, shouldMatch: true},
+		{name: "2 week TTL, 10 day old resource", annotation: "2w", ageInHours: 240, shouldMatch: false},
+		{name: "1 month TTL, 30 day old resource in January", annotation: "1month", ageInHours: 720, shouldMatch: false},
+		{name: "1 month TTL, 32 day old resource in January", annotation: "1month", ageInHours: 768, shouldMatch: true},
+		{name: "complex TTL, just under limit", annotation: "1w3d12h", ageInHours: 251, shouldMatch: false},
+		{name: "complex TTL, just over limit", annotation: "1w3d12h", ageInHours: 253, shouldMatch: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := Parse(tt.annotation)
+			require.NoError(t, err)
+
+			now := created.Add(time.Duration(tt.ageInHours * float64(time.Hour)))
+			assert.Equal(t, tt.shouldMatch, now.After(d.AddTo(created)))
+		})
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{"24h", "1.5d", "2w 3d 12h", "1y2mo", "1month2w3d12h30m", "100µs", "0s", "-1h", "3 days", "1.d"} {
+		f.Add(seed)
+	}
+
+	reference := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	f.Fuzz(func(t *testing.T, s string) {
+		d, err := Parse(s)
+		if err != nil {
+			return
+		}
+		if d.IsZero() || d.Years < 0 || d.Months < 0 || d.Fixed < 0 {
+			t.Fatalf("Parse(%q) = %+v, want a positive duration", s, d)
+		}
+		if !d.AddTo(reference).After(reference) {
+			t.Fatalf("Parse(%q).AddTo(%s) = %s, want a later time", s, reference, d.AddTo(reference))
+		}
+
+		// String must round-trip through Parse
+		again, err := Parse(d.String())
+		if err != nil {
+			t.Fatalf("Parse(%q) failed on String() of %q: %v", d.String(), s, err)
+		}
+		if again != d {
+			t.Fatalf("Parse(String()) = %+v, want %+v (input %q)", again, d, s)
+		}
+	})
+}
@@ -0,0 +1,24 @@
+// Package manifest turns live objects into manifests that can be stored,
+// sent elsewhere or applied again, without what the API server manages.
+package manifest
+
+import "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+// Strip returns a copy of the object without status and server-managed metadata
+func Strip(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	stripped := obj.DeepCopy()
+	for _, field := range []string{
+		"uid",
+		"resourceVersion",
+		"generation",
+		"creationTimestamp",
+		"deletionTimestamp",
+		"deletionGracePeriodSeconds",
+		"managedFields",
+		"selfLink",
+	} {
+		unstructured.RemoveNestedField(stripped.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(stripped.Object, "status")
+	return stripped
+}
@@ -0,0 +1,40 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestStrip(t *testing.T) {
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]interface{}{
+				"name":              "settings",
+				"namespace":         "default",
+				"uid":               "1234",
+				"resourceVersion":   "42",
+				"creationTimestamp": "2024-01-01T00:00:00Z",
+				"labels":            map[string]interface{}{"app": "demo"},
+				"managedFields":     []interface{}{map[string]interface{}{"manager": "kubectl"}},
+			},
+			"data":   map[string]interface{}{"key": "value"},
+			"status": map[string]interface{}{"phase": "Active"},
+		},
+	}
+	stripped := Strip(obj)
+
+	assert.Empty(t, stripped.GetUID())
+	assert.Empty(t, stripped.GetResourceVersion())
+	assert.Empty(t, stripped.GetManagedFields())
+	assert.NotContains(t, stripped.Object["metadata"], "creationTimestamp")
+	assert.NotContains(t, stripped.Object, "status")
+	assert.Equal(t, map[string]string{"app": "demo"}, stripped.GetLabels())
+
+	// The original object is left untouched
+	assert.Equal(t, "1234", string(obj.GetUID()))
+	assert.Contains(t, obj.Object, "status")
+}